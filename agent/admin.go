@@ -0,0 +1,374 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal/secret"
+	"github.com/circonus-labs/circonus-unified-agent/selfstat"
+)
+
+const (
+	adminReadTimeout  = 5 * time.Second
+	adminWriteTimeout = 10 * time.Second
+	redacted          = "<redacted>"
+)
+
+// AdminServer serves a read-only JSON view of the running agent: the loaded
+// configuration, per-plugin self stats and any state plugins report via the
+// cua.StatusReporter interface. The server outlives config reloads, the
+// agent being served is replaced with SetAgent after each reload.
+type AdminServer struct {
+	started  time.Time
+	agent    *Agent
+	server   *http.Server
+	listener net.Listener
+	mu       sync.RWMutex
+}
+
+// NewAdminServer returns an admin server which will listen on addr once started.
+func NewAdminServer(addr string) *AdminServer {
+	s := &AdminServer{started: time.Now()}
+	s.server = &http.Server{
+		Addr:         addr,
+		Handler:      s.Handler(),
+		ReadTimeout:  adminReadTimeout,
+		WriteTimeout: adminWriteTimeout,
+	}
+	return s
+}
+
+// SetAgent sets the agent being served.
+func (s *AdminServer) SetAgent(a *Agent) {
+	s.mu.Lock()
+	s.agent = a
+	s.mu.Unlock()
+}
+
+// Start begins listening, requests are served in the background until Stop is called.
+func (s *AdminServer) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return fmt.Errorf("admin listener: %w", err)
+	}
+	s.listener = listener
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("E! [agent] admin server: %s", err)
+		}
+	}()
+
+	log.Printf("I! [agent] Started admin HTTP server at: http://%s/", listener.Addr().String())
+	return nil
+}
+
+// Addr returns the address the server is listening on.
+func (s *AdminServer) Addr() string {
+	if s.listener == nil {
+		return s.server.Addr
+	}
+	return s.listener.Addr().String()
+}
+
+// Stop shuts down the server.
+func (s *AdminServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), adminWriteTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		log.Printf("E! [agent] stopping admin server: %s", err)
+	}
+}
+
+// Handler returns the admin endpoint handler.
+func (s *AdminServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.index)
+	mux.HandleFunc("/config", s.withAgent(s.config))
+	mux.HandleFunc("/plugins", s.withAgent(s.plugins))
+	mux.HandleFunc("/stats", s.stats)
+	return mux
+}
+
+func (s *AdminServer) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.RLock()
+	loaded := s.agent != nil
+	s.mu.RUnlock()
+	writeJSON(w, map[string]interface{}{
+		"started":   s.started,
+		"loaded":    loaded,
+		"endpoints": []string{"/config", "/plugins", "/stats"},
+	})
+}
+
+// withAgent calls h with a copy of the running agent's config, the plugin lists are
+// replaced by Reload so they are only read under the agent's reload lock.
+func (s *AdminServer) withAgent(h func(http.ResponseWriter, *config.Config)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		s.mu.RLock()
+		a := s.agent
+		s.mu.RUnlock()
+		if a == nil || a.Config == nil {
+			http.Error(w, "agent not running", http.StatusServiceUnavailable)
+			return
+		}
+		a.reloadmu.Lock()
+		c := *a.Config
+		a.reloadmu.Unlock()
+		h(w, &c)
+	}
+}
+
+type adminPluginConfig struct {
+	CheckTags        map[string]string `json:"check_tags,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+	Name             string            `json:"name"`
+	Alias            string            `json:"alias,omitempty"`
+	InstanceID       string            `json:"instance_id,omitempty"`
+	CheckTarget      string            `json:"check_target,omitempty"`
+	CheckDisplayName string            `json:"check_display_name,omitempty"`
+	Interval         string            `json:"interval,omitempty"`
+	Order            int64             `json:"order,omitempty"`
+}
+
+type adminConfig struct {
+	Agent         config.AgentConfig  `json:"agent"`
+	GlobalTags    map[string]string   `json:"global_tags"`
+	Inputs        []adminPluginConfig `json:"inputs"`
+	Processors    []adminPluginConfig `json:"processors"`
+	Aggregators   []adminPluginConfig `json:"aggregators"`
+	AggProcessors []adminPluginConfig `json:"aggregator_processors"`
+	Outputs       []adminPluginConfig `json:"outputs"`
+}
+
+func (s *AdminServer) config(w http.ResponseWriter, c *config.Config) {
+	ac := adminConfig{
+		GlobalTags:    c.Tags,
+		Inputs:        make([]adminPluginConfig, 0, len(c.Inputs)),
+		Processors:    make([]adminPluginConfig, 0, len(c.Processors)),
+		Aggregators:   make([]adminPluginConfig, 0, len(c.Aggregators)),
+		AggProcessors: make([]adminPluginConfig, 0, len(c.AggProcessors)),
+		Outputs:       make([]adminPluginConfig, 0, len(c.Outputs)),
+	}
+	if c.Agent != nil {
+		ac.Agent = *c.Agent
+		if ac.Agent.Circonus.APIToken != "" {
+			ac.Agent.Circonus.APIToken = redacted
+		}
+		if len(c.Agent.CirconusProfiles) > 0 {
+			// copy, the profiles map is shared with the running config
+			ac.Agent.CirconusProfiles = make(map[string]config.CirconusConfig, len(c.Agent.CirconusProfiles))
+			for name, profile := range c.Agent.CirconusProfiles {
+				if profile.APIToken != "" {
+					profile.APIToken = redacted
+				}
+				ac.Agent.CirconusProfiles[name] = profile
+			}
+		}
+	}
+	for _, input := range c.Inputs {
+		pc := adminPluginConfig{
+			Name:             input.Config.Name,
+			Alias:            input.Config.Alias,
+			InstanceID:       input.Config.InstanceID,
+			CheckTarget:      input.Config.CheckTarget,
+			CheckDisplayName: input.Config.CheckDisplayName,
+			CheckTags:        input.Config.CheckTags,
+			Tags:             input.Config.Tags,
+		}
+		if input.Config.Interval != 0 {
+			pc.Interval = input.Config.Interval.String()
+		}
+		ac.Inputs = append(ac.Inputs, pc)
+	}
+	for _, processor := range c.Processors {
+		ac.Processors = append(ac.Processors, adminPluginConfig{
+			Name:  processor.Config.Name,
+			Alias: processor.Config.Alias,
+			Order: processor.Config.Order,
+		})
+	}
+	for _, aggregator := range c.Aggregators {
+		ac.Aggregators = append(ac.Aggregators, adminPluginConfig{
+			Name:     aggregator.Config.Name,
+			Alias:    aggregator.Config.Alias,
+			Interval: aggregator.Config.Period.String(),
+			Tags:     aggregator.Config.Tags,
+		})
+	}
+	for _, processor := range c.AggProcessors {
+		ac.AggProcessors = append(ac.AggProcessors, adminPluginConfig{
+			Name:  processor.Config.Name,
+			Alias: processor.Config.Alias,
+			Order: processor.Config.Order,
+		})
+	}
+	for _, output := range c.Outputs {
+		pc := adminPluginConfig{
+			Name:  output.Config.Name,
+			Alias: output.Config.Alias,
+		}
+		if output.Config.FlushInterval != 0 {
+			pc.Interval = output.Config.FlushInterval.String()
+		}
+		ac.Outputs = append(ac.Outputs, pc)
+	}
+
+	writeJSON(w, ac)
+}
+
+type adminPluginStatus struct {
+	LastErrorTime *time.Time                        `json:"last_error_time,omitempty"`
+	Stats         map[string]map[string]interface{} `json:"stats"`
+	Status        interface{}                       `json:"status,omitempty"`
+	Name          string                            `json:"name"`
+	Alias         string                            `json:"alias,omitempty"`
+	InstanceID    string                            `json:"instance_id,omitempty"`
+	LastError     string                            `json:"last_error,omitempty"`
+	BufferLength  *int                              `json:"buffer_length,omitempty"`
+	BufferLimit   *int                              `json:"buffer_limit,omitempty"`
+}
+
+func (s *AdminServer) plugins(w http.ResponseWriter, c *config.Config) {
+	snapshot := selfstat.Snapshot()
+
+	inputs := make([]adminPluginStatus, 0, len(c.Inputs))
+	for _, input := range c.Inputs {
+		tags := map[string]string{"input": input.Config.Name}
+		if input.Config.Alias != "" {
+			tags["alias"] = input.Config.Alias
+		}
+		if input.Config.InstanceID != "" {
+			tags["instance_id"] = input.Config.InstanceID
+		}
+		ps := adminPluginStatus{
+			Name:       input.Config.Name,
+			Alias:      input.Config.Alias,
+			InstanceID: input.Config.InstanceID,
+			Stats:      pluginStats(snapshot, tags),
+		}
+		ps.setLastError(input.LastError())
+		if sr, ok := input.Input.(cua.StatusReporter); ok {
+			ps.Status = sr.Status()
+		}
+		inputs = append(inputs, ps)
+	}
+
+	outputs := make([]adminPluginStatus, 0, len(c.Outputs))
+	for _, output := range c.Outputs {
+		tags := map[string]string{"output": output.Config.Name}
+		if output.Config.Alias != "" {
+			tags["alias"] = output.Config.Alias
+		}
+		bufLen := output.BufferLength()
+		bufLimit := output.MetricBufferLimit
+		ps := adminPluginStatus{
+			Name:         output.Config.Name,
+			Alias:        output.Config.Alias,
+			Stats:        pluginStats(snapshot, tags),
+			BufferLength: &bufLen,
+			BufferLimit:  &bufLimit,
+		}
+		ps.setLastError(output.LastError())
+		if sr, ok := output.Output.(cua.StatusReporter); ok {
+			ps.Status = sr.Status()
+		}
+		outputs = append(outputs, ps)
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"inputs":  inputs,
+		"outputs": outputs,
+	})
+}
+
+func (ps *adminPluginStatus) setLastError(msg string, ts time.Time) {
+	if msg == "" {
+		return
+	}
+	ps.LastError = msg
+	ps.LastErrorTime = &ts
+}
+
+type adminStat struct {
+	Tags   map[string]string      `json:"tags"`
+	Fields map[string]interface{} `json:"fields"`
+	Name   string                 `json:"name"`
+}
+
+func (s *AdminServer) stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	snapshot := selfstat.Snapshot()
+	stats := make([]adminStat, 0, len(snapshot))
+	for _, m := range snapshot {
+		stats = append(stats, adminStat{Name: m.Name(), Tags: m.Tags(), Fields: m.Fields()})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Name != stats[j].Name {
+			return stats[i].Name < stats[j].Name
+		}
+		return fmt.Sprint(stats[i].Tags) < fmt.Sprint(stats[j].Tags)
+	})
+	writeJSON(w, stats)
+}
+
+// pluginStats returns the self stats registered with exactly the given tags, keyed by measurement.
+func pluginStats(snapshot []cua.Metric, tags map[string]string) map[string]map[string]interface{} {
+	stats := make(map[string]map[string]interface{})
+	for _, m := range snapshot {
+		if !equalTags(m.Tags(), tags) {
+			continue
+		}
+		fields, ok := stats[m.Name()]
+		if !ok {
+			fields = make(map[string]interface{})
+			stats[m.Name()] = fields
+		}
+		for k, v := range m.Fields() {
+			fields[k] = v
+		}
+	}
+	return stats
+}
+
+func equalTags(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(secret.RedactBytes(data))
+}
@@ -0,0 +1,140 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/models"
+	"github.com/stretchr/testify/require"
+)
+
+type adminTestInput struct{}
+
+func (i *adminTestInput) SampleConfig() string { return "" }
+func (i *adminTestInput) Description() string  { return "" }
+func (i *adminTestInput) Gather(_ context.Context, _ cua.Accumulator) error {
+	return nil
+}
+func (i *adminTestInput) Status() interface{} {
+	return map[string]string{"state": "ok"}
+}
+
+func getAdminJSON(t *testing.T, h http.Handler, path string, v interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	if rec.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v))
+	}
+	return rec.Code
+}
+
+func TestAdminServer(t *testing.T) {
+	s := NewAdminServer("localhost:0")
+	h := s.Handler()
+
+	var resp map[string]interface{}
+	require.Equal(t, http.StatusServiceUnavailable, getAdminJSON(t, h, "/plugins", &resp))
+
+	c := config.NewConfig()
+	c.Agent.Circonus.APIToken = "secret"
+	c.Agent.CirconusProfiles = map[string]config.CirconusConfig{"tenant": {APIToken: "secret"}}
+	input := models.NewRunningInput(&adminTestInput{}, &models.InputConfig{
+		Name:       "admintest",
+		InstanceID: "admin_test_1",
+	})
+	input.MetricsGathered.Incr(3)
+	input.Log().Errorf("gather failed: %s", "timeout")
+	c.Inputs = append(c.Inputs, input)
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	s.SetAgent(a)
+
+	var cfg adminConfig
+	require.Equal(t, http.StatusOK, getAdminJSON(t, h, "/config", &cfg))
+	require.Equal(t, redacted, cfg.Agent.Circonus.APIToken)
+	require.Equal(t, redacted, cfg.Agent.CirconusProfiles["tenant"].APIToken)
+	require.Equal(t, "secret", c.Agent.CirconusProfiles["tenant"].APIToken)
+	require.Len(t, cfg.Inputs, 1)
+	require.Equal(t, "admin_test_1", cfg.Inputs[0].InstanceID)
+
+	var plugins struct {
+		Inputs []adminPluginStatus `json:"inputs"`
+	}
+	require.Equal(t, http.StatusOK, getAdminJSON(t, h, "/plugins", &plugins))
+	require.Len(t, plugins.Inputs, 1)
+	in := plugins.Inputs[0]
+	require.Equal(t, "gather failed: timeout", in.LastError)
+	require.NotNil(t, in.LastErrorTime)
+	require.Equal(t, float64(3), in.Stats["internal_gather"]["metrics_gathered"])
+	require.Equal(t, float64(1), in.Stats["internal_gather"]["errors"])
+	require.Equal(t, map[string]interface{}{"state": "ok"}, in.Status)
+
+	var stats []adminStat
+	require.Equal(t, http.StatusOK, getAdminJSON(t, h, "/stats", &stats))
+	require.NotEmpty(t, stats)
+}
+
+func TestAdminServerDuringReload(t *testing.T) {
+	c := newReloadTestConfig()
+	c.Inputs = append(c.Inputs, newReloadTestInput("a", "1", &reloadTestInput{}))
+	c.Outputs = append(c.Outputs, newReloadTestOutput("1", &reloadTestOutput{}))
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+	s := NewAdminServer("localhost:0")
+	s.SetAgent(a)
+	h := s.Handler()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+	require.Eventually(t, func() bool {
+		a.reloadmu.Lock()
+		defer a.reloadmu.Unlock()
+		return a.running != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the plugin lists are replaced by each reload while they are served
+	configs := make([]*config.Config, 10)
+	for i := range configs {
+		configs[i] = newReloadTestConfig()
+		configs[i].Inputs = append(configs[i].Inputs, newReloadTestInput("a", strconv.Itoa(i+2), &reloadTestInput{}))
+		configs[i].Outputs = append(configs[i].Outputs, newReloadTestOutput("1", &reloadTestOutput{}))
+	}
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		for _, nc := range configs {
+			_ = a.Reload(nc)
+		}
+	}()
+	for serving := true; serving; {
+		select {
+		case <-reloaded:
+			serving = false
+		default:
+		}
+		var cfg adminConfig
+		require.Equal(t, http.StatusOK, getAdminJSON(t, h, "/config", &cfg))
+		require.Len(t, cfg.Inputs, 1)
+		var plugins struct {
+			Inputs []adminPluginStatus `json:"inputs"`
+		}
+		require.Equal(t, http.StatusOK, getAdminJSON(t, h, "/plugins", &plugins))
+		require.Len(t, plugins.Inputs, 1)
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
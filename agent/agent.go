@@ -17,9 +17,19 @@ import (
 	circjson "github.com/circonus-labs/circonus-unified-agent/plugins/serializers/circonus"
 )
 
+// connectRetryDelay is the time to wait before retrying to connect an output
+var connectRetryDelay = 15 * time.Second
+
 // Agent runs a set of plugins.
 type Agent struct {
 	Config *config.Config
+
+	// running plugin units, set while Run is active, used by Reload
+	running  *runState
+	reloadmu sync.Mutex
+
+	// persisted plugin state, nil without a data directory
+	state *stateStore
 }
 
 // NewAgent returns an Agent for the given Config.
@@ -44,6 +54,12 @@ func NewAgent(config *config.Config) (*Agent, error) {
 type inputUnit struct {
 	dst    chan<- cua.Metric
 	inputs []*models.RunningInput
+
+	// inputs can be added and removed by Reload while running
+	running  map[*models.RunningInput]*runningPlugin
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	stopping bool
 }
 
 //	______     ┌───────────┐     ______
@@ -55,6 +71,10 @@ type processorUnit struct {
 	src       <-chan cua.Metric
 	dst       chan<- cua.Metric
 	processor *models.RunningProcessor
+
+	// the processor can be replaced by Reload while running
+	acc cua.Accumulator
+	mu  sync.Mutex
 }
 
 // aggregatorUnit is a group of Aggregators and their source and sink channels.
@@ -98,6 +118,13 @@ type aggregatorUnit struct {
 type outputUnit struct {
 	src     <-chan cua.Metric
 	outputs []*models.RunningOutput
+
+	// outputs can be added and removed by Reload while running
+	ctx      context.Context
+	running  map[*models.RunningOutput]*runningPlugin
+	wg       sync.WaitGroup
+	mu       sync.RWMutex
+	stopping bool
 }
 
 // Run starts and runs the Agent until the context is done.
@@ -113,6 +140,10 @@ func (a *Agent) Run(ctx context.Context) error {
 		return err
 	}
 
+	if err := a.initState(); err != nil {
+		return err
+	}
+
 	startTime := time.Now()
 
 	log.Printf("D! [agent] Connecting outputs")
@@ -148,6 +179,16 @@ func (a *Agent) Run(ctx context.Context) error {
 		return err
 	}
 
+	a.setRunState(&runState{
+		ctx:           ctx,
+		startTime:     startTime,
+		inputs:        iu,
+		outputs:       ou,
+		processors:    pu,
+		aggProcessors: apu,
+	})
+	defer a.setRunState(nil)
+
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -183,8 +224,18 @@ func (a *Agent) Run(ctx context.Context) error {
 		a.runInputs(ctx, startTime, iu)
 	}()
 
+	if a.state != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.runStateSaver(ctx)
+		}()
+	}
+
 	wg.Wait()
 
+	a.saveState()
+
 	log.Printf("D! [agent] Stopped Successfully")
 	return err
 }
@@ -268,45 +319,19 @@ func (a *Agent) runInputs(
 	startTime time.Time,
 	unit *inputUnit,
 ) {
-	var wg sync.WaitGroup
+	unit.mu.Lock()
 	for _, input := range unit.inputs {
-		// Overwrite agent interval if this plugin has its own.
-		interval := a.Config.Agent.Interval.Duration
-		if input.Config.Interval != 0 {
-			interval = input.Config.Interval
-		}
-
-		// Overwrite agent precision if this plugin has its own.
-		precision := a.Config.Agent.Precision.Duration
-		if input.Config.Precision != 0 {
-			precision = input.Config.Precision
-		}
-
-		// Overwrite agent collection_jitter if this plugin has its own.
-		jitter := a.Config.Agent.CollectionJitter.Duration
-		if input.Config.CollectionJitter != 0 {
-			jitter = input.Config.CollectionJitter
-		}
-
-		var ticker Ticker
-		if a.Config.Agent.RoundInterval {
-			ticker = NewAlignedTicker(startTime, interval, jitter)
-		} else {
-			ticker = NewUnalignedTicker(interval, jitter)
-		}
-		defer ticker.Stop()
+		a.startGatherLoop(ctx, startTime, unit, input)
+	}
+	unit.mu.Unlock()
 
-		acc := NewAccumulator(input, unit.dst)
-		acc.SetPrecision(getPrecision(precision, interval))
+	<-ctx.Done()
 
-		wg.Add(1)
-		go func(input *models.RunningInput) {
-			defer wg.Done()
-			a.gatherLoop(ctx, acc, input, ticker, interval)
-		}(input)
-	}
+	unit.mu.Lock()
+	unit.stopping = true
+	unit.mu.Unlock()
 
-	wg.Wait()
+	unit.wg.Wait()
 
 	log.Printf("D! [agent] Stopping service inputs")
 	stopServiceInputs(unit.inputs)
@@ -315,6 +340,57 @@ func (a *Agent) runInputs(
 	log.Printf("D! [agent] Input channel closed")
 }
 
+// startGatherLoop starts the periodic gather for an input, the caller must hold unit.mu.
+func (a *Agent) startGatherLoop(
+	ctx context.Context,
+	startTime time.Time,
+	unit *inputUnit,
+	input *models.RunningInput,
+) {
+	// Overwrite agent interval if this plugin has its own.
+	interval := a.Config.Agent.Interval.Duration
+	if input.Config.Interval != 0 {
+		interval = input.Config.Interval
+	}
+
+	// Overwrite agent precision if this plugin has its own.
+	precision := a.Config.Agent.Precision.Duration
+	if input.Config.Precision != 0 {
+		precision = input.Config.Precision
+	}
+
+	// Overwrite agent collection_jitter if this plugin has its own.
+	jitter := a.Config.Agent.CollectionJitter.Duration
+	if input.Config.CollectionJitter != 0 {
+		jitter = input.Config.CollectionJitter
+	}
+
+	var ticker Ticker
+	if a.Config.Agent.RoundInterval {
+		ticker = NewAlignedTicker(startTime, interval, jitter)
+	} else {
+		ticker = NewUnalignedTicker(interval, jitter)
+	}
+
+	acc := NewAccumulator(input, unit.dst)
+	acc.SetPrecision(getPrecision(precision, interval))
+
+	inputCtx, cancel := context.WithCancel(ctx)
+	rp := &runningPlugin{cancel: cancel, done: make(chan struct{})}
+	if unit.running == nil {
+		unit.running = make(map[*models.RunningInput]*runningPlugin)
+	}
+	unit.running[input] = rp
+
+	unit.wg.Add(1)
+	go func() {
+		defer unit.wg.Done()
+		defer close(rp.done)
+		defer ticker.Stop()
+		a.gatherLoop(inputCtx, acc, input, ticker, interval)
+	}()
+}
+
 // testStartInputs is a variation of startInputs for use in --test and --once
 // mode.  It differs by logging Start errors and returning only plugins
 // successfully started.
@@ -531,14 +607,21 @@ func (a *Agent) runProcessors(
 		go func(unit *processorUnit) {
 			defer wg.Done()
 
-			acc := NewAccumulator(unit.processor, unit.dst)
+			unit.mu.Lock()
+			unit.acc = NewAccumulator(unit.processor, unit.dst)
+			unit.mu.Unlock()
+
 			for m := range unit.src {
-				if err := unit.processor.Add(m, acc); err != nil {
-					acc.AddError(err)
+				unit.mu.Lock()
+				if err := unit.processor.Add(m, unit.acc); err != nil {
+					unit.acc.AddError(err)
 					m.Drop()
 				}
+				unit.mu.Unlock()
 			}
+			unit.mu.Lock()
 			unit.processor.Stop()
+			unit.mu.Unlock()
 			close(unit.dst)
 			log.Printf("D! [agent] Processor channel closed")
 		}(unit)
@@ -689,10 +772,10 @@ func (a *Agent) connectOutput(ctx context.Context, output *models.RunningOutput)
 	log.Printf("D! [agent] Attempting connection to [%s]", output.LogName())
 	err := output.Output.Connect()
 	if err != nil {
-		log.Printf("E! [agent] Failed to connect to [%s], retrying in 15s, "+
-			"error was '%s'", output.LogName(), err)
+		log.Printf("E! [agent] Failed to connect to [%s], retrying in %s, "+
+			"error was '%s'", output.LogName(), connectRetryDelay, err)
 
-		err := internal.SleepContext(ctx, 15*time.Second)
+		err := internal.SleepContext(ctx, connectRetryDelay)
 		if err != nil {
 			return fmt.Errorf("sleepcontext: %w", err)
 		}
@@ -712,51 +795,75 @@ func (a *Agent) connectOutput(ctx context.Context, output *models.RunningOutput)
 func (a *Agent) runOutputs(
 	unit *outputUnit,
 ) {
-	var wg sync.WaitGroup
-
-	// Start flush loop
-	interval := a.Config.Agent.FlushInterval.Duration
-	jitter := a.Config.Agent.FlushJitter.Duration
-
 	ctx, cancel := context.WithCancel(context.Background())
 
+	unit.mu.Lock()
+	unit.ctx = ctx
 	for _, output := range unit.outputs {
-		interval := interval
-		// Overwrite agent flush_interval if this plugin has its own.
-		if output.Config.FlushInterval != 0 {
-			interval = output.Config.FlushInterval
-		}
-
-		jitter := jitter
-		// Overwrite agent flush_jitter if this plugin has its own.
-		if output.Config.FlushJitter != 0 {
-			jitter = output.Config.FlushJitter
-		}
-
-		wg.Add(1)
-		go func(output *models.RunningOutput) {
-			defer wg.Done()
-
-			ticker := NewRollingTicker(interval, jitter)
-			defer ticker.Stop()
-
-			a.flushLoop(ctx, output, ticker)
-		}(output)
+		a.startFlushLoop(ctx, unit, output)
 	}
+	unit.mu.Unlock()
 
 	for metric := range unit.src {
+		unit.mu.RLock()
+		if len(unit.outputs) == 0 {
+			// only while the last output is being replaced on reload
+			metric.Drop()
+		}
 		for i, output := range unit.outputs {
-			if i == len(a.Config.Outputs)-1 {
+			if i == len(unit.outputs)-1 {
 				output.AddMetric(metric)
 			} else {
 				output.AddMetric(metric.Copy())
 			}
 		}
+		unit.mu.RUnlock()
 	}
 
+	unit.mu.Lock()
+	unit.stopping = true
+	unit.mu.Unlock()
+
 	log.Println("I! [agent] Hang on, flushing any cached metrics before shutdown")
 	cancel()
-	wg.Wait()
+	unit.wg.Wait()
+}
+
+// startFlushLoop starts the periodic flush for an output, the caller must hold unit.mu.
+func (a *Agent) startFlushLoop(
+	ctx context.Context,
+	unit *outputUnit,
+	output *models.RunningOutput,
+) {
+	// Overwrite agent flush_interval if this plugin has its own.
+	interval := a.Config.Agent.FlushInterval.Duration
+	if output.Config.FlushInterval != 0 {
+		interval = output.Config.FlushInterval
+	}
+
+	// Overwrite agent flush_jitter if this plugin has its own.
+	jitter := a.Config.Agent.FlushJitter.Duration
+	if output.Config.FlushJitter != 0 {
+		jitter = output.Config.FlushJitter
+	}
+
+	outputCtx, cancel := context.WithCancel(ctx)
+	rp := &runningPlugin{cancel: cancel, done: make(chan struct{})}
+	if unit.running == nil {
+		unit.running = make(map[*models.RunningOutput]*runningPlugin)
+	}
+	unit.running[output] = rp
+
+	unit.wg.Add(1)
+	go func() {
+		defer unit.wg.Done()
+		defer close(rp.done)
+
+		ticker := NewRollingTicker(interval, jitter)
+		defer ticker.Stop()
+
+		a.flushLoop(outputCtx, output, ticker)
+	}()
 }
 
 // flushLoop runs an output's flush function periodically until the context is
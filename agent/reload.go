@@ -0,0 +1,543 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/models"
+)
+
+// ErrFullReloadRequired is returned by Reload when the configuration changes
+// cannot be applied to the running plugins, the agent has to be restarted with
+// the new configuration instead.
+var ErrFullReloadRequired = errors.New("full reload required")
+
+// runState holds the plugin units of a running agent.
+type runState struct {
+	startTime     time.Time
+	ctx           context.Context
+	inputs        *inputUnit
+	outputs       *outputUnit
+	processors    []*processorUnit
+	aggProcessors []*processorUnit
+}
+
+// runningPlugin is used to stop the gather or flush loop of a single plugin.
+type runningPlugin struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (rp *runningPlugin) stop() {
+	rp.cancel()
+	<-rp.done
+}
+
+func (a *Agent) setRunState(rs *runState) {
+	a.reloadmu.Lock()
+	a.running = rs
+	a.reloadmu.Unlock()
+}
+
+// Reload applies a new configuration to the running agent. The new config is
+// compared with the running one and only the inputs, processors and outputs
+// whose settings changed are stopped and (re)started, the others keep running
+// untouched along with their buffers and service listeners.
+//
+// Changes to the agent settings, global tags or aggregators, and processors
+// being added, removed or reordered, cannot be applied this way, in which case
+// ErrFullReloadRequired is returned and nothing is changed.
+func (a *Agent) Reload(newConfig *config.Config) error {
+	a.reloadmu.Lock()
+	defer a.reloadmu.Unlock()
+
+	rs := a.running
+	if rs == nil {
+		return fmt.Errorf("agent not running: %w", ErrFullReloadRequired)
+	}
+	if err := a.checkReloadable(newConfig); err != nil {
+		return fmt.Errorf("%s: %w", err.Error(), ErrFullReloadRequired)
+	}
+
+	var errs []error
+
+	// outputs first, so new inputs do not emit metrics before their destinations exist
+	outputs, n, err := a.reloadOutputs(rs, newConfig.Outputs)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	changes := n
+
+	processors, n, err := a.reloadProcessors("processors", rs.processors, a.Config.Processors, newConfig.Processors)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	changes += n
+	aggProcessors, _, err := a.reloadProcessors("aggregator_processors", rs.aggProcessors, a.Config.AggProcessors, newConfig.AggProcessors)
+	if err != nil {
+		errs = append(errs, err)
+	}
+
+	inputs, n, err := a.reloadInputs(rs, newConfig.Inputs)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	changes += n
+
+	a.Config.Inputs = inputs
+	a.Config.Outputs = outputs
+	a.Config.Processors = processors
+	a.Config.AggProcessors = aggProcessors
+
+	if changes == 0 {
+		log.Printf("I! [agent] Reload: no plugin changes")
+	} else {
+		log.Printf("I! [agent] Reload: %d plugin(s) changed", changes)
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkReloadable returns an error describing why the new config cannot be applied
+// to the running plugins.
+func (a *Agent) checkReloadable(newConfig *config.Config) error {
+	old := a.Config
+	switch {
+	case !reflect.DeepEqual(old.Agent, newConfig.Agent):
+		return fmt.Errorf("agent settings changed")
+	case !reflect.DeepEqual(old.Tags, newConfig.Tags):
+		return fmt.Errorf("global tags changed")
+	case len(old.Aggregators) != len(newConfig.Aggregators):
+		return fmt.Errorf("aggregators changed")
+	case len(old.Processors) != len(newConfig.Processors):
+		return fmt.Errorf("processors added or removed")
+	case len(old.AggProcessors) != len(newConfig.AggProcessors):
+		return fmt.Errorf("processors added or removed")
+	}
+
+	for i, agg := range old.Aggregators {
+		if agg.Config.Name != newConfig.Aggregators[i].Config.Name || agg.Config.Hash != newConfig.Aggregators[i].Config.Hash {
+			return fmt.Errorf("aggregators changed")
+		}
+	}
+
+	// the running processors have been sorted by startProcessors, match their order
+	for _, procs := range []models.RunningProcessors{newConfig.Processors, newConfig.AggProcessors} {
+		sort.SliceStable(procs, func(i, j int) bool {
+			return procs[i].Config.Order > procs[j].Config.Order
+		})
+	}
+	for i, proc := range old.Processors {
+		np := newConfig.Processors[i]
+		if proc.Config.Name != np.Config.Name || proc.Config.Alias != np.Config.Alias || proc.Config.Order != np.Config.Order {
+			return fmt.Errorf("processors reordered")
+		}
+	}
+
+	if key, ok := duplicateInput(newConfig.Inputs); ok {
+		return fmt.Errorf("duplicate input %s", key)
+	}
+	if key, ok := duplicateOutput(newConfig.Outputs); ok {
+		return fmt.Errorf("duplicate output %s", key)
+	}
+
+	return nil
+}
+
+func inputKey(input *models.RunningInput) string {
+	return input.Config.Name + ":" + input.Config.InstanceID
+}
+
+func outputKey(output *models.RunningOutput) string {
+	return output.Config.Name + ":" + output.Config.Alias
+}
+
+func duplicateInput(inputs []*models.RunningInput) (string, bool) {
+	seen := make(map[string]bool, len(inputs))
+	for _, input := range inputs {
+		key := inputKey(input)
+		if seen[key] {
+			return key, true
+		}
+		seen[key] = true
+	}
+	return "", false
+}
+
+func duplicateOutput(outputs []*models.RunningOutput) (string, bool) {
+	seen := make(map[string]bool, len(outputs))
+	for _, output := range outputs {
+		key := outputKey(output)
+		if seen[key] {
+			return key, true
+		}
+		seen[key] = true
+	}
+	return "", false
+}
+
+// reloadInputs stops removed inputs, replaces changed inputs and starts new ones, it
+// returns the resulting list of inputs and the number of inputs changed. A changed
+// input is only stopped once its replacement has been initialized, and it is
+// restarted if the replacement fails to start.
+func (a *Agent) reloadInputs(rs *runState, newInputs []*models.RunningInput) ([]*models.RunningInput, int, error) {
+	unit := rs.inputs
+
+	unit.mu.Lock()
+	current := make(map[string]*models.RunningInput, len(unit.inputs))
+	for _, input := range unit.inputs {
+		current[inputKey(input)] = input
+	}
+	unit.mu.Unlock()
+
+	inputs := make([]*models.RunningInput, 0, len(newInputs))
+	var start []*models.RunningInput
+	replaces := make(map[*models.RunningInput]*models.RunningInput)
+	keep := make(map[string]bool, len(newInputs))
+	for _, input := range newInputs {
+		key := inputKey(input)
+		old, ok := current[key]
+		if ok && old.Config.Hash == input.Config.Hash {
+			inputs = append(inputs, old)
+			keep[key] = true
+			continue
+		}
+		if ok {
+			replaces[input] = old
+			keep[key] = true
+		}
+		start = append(start, input)
+	}
+
+	changes := 0
+	for key, input := range current {
+		if keep[key] {
+			continue
+		}
+		log.Printf("I! [agent] Reload: stopping input %s", input.LogName())
+		a.stopInput(unit, input)
+		changes++
+	}
+
+	var errs []error
+	for _, input := range start {
+		changes++
+		old, ok := replaces[input]
+		if !ok {
+			log.Printf("I! [agent] Reload: starting input %s", input.LogName())
+			if err := a.startInput(rs, input); err != nil {
+				errs = append(errs, fmt.Errorf("starting input %s: %w", input.LogName(), err))
+				continue
+			}
+			inputs = append(inputs, input)
+			continue
+		}
+
+		log.Printf("I! [agent] Reload: replacing input %s", input.LogName())
+		if err := input.Init(); err != nil {
+			// the running input is kept
+			errs = append(errs, fmt.Errorf("initializing input %s: %w", input.LogName(), err))
+			inputs = append(inputs, old)
+			continue
+		}
+		a.stopInput(unit, old)
+		if err := a.runInput(rs, input); err != nil {
+			errs = append(errs, fmt.Errorf("starting input %s: %w", input.LogName(), err))
+			if rerr := a.runInput(rs, old); rerr != nil {
+				log.Printf("E! [agent] Reload: restarting input %s: %s", old.LogName(), rerr)
+				continue
+			}
+			inputs = append(inputs, old)
+			continue
+		}
+		inputs = append(inputs, input)
+	}
+
+	return inputs, changes, errors.Join(errs...)
+}
+
+// stopInput stops the gather loop of an input and, for service inputs, the service.
+func (a *Agent) stopInput(unit *inputUnit, input *models.RunningInput) {
+	unit.mu.Lock()
+	rp := unit.running[input]
+	delete(unit.running, input)
+	for i, in := range unit.inputs {
+		if in == input {
+			unit.inputs = append(unit.inputs[:i], unit.inputs[i+1:]...)
+			break
+		}
+	}
+	unit.mu.Unlock()
+
+	if rp != nil {
+		rp.stop()
+	}
+	if si, ok := input.Input.(cua.ServiceInput); ok {
+		si.Stop()
+	}
+	a.state.collect(inputStateID(input), input.Input)
+}
+
+// startInput initializes an input, starts it if it is a service input and
+// starts its gather loop.
+func (a *Agent) startInput(rs *runState, input *models.RunningInput) error {
+	if err := input.Init(); err != nil {
+		return err
+	}
+	return a.runInput(rs, input)
+}
+
+// runInput restores the state of an initialized input, starts it if it is a
+// service input and starts its gather loop.
+func (a *Agent) runInput(rs *runState, input *models.RunningInput) error {
+	if err := a.state.restore(inputStateID(input), input.Input); err != nil {
+		log.Printf("E! [agent] Reload: %s", err)
+	}
+
+	unit := rs.inputs
+	unit.mu.Lock()
+	defer unit.mu.Unlock()
+
+	if unit.stopping {
+		return fmt.Errorf("agent is stopping")
+	}
+
+	if si, ok := input.Input.(cua.ServiceInput); ok {
+		acc := NewAccumulator(input, unit.dst)
+		acc.SetPrecision(getPrecision(input.Config.Precision, 0))
+		if err := si.Start(rs.ctx, acc); err != nil {
+			return fmt.Errorf("start: %w", err)
+		}
+	}
+
+	unit.inputs = append(unit.inputs, input)
+	a.startGatherLoop(rs.ctx, rs.startTime, unit, input)
+	return nil
+}
+
+// reloadOutputs replaces changed outputs, moving any buffered metrics to the
+// replacement, closes removed outputs and starts new ones. It returns the
+// resulting list of outputs and the number of outputs changed. A changed output
+// stops flushing, but keeps buffering metrics, while its replacement is initialized
+// and connected, it is only closed once the replacement is running and its flush
+// loop is restarted if the replacement fails.
+//
+// Metrics are not fanned out to the outputs while they are being replaced.
+func (a *Agent) reloadOutputs(rs *runState, newOutputs []*models.RunningOutput) ([]*models.RunningOutput, int, error) {
+	unit := rs.outputs
+
+	unit.mu.Lock()
+	if unit.stopping {
+		unit.mu.Unlock()
+		return a.Config.Outputs, 0, fmt.Errorf("agent is stopping")
+	}
+
+	current := make(map[string]*models.RunningOutput, len(unit.outputs))
+	for _, output := range unit.outputs {
+		current[outputKey(output)] = output
+	}
+
+	outputs := make([]*models.RunningOutput, 0, len(newOutputs))
+	var start []*models.RunningOutput
+	replaces := make(map[*models.RunningOutput]*models.RunningOutput)
+	keep := make(map[string]bool, len(newOutputs))
+	for _, output := range newOutputs {
+		key := outputKey(output)
+		old, ok := current[key]
+		if ok && old.Config.Hash == output.Config.Hash {
+			outputs = append(outputs, old)
+			keep[key] = true
+			continue
+		}
+		if ok {
+			replaces[output] = old
+			keep[key] = true
+		}
+		start = append(start, output)
+	}
+
+	changes := 0
+	for key, output := range current {
+		if keep[key] {
+			continue
+		}
+		log.Printf("I! [agent] Reload: stopping output %s", output.LogName())
+		a.stopFlushLoop(unit, output) // writes any buffered metrics one last time
+		output.Close()
+		a.state.collect(outputStateID(output), output.Output)
+		changes++
+	}
+
+	var errs []error
+	started := make([]*models.RunningOutput, 0, len(start))
+	for _, output := range start {
+		changes++
+		old, replacing := replaces[output]
+		if replacing {
+			log.Printf("I! [agent] Reload: replacing output %s", output.LogName())
+			a.stopFlushLoop(unit, old)
+			a.state.collect(outputStateID(old), old.Output)
+			output.ShareDiskBuffer(old)
+		} else {
+			log.Printf("I! [agent] Reload: starting output %s", output.LogName())
+		}
+		if err := output.Init(); err != nil {
+			errs = append(errs, fmt.Errorf("initializing output %s: %w", output.LogName(), err))
+			if replacing {
+				// the running output is kept
+				output.ReleaseBuffer(old)
+				a.startFlushLoop(unit.ctx, unit, old)
+				outputs = append(outputs, old)
+			}
+			continue
+		}
+		if err := a.state.restore(outputStateID(output), output.Output); err != nil {
+			log.Printf("E! [agent] Reload: %s", err)
+		}
+		if replacing {
+			outputs = append(outputs, old) // buffers metrics until the replacement is connected
+		} else {
+			outputs = append(outputs, output)
+		}
+		started = append(started, output)
+	}
+	unit.outputs = outputs
+	unit.mu.Unlock()
+
+	for _, output := range started {
+		old, replacing := replaces[output]
+		err := a.connectOutput(rs.ctx, output)
+
+		unit.mu.Lock()
+		if err != nil {
+			errs = append(errs, err)
+			if replacing {
+				output.ReleaseBuffer(old)
+				if !unit.stopping {
+					a.startFlushLoop(unit.ctx, unit, old)
+				}
+			} else {
+				removeOutput(unit, output)
+			}
+			unit.mu.Unlock()
+			output.Close()
+			continue
+		}
+		if replacing {
+			if n := old.TransferBuffer(output); n > 0 {
+				log.Printf("I! [agent] Reload: moved %d buffered metrics to %s", n, output.LogName())
+			}
+			for i, o := range unit.outputs {
+				if o == old {
+					unit.outputs[i] = output
+					break
+				}
+			}
+		}
+		if !unit.stopping {
+			a.startFlushLoop(unit.ctx, unit, output)
+		}
+		unit.mu.Unlock()
+		if replacing {
+			old.Close()
+		}
+	}
+
+	unit.mu.RLock()
+	outputs = append([]*models.RunningOutput{}, unit.outputs...)
+	unit.mu.RUnlock()
+
+	return outputs, changes, errors.Join(errs...)
+}
+
+// stopFlushLoop stops the flush loop of an output, the caller must hold unit.mu.
+func (a *Agent) stopFlushLoop(unit *outputUnit, output *models.RunningOutput) {
+	if rp, ok := unit.running[output]; ok {
+		delete(unit.running, output)
+		rp.stop()
+	}
+}
+
+// removeOutput removes an output from the unit, the caller must hold unit.mu.
+func removeOutput(unit *outputUnit, output *models.RunningOutput) {
+	for i, o := range unit.outputs {
+		if o == output {
+			unit.outputs = append(unit.outputs[:i], unit.outputs[i+1:]...)
+			return
+		}
+	}
+}
+
+// reloadProcessors replaces, in place, the running processors whose settings
+// changed. It returns the resulting list of processors and the number replaced.
+func (a *Agent) reloadProcessors(
+	kind string,
+	units []*processorUnit,
+	current models.RunningProcessors,
+	newProcessors models.RunningProcessors,
+) (models.RunningProcessors, int, error) {
+	processors := make(models.RunningProcessors, 0, len(current))
+	processors = append(processors, current...)
+
+	if len(units) == 0 {
+		// the chain is not running, e.g. the aggregator processors without aggregators
+		return processors, 0, nil
+	}
+
+	var errs []error
+	changes := 0
+	for i, unit := range units {
+		np := newProcessors[i]
+		unit.mu.Lock()
+		old := unit.processor
+		if old.Config.Hash == np.Config.Hash {
+			unit.mu.Unlock()
+			continue
+		}
+		changes++
+		log.Printf("I! [agent] Reload: replacing processor %s", old.LogName())
+		if err := a.replaceProcessor(kind, unit, np); err != nil {
+			errs = append(errs, fmt.Errorf("replacing processor %s: %w", old.LogName(), err))
+		} else {
+			processors[i] = np
+		}
+		unit.mu.Unlock()
+	}
+
+	return processors, changes, errors.Join(errs...)
+}
+
+// replaceProcessor stops the unit's processor and starts np in its place, if np
+// cannot be started the previous processor is restarted. The caller must hold unit.mu.
+func (a *Agent) replaceProcessor(kind string, unit *processorUnit, np *models.RunningProcessor) error {
+	if err := np.Init(); err != nil {
+		return err
+	}
+
+	old := unit.processor
+	old.Stop()
+
+	a.state.collect(processorStateID(kind, old), old.Processor)
+	if err := a.state.restore(processorStateID(kind, np), np.Processor); err != nil {
+		log.Printf("E! [agent] Reload: %s", err)
+	}
+
+	acc := NewAccumulator(np, unit.dst)
+	if err := np.Start(acc); err != nil {
+		if rerr := old.Start(NewAccumulator(old, unit.dst)); rerr != nil {
+			log.Printf("E! [agent] Reload: restarting processor %s: %s", old.LogName(), rerr)
+		}
+		return fmt.Errorf("start: %w", err)
+	}
+
+	unit.processor = np
+	unit.acc = acc
+	return nil
+}
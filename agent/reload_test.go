@@ -0,0 +1,266 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
+	"github.com/circonus-labs/circonus-unified-agent/models"
+	"github.com/stretchr/testify/require"
+)
+
+type reloadTestInput struct {
+	initErr  error
+	startErr error
+	started  int
+	stopped  int
+	mu       sync.Mutex
+}
+
+func (i *reloadTestInput) SampleConfig() string { return "" }
+func (i *reloadTestInput) Description() string  { return "" }
+func (i *reloadTestInput) Gather(_ context.Context, acc cua.Accumulator) error {
+	acc.AddFields("reload_test", map[string]interface{}{"value": 1}, nil)
+	return nil
+}
+func (i *reloadTestInput) Init() error { return i.initErr }
+func (i *reloadTestInput) Start(_ context.Context, _ cua.Accumulator) error {
+	if i.startErr != nil {
+		return i.startErr
+	}
+	i.mu.Lock()
+	i.started++
+	i.mu.Unlock()
+	return nil
+}
+func (i *reloadTestInput) Stop() {
+	i.mu.Lock()
+	i.stopped++
+	i.mu.Unlock()
+}
+
+type reloadTestOutput struct {
+	initErr    error
+	connectErr error
+	written    int
+	closed     bool
+	mu         sync.Mutex
+}
+
+func (o *reloadTestOutput) SampleConfig() string { return "" }
+func (o *reloadTestOutput) Description() string  { return "" }
+func (o *reloadTestOutput) Init() error          { return o.initErr }
+func (o *reloadTestOutput) Connect() error       { return o.connectErr }
+func (o *reloadTestOutput) Close() error {
+	o.mu.Lock()
+	o.closed = true
+	o.mu.Unlock()
+	return nil
+}
+func (o *reloadTestOutput) Write(metrics []cua.Metric) (int, error) {
+	o.mu.Lock()
+	o.written += len(metrics)
+	o.mu.Unlock()
+	return len(metrics), nil
+}
+func (o *reloadTestOutput) count() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.written
+}
+func (o *reloadTestOutput) isClosed() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.closed
+}
+
+func newReloadTestConfig() *config.Config {
+	c := config.NewConfig()
+	c.Agent.Interval = internal.Duration{Duration: 10 * time.Millisecond}
+	c.Agent.FlushInterval = internal.Duration{Duration: 10 * time.Millisecond}
+	c.Agent.RoundInterval = false
+	return c
+}
+
+func newReloadTestInput(id, hash string, input cua.Input) *models.RunningInput {
+	return models.NewRunningInput(input, &models.InputConfig{
+		Name:       "reload_test",
+		Alias:      id,
+		InstanceID: id,
+		Hash:       hash,
+	})
+}
+
+func newReloadTestOutput(hash string, output cua.Output) *models.RunningOutput {
+	return models.NewRunningOutput("reload_test", output, &models.OutputConfig{
+		Name: "reload_test",
+		Hash: hash,
+	}, 1000, 10000)
+}
+
+func TestAgent_Reload(t *testing.T) {
+	inputA := &reloadTestInput{}
+	output1 := &reloadTestOutput{}
+
+	c := newReloadTestConfig()
+	runningA := newReloadTestInput("a", "1", inputA)
+	c.Inputs = append(c.Inputs, runningA)
+	c.Outputs = append(c.Outputs, newReloadTestOutput("1", output1))
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool { return output1.count() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// input a is unchanged, input b is new and the output settings changed
+	inputB := &reloadTestInput{}
+	output2 := &reloadTestOutput{}
+	nc := newReloadTestConfig()
+	nc.Inputs = append(nc.Inputs,
+		newReloadTestInput("a", "1", &reloadTestInput{}),
+		newReloadTestInput("b", "2", inputB))
+	nc.Outputs = append(nc.Outputs, newReloadTestOutput("2", output2))
+
+	require.NoError(t, a.Reload(nc))
+
+	require.Len(t, a.Config.Inputs, 2)
+	require.Same(t, runningA, a.Config.Inputs[0])
+	require.Len(t, a.Config.Outputs, 1)
+	require.Same(t, output2, a.Config.Outputs[0].Output)
+
+	inputA.mu.Lock()
+	require.Equal(t, 1, inputA.started)
+	require.Equal(t, 0, inputA.stopped)
+	inputA.mu.Unlock()
+
+	inputB.mu.Lock()
+	require.Equal(t, 1, inputB.started)
+	inputB.mu.Unlock()
+
+	output1.mu.Lock()
+	require.True(t, output1.closed)
+	output1.mu.Unlock()
+
+	require.Eventually(t, func() bool { return output2.count() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// agent settings can only be changed by restarting the agent
+	nc = newReloadTestConfig()
+	nc.Agent.Interval = internal.Duration{Duration: time.Second}
+	nc.Inputs = append(nc.Inputs, newReloadTestInput("a", "1", &reloadTestInput{}))
+	nc.Outputs = append(nc.Outputs, newReloadTestOutput("2", &reloadTestOutput{}))
+	require.ErrorIs(t, a.Reload(nc), ErrFullReloadRequired)
+
+	cancel()
+	require.NoError(t, <-done)
+
+	inputB.mu.Lock()
+	require.Equal(t, 1, inputB.stopped)
+	inputB.mu.Unlock()
+}
+
+func TestAgent_ReloadInputFailure(t *testing.T) {
+	inputA := &reloadTestInput{}
+	output := &reloadTestOutput{}
+
+	c := newReloadTestConfig()
+	runningA := newReloadTestInput("a", "1", inputA)
+	c.Inputs = append(c.Inputs, runningA)
+	c.Outputs = append(c.Outputs, newReloadTestOutput("1", output))
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool { return output.count() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	reload := func(input *reloadTestInput) error {
+		nc := newReloadTestConfig()
+		nc.Inputs = append(nc.Inputs, newReloadTestInput("a", "2", input))
+		nc.Outputs = append(nc.Outputs, newReloadTestOutput("1", &reloadTestOutput{}))
+		return a.Reload(nc)
+	}
+
+	// the changed input fails to initialize, the running input is not stopped
+	require.Error(t, reload(&reloadTestInput{initErr: errors.New("bad config")}))
+	require.Len(t, a.Config.Inputs, 1)
+	require.Same(t, runningA, a.Config.Inputs[0])
+	inputA.mu.Lock()
+	require.Equal(t, 1, inputA.started)
+	require.Equal(t, 0, inputA.stopped)
+	inputA.mu.Unlock()
+
+	// the changed input fails to start, the running input is restarted
+	require.Error(t, reload(&reloadTestInput{startErr: errors.New("address in use")}))
+	require.Len(t, a.Config.Inputs, 1)
+	require.Same(t, runningA, a.Config.Inputs[0])
+	inputA.mu.Lock()
+	require.Equal(t, 2, inputA.started)
+	require.Equal(t, 1, inputA.stopped)
+	inputA.mu.Unlock()
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestAgent_ReloadOutputFailure(t *testing.T) {
+	delay := connectRetryDelay
+	connectRetryDelay = time.Millisecond
+	t.Cleanup(func() { connectRetryDelay = delay })
+
+	output := &reloadTestOutput{}
+
+	c := newReloadTestConfig()
+	c.Inputs = append(c.Inputs, newReloadTestInput("a", "1", &reloadTestInput{}))
+	runningOutput := newReloadTestOutput("1", output)
+	c.Outputs = append(c.Outputs, runningOutput)
+
+	a, err := NewAgent(c)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool { return output.count() > 0 }, 5*time.Second, 10*time.Millisecond)
+
+	reload := func(replacement *reloadTestOutput) error {
+		nc := newReloadTestConfig()
+		nc.Inputs = append(nc.Inputs, newReloadTestInput("a", "1", &reloadTestInput{}))
+		nc.Outputs = append(nc.Outputs, newReloadTestOutput("2", replacement))
+		return a.Reload(nc)
+	}
+
+	for _, replacement := range []*reloadTestOutput{
+		{initErr: errors.New("bad config")},
+		{connectErr: errors.New("connection refused")},
+	} {
+		// the replacement fails, the running output keeps its buffer and is flushed again
+		require.Error(t, reload(replacement))
+		require.Len(t, a.Config.Outputs, 1)
+		require.Same(t, runningOutput, a.Config.Outputs[0])
+		require.False(t, output.isClosed())
+		written := output.count()
+		require.Eventually(t, func() bool { return output.count() > written }, 5*time.Second, 10*time.Millisecond)
+	}
+
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,243 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/models"
+)
+
+const (
+	stateFile                = "state.json"
+	defaultStateSaveInterval = time.Minute
+)
+
+// stateStore persists the state of plugins implementing cua.StatefulPlugin
+// in a single file in the agent data directory. Plugins are identified by
+// type, name and instance_id (inputs) or alias.
+//
+// A nil store is valid, nothing is persisted.
+type stateStore struct {
+	state map[string]json.RawMessage
+	path  string
+	mu    sync.Mutex
+}
+
+func newStateStore(dir string) (*stateStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("data directory: %w", err)
+	}
+
+	s := &stateStore{
+		path:  filepath.Join(dir, stateFile),
+		state: make(map[string]json.RawMessage),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("reading plugin state: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		// start over rather than refusing to start, plugins fall back to their defaults
+		log.Printf("E! [agent] Ignoring plugin state %s: %s", s.path, err)
+		s.state = make(map[string]json.RawMessage)
+	}
+	return s, nil
+}
+
+// restore sets the saved state of a stateful plugin, if there is one.
+func (s *stateStore) restore(id string, plugin interface{}) error {
+	sp, ok := statefulPlugin(plugin)
+	if s == nil || !ok {
+		return nil
+	}
+
+	s.mu.Lock()
+	data, ok := s.state[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	// decode into the type the plugin returns from GetState
+	var state interface{}
+	if current := sp.GetState(); current != nil {
+		v := reflect.New(reflect.TypeOf(current))
+		if err := json.Unmarshal(data, v.Interface()); err != nil {
+			return fmt.Errorf("decoding state of %s: %w", id, err)
+		}
+		state = v.Elem().Interface()
+	} else if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("decoding state of %s: %w", id, err)
+	}
+
+	if err := sp.SetState(state); err != nil {
+		return fmt.Errorf("restoring state of %s: %w", id, err)
+	}
+	return nil
+}
+
+// collect records the current state of a stateful plugin, it is written by save.
+func (s *stateStore) collect(id string, plugin interface{}) {
+	sp, ok := statefulPlugin(plugin)
+	if s == nil || !ok {
+		return
+	}
+
+	data, err := json.Marshal(sp.GetState())
+	if err != nil {
+		log.Printf("E! [agent] Encoding state of %s: %s", id, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.state[id] = data
+	s.mu.Unlock()
+}
+
+// save writes the collected state to disk.
+func (s *stateStore) save() error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	data, err := json.Marshal(s.state)
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encoding plugin state: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return fmt.Errorf("writing plugin state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("writing plugin state: %w", err)
+	}
+	return nil
+}
+
+// unwrappable lets the processor be retrieved from a streaming processor wrapper.
+type unwrappable interface {
+	Unwrap() cua.Processor
+}
+
+func statefulPlugin(plugin interface{}) (cua.StatefulPlugin, bool) {
+	if sp, ok := plugin.(cua.StatefulPlugin); ok {
+		return sp, true
+	}
+	if u, ok := plugin.(unwrappable); ok {
+		sp, ok := u.Unwrap().(cua.StatefulPlugin)
+		return sp, ok
+	}
+	return nil, false
+}
+
+func inputStateID(input *models.RunningInput) string {
+	return "inputs." + inputKey(input)
+}
+
+func outputStateID(output *models.RunningOutput) string {
+	return "outputs." + outputKey(output)
+}
+
+func processorStateID(kind string, processor *models.RunningProcessor) string {
+	return kind + "." + processor.Config.Name + ":" + processor.Config.Alias
+}
+
+func aggregatorStateID(aggregator *models.RunningAggregator) string {
+	return "aggregators." + aggregator.Config.Name + ":" + aggregator.Config.Alias
+}
+
+// initState loads the saved plugin state, when a data directory is configured,
+// and restores it into the initialized plugins.
+func (a *Agent) initState() error {
+	if a.Config.Agent.DataDirectory == "" {
+		return nil
+	}
+
+	var err error
+	a.state, err = newStateStore(a.Config.Agent.DataDirectory)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, input := range a.Config.Inputs {
+		errs = append(errs, a.state.restore(inputStateID(input), input.Input))
+	}
+	for _, processor := range a.Config.Processors {
+		errs = append(errs, a.state.restore(processorStateID("processors", processor), processor.Processor))
+	}
+	for _, processor := range a.Config.AggProcessors {
+		errs = append(errs, a.state.restore(processorStateID("aggregator_processors", processor), processor.Processor))
+	}
+	for _, aggregator := range a.Config.Aggregators {
+		errs = append(errs, a.state.restore(aggregatorStateID(aggregator), aggregator.Aggregator))
+	}
+	for _, output := range a.Config.Outputs {
+		errs = append(errs, a.state.restore(outputStateID(output), output.Output))
+	}
+	return errors.Join(errs...)
+}
+
+// saveState collects the state of all plugins and writes it to disk.
+func (a *Agent) saveState() {
+	if a.state == nil {
+		return
+	}
+
+	a.reloadmu.Lock()
+	for _, input := range a.Config.Inputs {
+		a.state.collect(inputStateID(input), input.Input)
+	}
+	for _, processor := range a.Config.Processors {
+		a.state.collect(processorStateID("processors", processor), processor.Processor)
+	}
+	for _, processor := range a.Config.AggProcessors {
+		a.state.collect(processorStateID("aggregator_processors", processor), processor.Processor)
+	}
+	for _, aggregator := range a.Config.Aggregators {
+		a.state.collect(aggregatorStateID(aggregator), aggregator.Aggregator)
+	}
+	for _, output := range a.Config.Outputs {
+		a.state.collect(outputStateID(output), output.Output)
+	}
+	a.reloadmu.Unlock()
+
+	if err := a.state.save(); err != nil {
+		log.Printf("E! [agent] %s", err)
+	}
+}
+
+// runStateSaver periodically saves the plugin state until the context is done.
+func (a *Agent) runStateSaver(ctx context.Context) {
+	interval := a.Config.Agent.StateSaveInterval.Duration
+	if interval <= 0 {
+		interval = defaultStateSaveInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.saveState()
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/stretchr/testify/require"
+)
+
+type stateTestState struct {
+	Offsets map[string]int64 `json:"offsets"`
+	Count   int              `json:"count"`
+}
+
+type stateTestInput struct {
+	restored *stateTestState
+	state    stateTestState
+	mu       sync.Mutex
+}
+
+func (i *stateTestInput) SampleConfig() string { return "" }
+func (i *stateTestInput) Description() string  { return "" }
+func (i *stateTestInput) Gather(_ context.Context, _ cua.Accumulator) error {
+	i.mu.Lock()
+	i.state.Count++
+	i.mu.Unlock()
+	return nil
+}
+func (i *stateTestInput) GetState() interface{} {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.state
+}
+func (i *stateTestInput) SetState(state interface{}) error {
+	s := state.(stateTestState)
+	i.restored = &s
+	i.state = s
+	return nil
+}
+
+func TestStateStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := newStateStore(dir)
+	require.NoError(t, err)
+
+	input := &stateTestInput{state: stateTestState{Count: 3, Offsets: map[string]int64{"a": 10}}}
+	s.collect("inputs.state_test:a", input)
+	require.NoError(t, s.save())
+
+	s, err = newStateStore(dir)
+	require.NoError(t, err)
+
+	restored := &stateTestInput{}
+	require.NoError(t, s.restore("inputs.state_test:a", restored))
+	require.Equal(t, &stateTestState{Count: 3, Offsets: map[string]int64{"a": 10}}, restored.restored)
+
+	// no saved state
+	other := &stateTestInput{}
+	require.NoError(t, s.restore("inputs.state_test:b", other))
+	require.Nil(t, other.restored)
+
+	// a nil store does nothing
+	var ns *stateStore
+	ns.collect("inputs.state_test:a", input)
+	require.NoError(t, ns.restore("inputs.state_test:a", other))
+	require.NoError(t, ns.save())
+}
+
+func TestAgent_PersistState(t *testing.T) {
+	dir := t.TempDir()
+
+	run := func(input *stateTestInput) {
+		c := newReloadTestConfig()
+		c.Agent.DataDirectory = dir
+		c.Inputs = append(c.Inputs, newReloadTestInput("a", "1", input))
+		c.Outputs = append(c.Outputs, newReloadTestOutput("1", &reloadTestOutput{}))
+
+		a, err := NewAgent(c)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error)
+		go func() {
+			done <- a.Run(ctx)
+		}()
+		require.Eventually(t, func() bool {
+			input.mu.Lock()
+			defer input.mu.Unlock()
+			return input.state.Count > 2
+		}, 5*time.Second, 10*time.Millisecond)
+		cancel()
+		require.NoError(t, <-done)
+	}
+
+	first := &stateTestInput{}
+	run(first)
+
+	second := &stateTestInput{}
+	run(second)
+	require.NotNil(t, second.restored)
+	require.Equal(t, first.state.Count, second.restored.Count)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/circonus-labs/circonus-unified-agent/internal/circonus"
+	apiclicfg "github.com/circonus-labs/go-apiclient/config"
+)
+
+// checkCache runs the check-cache command on the check bundle cache of
+// agent.circonus and each circonus profile:
+//
+//	list            cached checks, when they were fetched and whether they are stale
+//	verify          compare each cached check with the API, report missing/changed checks
+//	purge [key...]  remove cached checks, all of them if no destination keys are given
+func checkCache(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("check-cache: command required (list, verify or purge)")
+	}
+
+	c := config.NewConfig()
+	if err := c.LoadConfig(*fConfig); err != nil {
+		return fmt.Errorf("loadconfig (%s): %w", *fConfig, err)
+	}
+
+	if err := circonus.Initialize(c.GetGlobalCirconusConfig()); err != nil {
+		return fmt.Errorf("unable to initialize circonus: %w", err)
+	}
+	profiles, err := c.GetCirconusProfiles()
+	if err != nil {
+		return fmt.Errorf("unable to initialize circonus: %w", err)
+	}
+	names := []string{circonus.DefaultProfile}
+	for name, profile := range profiles {
+		if err := circonus.InitializeProfile(name, profile); err != nil {
+			return fmt.Errorf("unable to initialize circonus profile %s: %w", name, err)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := 0
+	for _, name := range names {
+		label := name
+		if label == circonus.DefaultProfile {
+			label = "agent.circonus"
+		}
+
+		switch args[0] {
+		case "list":
+			checks, err := circonus.ListCachedChecks(name)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+			ttl := circonus.CacheTTL(name)
+			for _, cc := range checks {
+				if cc.Err != nil {
+					fmt.Printf("%s\t%s\tinvalid: %s\n", label, cc.Key, cc.Err)
+					continue
+				}
+				state := "ok"
+				if cc.Stale(ttl) {
+					state = "stale"
+				}
+				fetched := "unknown"
+				if !cc.Fetched.IsZero() {
+					fetched = cc.Fetched.Format(time.RFC3339)
+				}
+				fmt.Printf("%s\t%s\t%s\t%s\tfetched %s\t%s\n", label, cc.Key, cc.Bundle.CID,
+					cc.Bundle.Config[apiclicfg.SubmissionURL], fetched, state)
+			}
+		case "verify":
+			checks, err := circonus.ListCachedChecks(name)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+			for _, cc := range checks {
+				if err := circonus.VerifyCachedCheck(name, cc); err != nil {
+					fmt.Printf("%s\t%s\t%s\n", label, cc.Key, err)
+					problems++
+					continue
+				}
+				fmt.Printf("%s\t%s\tok\n", label, cc.Key)
+			}
+		case "purge":
+			n, err := circonus.PurgeCachedChecks(name, args[1:])
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+			fmt.Printf("%s\tpurged %d cached check(s)\n", label, n)
+		default:
+			return fmt.Errorf("check-cache: unknown command %q (list, verify or purge)", args[0])
+		}
+	}
+
+	if problems > 0 {
+		return fmt.Errorf("%d cached check(s) failed verification, purge them to have the agent look them up again", problems)
+	}
+	return nil
+}
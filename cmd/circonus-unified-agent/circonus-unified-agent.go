@@ -15,6 +15,7 @@ import (
 	"os/signal"
 	"sort"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -38,6 +39,8 @@ var fDebug = flag.Bool("debug", false,
 	"turn on debug logging")
 var pprofAddr = flag.String("pprof-addr", "",
 	"pprof address to listen on, not activate pprof if empty")
+var fAdminAddr = flag.String("admin-addr", "",
+	"admin api address to listen on (json introspection of the running agent), not activated if empty")
 var fQuiet = flag.Bool("quiet", false,
 	"run in quiet mode")
 var fTest = flag.Bool("test", false,
@@ -48,6 +51,21 @@ var fConfig = flag.String("config", "",
 	"configuration file to load")
 var fConfigDirectory = flag.String("config-directory", "",
 	"directory containing additional *.conf files")
+var fConfigCheck = flag.Bool("config-check", false,
+	"validate the config file and directory, print any problems found and exit")
+var fWatchConfig = flag.Bool("watch-config", false,
+	"watch the config file and directory for changes and reload automatically")
+var fConfigHeaders headerFlags
+var fConfigTLSCA = flag.String("config-tls-ca", "",
+	"CA to verify the server of a remote (http/https) config file")
+var fConfigTLSCert = flag.String("config-tls-cert", "",
+	"client certificate to fetch a remote config file with")
+var fConfigTLSKey = flag.String("config-tls-key", "",
+	"client key to fetch a remote config file with")
+var fConfigLastKnownGood = flag.String("config-last-known-good", "",
+	"local copy of the last remote config loaded, used when the server can't be reached at startup")
+var fConfigPollInterval = flag.Duration("config-poll-interval", 0,
+	"poll a remote config for changes and reload automatically, not polled if 0")
 var fVersion = flag.Bool("version", false,
 	"display the version and exit")
 var fSampleConfig = flag.Bool("sample-config", false,
@@ -75,6 +93,11 @@ var fPlugins = flag.String("plugin-directory", "",
 var fRunOnce = flag.Bool("once", false,
 	"run one gather and exit")
 
+func init() {
+	flag.Var(&fConfigHeaders, "config-header",
+		"header to fetch a remote config file with, 'Name: value', may be repeated")
+}
+
 var (
 	version   string
 	commit    string
@@ -85,12 +108,39 @@ var (
 
 var stop chan struct{}
 
+// the agent currently running, used to apply config reloads
+var (
+	runningAgent   *agent.Agent
+	runningAgentMu sync.Mutex
+)
+
+// adminServer, when enabled, is shared across config reloads
+var adminServer *agent.AdminServer
+
 func reloadLoop(
 	inputFilters []string,
 	outputFilters []string,
 	aggregatorFilters []string, //nolint:unparam
 	processorFilters []string, //nolint:unparam
 ) {
+	configChanged := make(chan struct{}, 1)
+	if *fWatchConfig {
+		w, err := config.NewWatcher(*fConfig, *fConfigDirectory, 0)
+		if err != nil {
+			log.Fatalf("E! [circonus-unified-agent] %v", err)
+		}
+		go w.Run(context.Background(), configChanged)
+		log.Printf("I! Watching config for changes")
+	}
+	if *fConfigPollInterval > 0 {
+		w, err := config.NewRemoteWatcher(*fConfig, *fConfigPollInterval)
+		if err != nil {
+			log.Fatalf("E! [circonus-unified-agent] %v", err)
+		}
+		go w.Run(context.Background(), configChanged)
+		log.Printf("I! Polling remote config for changes every %s", *fConfigPollInterval)
+	}
+
 	reload := make(chan bool, 1)
 	reload <- true
 	for <-reload {
@@ -101,16 +151,31 @@ func reloadLoop(
 		signals := make(chan os.Signal, 1)
 		signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
 		go func() {
-			select {
-			case sig := <-signals:
-				if sig == syscall.SIGHUP {
-					log.Printf("I! Reloading config")
+			defer signal.Stop(signals)
+			for {
+				select {
+				case sig := <-signals:
+					if sig == syscall.SIGHUP {
+						log.Printf("I! Reloading config")
+						if !applyReload(inputFilters, outputFilters) {
+							continue
+						}
+						<-reload
+						reload <- true
+					}
+					cancel()
+				case <-configChanged:
+					log.Printf("I! Config changed, reloading")
+					if !applyReload(inputFilters, outputFilters) {
+						continue
+					}
 					<-reload
 					reload <- true
+					cancel()
+				case <-stop:
+					cancel()
 				}
-				cancel()
-			case <-stop:
-				cancel()
+				return
 			}
 		}()
 
@@ -121,54 +186,127 @@ func reloadLoop(
 	}
 }
 
-func runAgent(ctx context.Context,
-	inputFilters []string,
-	outputFilters []string,
-) error {
-	log.Printf("I! Starting Circonus Unified Agent %s", version)
+// applyReload reloads the running agent's config, it returns true if the agent
+// has to be restarted to apply the changes. Configs which fail to load are
+// logged and the current config is kept.
+func applyReload(inputFilters, outputFilters []string) bool {
+	err := reloadAgent(inputFilters, outputFilters)
+	if err == nil {
+		return false
+	}
+	if !errors.Is(err, agent.ErrFullReloadRequired) {
+		log.Printf("E! [circonus-unified-agent] Error reloading config, keeping current config: %v", err)
+		return false
+	}
+	log.Printf("I! Restarting agent, %v", err)
+	return true
+}
 
-	// If no other options are specified, load the config file and run.
+// reloadAgent loads the configuration and applies the changes to the running
+// agent, only plugins whose settings changed are restarted. It returns an error
+// wrapping agent.ErrFullReloadRequired if the agent needs to be restarted.
+func reloadAgent(inputFilters, outputFilters []string) error {
+	runningAgentMu.Lock()
+	ag := runningAgent
+	runningAgentMu.Unlock()
+	if ag == nil {
+		return fmt.Errorf("agent not running: %w", agent.ErrFullReloadRequired)
+	}
+
+	c, err := loadConfig(inputFilters, outputFilters)
+	if err != nil {
+		return err
+	}
+
+	if err := ag.Reload(c); err != nil {
+		return err //nolint:wrapcheck
+	}
+	circonus.ScheduleRetireChecks(pluginInstances(c))
+
+	return nil
+}
+
+// pluginInstances returns the configured input instances, the checks of instances
+// no longer configured are retired (agent.circonus retire_checks).
+func pluginInstances(c *config.Config) []circonus.PluginInstance {
+	instances := make([]circonus.PluginInstance, 0, len(c.Inputs))
+	for _, input := range c.Inputs {
+		instances = append(instances, circonus.PluginInstance{
+			PluginID:   input.Config.Name,
+			InstanceID: input.Config.InstanceID,
+		})
+	}
+	return instances
+}
+
+// loadConfig loads and validates the config file and directory.
+func loadConfig(inputFilters, outputFilters []string) (*config.Config, error) {
 	c := config.NewConfig()
 	c.OutputFilters = outputFilters
 	c.InputFilters = inputFilters
 	err := c.LoadConfig(*fConfig)
 	if err != nil {
-		return fmt.Errorf("loadconfig (%s): %w", *fConfig, err)
+		return nil, fmt.Errorf("loadconfig (%s): %w", *fConfig, err)
 	}
 
 	if *fConfigDirectory != "" {
 		err = c.LoadDirectory(*fConfigDirectory)
 		if err != nil {
-			return fmt.Errorf("loaddir (%s): %w", *fConfigDirectory, err)
+			return nil, fmt.Errorf("loaddir (%s): %w", *fConfigDirectory, err)
 		}
 		log.Printf("I! Completed loading configs from %s", *fConfigDirectory)
 	}
 
 	// mgm: add default plugins and agent plugins
 	if err := c.LoadDefaultPlugins(); err != nil {
-		return fmt.Errorf("loading defaults: %w", err)
-	}
-	// mgm: initialize the internal circonus config.
-	if err := circonus.Initialize(c.GetGlobalCirconusConfig()); err != nil {
-		log.Fatalf("E! unable to initialize circonus %s", err)
-	}
-	if len(c.Tags) > 0 {
-		circonus.AddGlobalTags(c.Tags)
+		return nil, fmt.Errorf("loading defaults: %w", err)
 	}
 
 	if !*fTest && len(c.Outputs) == 0 {
-		return fmt.Errorf("Error: no outputs found, did you provide a valid config file?")
+		return nil, fmt.Errorf("Error: no outputs found, did you provide a valid config file?")
 	}
 	if *fPlugins == "" && len(c.Inputs) == 0 {
-		return fmt.Errorf("Error: no inputs found, did you provide a valid config file?")
+		return nil, fmt.Errorf("Error: no inputs found, did you provide a valid config file?")
 	}
 
 	if int64(c.Agent.Interval.Duration) <= 0 {
-		return fmt.Errorf("Agent interval must be positive, found %s", c.Agent.Interval.Duration)
+		return nil, fmt.Errorf("Agent interval must be positive, found %s", c.Agent.Interval.Duration)
 	}
 
 	if int64(c.Agent.FlushInterval.Duration) <= 0 {
-		return fmt.Errorf("Agent flush_interval must be positive; found %s", c.Agent.Interval.Duration)
+		return nil, fmt.Errorf("Agent flush_interval must be positive; found %s", c.Agent.Interval.Duration)
+	}
+
+	return c, nil
+}
+
+func runAgent(ctx context.Context,
+	inputFilters []string,
+	outputFilters []string,
+) error {
+	log.Printf("I! Starting Circonus Unified Agent %s", version)
+
+	// If no other options are specified, load the config file and run.
+	c, err := loadConfig(inputFilters, outputFilters)
+	if err != nil {
+		return err
+	}
+
+	// mgm: initialize the internal circonus config.
+	if err := circonus.Initialize(c.GetGlobalCirconusConfig()); err != nil {
+		log.Fatalf("E! unable to initialize circonus %s", err)
+	}
+	profiles, err := c.GetCirconusProfiles()
+	if err != nil {
+		log.Fatalf("E! unable to initialize circonus %s", err)
+	}
+	for name, profile := range profiles {
+		if err := circonus.InitializeProfile(name, profile); err != nil {
+			log.Fatalf("E! unable to initialize circonus profile %s: %s", name, err)
+		}
+	}
+	if len(c.Tags) > 0 {
+		circonus.AddGlobalTags(c.Tags)
 	}
 
 	ag, err := agent.NewAgent(c)
@@ -189,6 +327,11 @@ func runAgent(ctx context.Context,
 
 	logger.SetupLogging(logConfig)
 
+	if adminServer != nil {
+		adminServer.SetAgent(ag)
+		defer adminServer.SetAgent(nil)
+	}
+
 	if *fRunOnce {
 		wait := time.Duration(*fTestWait) * time.Second
 		return ag.Once(ctx, wait)
@@ -223,6 +366,17 @@ func runAgent(ctx context.Context,
 		}
 	}
 
+	circonus.ScheduleRetireChecks(pluginInstances(c))
+
+	runningAgentMu.Lock()
+	runningAgent = ag
+	runningAgentMu.Unlock()
+	defer func() {
+		runningAgentMu.Lock()
+		runningAgent = nil
+		runningAgentMu.Unlock()
+	}()
+
 	return ag.Run(ctx)
 }
 
@@ -299,6 +453,16 @@ func main() {
 
 	logger.SetupLogging(logger.LogConfig{})
 
+	if err := config.SetRemoteOptions(config.RemoteOptions{
+		Headers:       fConfigHeaders.headers(),
+		TLSCA:         *fConfigTLSCA,
+		TLSCert:       *fConfigTLSCert,
+		TLSKey:        *fConfigTLSKey,
+		LastKnownGood: *fConfigLastKnownGood,
+	}); err != nil {
+		log.Fatal("E! " + err.Error())
+	}
+
 	// Load external plugins, if requested.
 	if *fPlugins != "" {
 		log.Printf("I! Loading external plugins from: %s", *fPlugins)
@@ -339,6 +503,16 @@ func main() {
 				processorFilters,
 			)
 			return
+		case "check-cache":
+			if err := checkCache(args[1:]); err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			return
+		case "secret-keyfile":
+			if err := secretKeyfile(args[1:]); err != nil {
+				log.Fatal("E! " + err.Error())
+			}
+			return
 		}
 	}
 
@@ -385,6 +559,17 @@ func main() {
 			log.Fatalf("E! %s and %s", err, err2)
 		}
 		return
+	case *fConfigCheck:
+		problems := config.Check(*fConfig, *fConfigDirectory)
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			fmt.Printf("%d configuration problem(s) found\n", len(problems))
+			os.Exit(1)
+		}
+		fmt.Println("configuration ok")
+		return
 	}
 
 	shortVersion := version
@@ -397,6 +582,19 @@ func main() {
 		log.Println("circonus-unified-agent version already configured to: " + internal.Version())
 	}
 
+	if *fAdminAddr != "" {
+		adminHostPort := *fAdminAddr
+		parts := strings.Split(adminHostPort, ":")
+		if len(parts) == 2 && parts[0] == "" {
+			// only listen locally unless a host is explicitly given
+			adminHostPort = fmt.Sprintf("localhost:%s", parts[1])
+		}
+		adminServer = agent.NewAdminServer(adminHostPort)
+		if err := adminServer.Start(); err != nil {
+			log.Fatal("E! " + err.Error())
+		}
+	}
+
 	run(
 		inputFilters,
 		outputFilters,
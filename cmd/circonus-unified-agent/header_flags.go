@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// headerFlags are the repeatable --config-header flags, "Name: value"
+type headerFlags []string
+
+func (h *headerFlags) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headerFlags) Set(value string) error {
+	name, _, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("invalid header %q, expected 'Name: value'", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// headers returns the headers by name
+func (h *headerFlags) headers() map[string]string {
+	headers := make(map[string]string, len(*h))
+	for _, hdr := range *h {
+		name, value, _ := strings.Cut(hdr, ":")
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return headers
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/circonus-labs/circonus-unified-agent/internal/secret"
+)
+
+// secretKeyfilePassphraseEnv is the environment variable with the keyfile's passphrase
+const secretKeyfilePassphraseEnv = "CUA_SECRET_PASSPHRASE"
+
+// secretKeyfile runs the secret-keyfile command on an encrypted keyfile
+// ([[secretstores.keyfile]]), the passphrase is read from CUA_SECRET_PASSPHRASE:
+//
+//	list <file>         keys in the keyfile (not their secrets)
+//	set <file> <key>    set the key's secret, read from stdin, creating the keyfile if needed
+//	remove <file> <key> remove the key
+func secretKeyfile(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("secret-keyfile: command and keyfile required (list, set or remove)")
+	}
+	passphrase := os.Getenv(secretKeyfilePassphraseEnv)
+	if passphrase == "" {
+		return fmt.Errorf("secret-keyfile: %s not set", secretKeyfilePassphraseEnv)
+	}
+	cmd, path := args[0], args[1]
+
+	secrets, err := secret.ReadKeyfile(path, passphrase)
+	if err != nil {
+		return fmt.Errorf("secret-keyfile: %w", err)
+	}
+
+	switch cmd {
+	case "list":
+		keys := make([]string, 0, len(secrets))
+		for k := range secrets {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Println(k)
+		}
+		return nil
+	case "set":
+		if len(args) != 3 {
+			return fmt.Errorf("secret-keyfile: set <file> <key>")
+		}
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("secret-keyfile: reading secret: %w", err)
+		}
+		secrets[args[2]] = strings.TrimRight(string(data), "\r\n")
+	case "remove":
+		if len(args) != 3 {
+			return fmt.Errorf("secret-keyfile: remove <file> <key>")
+		}
+		if _, ok := secrets[args[2]]; !ok {
+			return fmt.Errorf("secret-keyfile: key %q not found", args[2])
+		}
+		delete(secrets, args[2])
+	default:
+		return fmt.Errorf("secret-keyfile: unknown command %q (list, set or remove)", cmd)
+	}
+
+	if err := secret.WriteKeyfile(path, passphrase, secrets); err != nil {
+		return fmt.Errorf("secret-keyfile: %w", err)
+	}
+	return nil
+}
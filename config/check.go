@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal/secret"
+	"github.com/influxdata/toml/ast"
+)
+
+// Problem is a configuration problem found by Check.
+type Problem struct {
+	Err    error
+	File   string
+	Plugin string
+	Line   int
+}
+
+func (p Problem) String() string {
+	pos := p.File
+	if pos == "" {
+		pos = "config"
+	}
+	if p.Line > 0 {
+		pos = fmt.Sprintf("%s:%d", pos, p.Line)
+	}
+	if p.Plugin != "" {
+		return secret.Redact(fmt.Sprintf("%s: %s: %s", pos, p.Plugin, p.Err))
+	}
+	return secret.Redact(fmt.Sprintf("%s: %s", pos, p.Err))
+}
+
+// checker collects problems while a config is loaded in check mode.
+type checker struct {
+	problems []Problem
+	plugins  []checkedPlugin
+}
+
+// checkedPlugin is a plugin loaded in check mode along with where it was defined.
+type checkedPlugin struct {
+	plugin interface{ Init() error }
+	raw    interface{} // the plugin itself, checked with CheckConfig when implemented
+	name   string
+	id     string // instance_id of inputs, used to find duplicates
+	file   string
+	line   int
+}
+
+// Check loads the config file and config directory the same way the agent
+// does, but collects every problem found rather than stopping at the first.
+// Each plugin is initialized (not started), or checked with CheckConfig when it
+// implements cua.ConfigChecker, and inputs sharing an instance_id are reported.
+// Default and agent plugins are not checked.
+func Check(file, dir string) []Problem {
+	c := NewConfig()
+	c.check = &checker{}
+
+	if err := c.LoadConfig(file); err != nil {
+		c.addProblem(file, 0, "", err)
+	}
+	if dir != "" {
+		if err := c.LoadDirectory(dir); err != nil {
+			c.addProblem(dir, 0, "", err)
+		}
+	}
+
+	c.checkInstanceIDs()
+	c.checkInit()
+
+	problems := c.check.problems
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+	return problems
+}
+
+func (c *Config) addProblem(file string, line int, plugin string, err error) {
+	c.check.problems = append(c.check.problems, Problem{
+		File:   file,
+		Line:   line,
+		Plugin: plugin,
+		Err:    err,
+	})
+}
+
+// checkInstanceIDs reports inputs of the same type sharing an instance_id,
+// they would submit to the same check.
+func (c *Config) checkInstanceIDs() {
+	seen := make(map[string]checkedPlugin)
+	for _, p := range c.check.plugins {
+		if p.id == "" {
+			continue
+		}
+		key := p.name + ":" + p.id
+		if first, ok := seen[key]; ok {
+			c.addProblem(p.file, p.line, p.name,
+				fmt.Errorf("duplicate instance_id %q, also used at %s:%d", p.id, first.file, first.line))
+			continue
+		}
+		seen[key] = p
+	}
+}
+
+// checkInit runs the Init of each plugin loaded, plugins whose Init has side
+// effects are checked with CheckConfig instead.
+func (c *Config) checkInit() {
+	for _, p := range c.check.plugins {
+		var err error
+		if cc, ok := p.raw.(cua.ConfigChecker); ok {
+			err = cc.CheckConfig()
+		} else {
+			err = p.plugin.Init()
+		}
+		if err != nil {
+			c.addProblem(p.file, p.line, p.name, err)
+		}
+	}
+}
+
+// addUnusedFields records a problem for each unused field at the line it is
+// defined in tbls, or at line when it isn't found.
+func (c *Config) addUnusedFields(plugin string, line int, tbls ...*ast.Table) {
+	for _, key := range keys(c.UnusedFields) {
+		l := fieldLine(key, tbls...)
+		if l == 0 {
+			l = line
+		}
+		c.addProblem(c.file, l, plugin, fmt.Errorf("configuration specified the field %q, but it wasn't used", key))
+	}
+	c.UnusedFields = map[string]bool{}
+}
+
+// fieldLine returns the line of the field named key in tbls, or in their
+// sub-tables, or 0 if there is none.
+func fieldLine(key string, tbls ...*ast.Table) int {
+	for _, tbl := range tbls {
+		switch v := tbl.Fields[key].(type) {
+		case *ast.KeyValue:
+			return v.Line
+		case *ast.Table:
+			return v.Line
+		case []*ast.Table:
+			if len(v) > 0 {
+				return v[0].Line
+			}
+		}
+	}
+	for _, tbl := range tbls {
+		for _, val := range tbl.Fields {
+			var line int
+			switch v := val.(type) {
+			case *ast.Table:
+				line = fieldLine(key, v)
+			case []*ast.Table:
+				line = fieldLine(key, v...)
+			}
+			if line > 0 {
+				return line
+			}
+		}
+	}
+	return 0
+}
+
+// outputInit runs only the output plugin Init, RunningOutput.Init would also
+// open a disk buffer.
+type outputInit struct {
+	output cua.Output
+}
+
+func (o outputInit) Init() error {
+	if p, ok := o.output.(cua.Initializer); ok {
+		return p.Init() //nolint:wrapcheck
+	}
+	return nil
+}
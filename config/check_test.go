@@ -0,0 +1,47 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs"
+	_ "github.com/circonus-labs/circonus-unified-agent/plugins/inputs/tail"
+	"github.com/stretchr/testify/require"
+)
+
+type checkTestInput struct {
+	Required string `toml:"required"`
+}
+
+func (i *checkTestInput) SampleConfig() string                              { return "" }
+func (i *checkTestInput) Description() string                               { return "" }
+func (i *checkTestInput) Gather(_ context.Context, _ cua.Accumulator) error { return nil }
+func (i *checkTestInput) Init() error {
+	if i.Required == "" {
+		return errors.New("required not set")
+	}
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	inputs.Add("check_test", func() cua.Input { return &checkTestInput{} })
+
+	problems := Check("./testdata/check.toml", "")
+
+	lines := make(map[int]string)
+	for _, p := range problems {
+		require.Equal(t, "./testdata/check.toml", p.File)
+		lines[p.Line] = p.String()
+	}
+	require.Len(t, problems, 6, problems)
+	require.Contains(t, lines[4], `configuration specified the field "not_a_field", but it wasn't used`)
+	require.Contains(t, lines[6], `duplicate instance_id "cache", also used at ./testdata/check.toml:1`)
+	require.Contains(t, lines[10], "inputs.memcached: filter compile")
+	require.Contains(t, lines[14], "inputs.exec: ")
+	require.Contains(t, lines[14], "no_such_format")
+	require.Contains(t, lines[19], "inputs.check_test: init (input check_test): required not set")
+	require.Contains(t, lines[22], "inputs.tail: max_undelivered_lines must be positive")
+	require.NoDirExists(t, "./testdata/check_offsets", "tail created its offsets directory in check mode")
+}
@@ -4,10 +4,11 @@ package config
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -23,6 +24,7 @@ import (
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
 	"github.com/circonus-labs/circonus-unified-agent/internal"
+	"github.com/circonus-labs/circonus-unified-agent/internal/secret"
 	"github.com/circonus-labs/circonus-unified-agent/models"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/aggregators"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs"
@@ -56,8 +58,6 @@ var (
 	)
 
 	defaultPluginsEnabled = true
-	defaultPluginsLoaded  = false
-	agentPluginsLoaded    = false
 )
 
 func init() {
@@ -75,6 +75,15 @@ type Config struct {
 	errs         []error // config load errors
 	UnusedFields map[string]bool
 
+	file    string           // config file being loaded
+	check   *checker         // set when loading in check mode, see Check
+	secrets *secret.Resolver // secret stores, resolves @{store:key} references
+
+	// default and agent plugins explicitly configured, they are not added by LoadDefaultPlugins
+	overriddenPlugins    map[string]bool
+	defaultPluginsLoaded bool
+	agentPluginsLoaded   bool
+
 	Tags          map[string]string
 	InputFilters  []string
 	OutputFilters []string
@@ -93,7 +102,8 @@ type Config struct {
 // once the configuration is parsed.
 func NewConfig() *Config {
 	c := &Config{
-		UnusedFields: map[string]bool{},
+		UnusedFields:      map[string]bool{},
+		overriddenPlugins: map[string]bool{},
 		// Agent defaults:
 		Agent: &AgentConfig{
 			Interval:                   internal.Duration{Duration: 10 * time.Second},
@@ -139,6 +149,10 @@ type AgentConfig struct {
 
 	Circonus CirconusConfig `toml:"circonus"`
 
+	// CirconusProfiles are additional circonus accounts, keyed by profile
+	// name, which outputs and direct metrics inputs can reference.
+	CirconusProfiles map[string]CirconusConfig `toml:"circonus_profiles"`
+
 	// FlushInterval is the Interval at which to flush data
 	FlushInterval internal.Duration
 
@@ -200,10 +214,21 @@ type AgentConfig struct {
 
 	// Debug is the option for running in debug mode
 	Debug bool `toml:"debug"`
+
+	// DataDirectory is where the agent persists plugin state, state is not
+	// persisted when empty.
+	DataDirectory string `toml:"data_directory"`
+
+	// StateSaveInterval is how often plugin state is saved, it is also saved
+	// when the agent stops.
+	StateSaveInterval internal.Duration `toml:"state_save_interval"`
 }
 
 // CirconusConfig configures circonus check management
 // Broker          - optional: broker ID - numeric portion of _cid from broker api object (default is selected: enterprise or public httptrap broker)
+// Brokers         - optional: broker IDs in order of preference, checks are moved to the next healthy broker when submissions fail
+// BrokerWeights   - optional: weights (broker ID = weight) for a weighted random selection of the brokers for new checks
+// BrokerFailureThreshold - optional: consecutive submission failures before a check is moved to another broker (default: 5)
 // APIURL          - optional: api url (default: https://api.circonus.com/v2)
 // APIToken        - REQUIRED: api token
 // APIApp          - optional: api app (default: circonus-unified-agent)
@@ -211,28 +236,41 @@ type AgentConfig struct {
 // CacheConfigs    - optional: cache check bundle configurations - efficient for large number of inputs
 // CacheDir        - optional: where to cache the check bundle configurations - must be read/write for user running cua
 // CacheNoVerify   - optional: don't verify checks loaded from cache, just use them
+// CacheTTL        - optional: age after which cached checks are revalidated with the API (default: 24h, 0 never)
 // DebugAPI        - optional: debug circonus api calls
 // TraceMetrics    - optional: output json sent to broker (path to write files to or `-` for logger)
 // DebugChecks     - optional: use when instructed by circonus support
 // CheckSearchTags - optional: set of tags to use when searching for checks (default: service:circonus-unified-agentd)
 // CheckTags       - optional: set of tags to apply when creating a check
 // CheckTarget     - optional: set the check_target statically (instead of using hostname)
+// CheckMetricFilters - optional: metric filters for checks, [type, rule regex, comment] (default: trapcheck default, allow all)
+// ReconcileChecks - optional: update existing checks (tags, display name, target, metric filters) to match the config
+// ReconcileDryRun - optional: only log the updates reconcile would make
+// RetireChecks    - optional: retire checks of plugin instances removed from the config (log, tag, deactivate)
 type CirconusConfig struct {
-	DebugChecks       map[string]string `toml:"debug_checks"`
-	TraceMetrics      string            `toml:"trace_metrics"`
-	APIURL            string            `toml:"api_url"`
-	APIToken          string            `toml:"api_token"`
-	APIApp            string            `toml:"api_app"`
-	APITLSCA          string            `toml:"api_tls_ca"`
-	CacheDir          string            `toml:"cache_dir"`
-	Broker            string            `toml:"broker"`
-	SubmissionTimeout string            `toml:"submission_timeout"`
-	CheckTarget       string            `toml:"check_target"`
-	CheckSearchTags   []string          `toml:"check_search_tags"`
-	CheckTags         []string          `toml:"check_tags"`
-	DebugAPI          bool              `toml:"debug_api"`
-	CacheNoVerify     bool              `toml:"cache_no_verify"`
-	CacheConfigs      bool              `toml:"cache_configs"`
+	DebugChecks            map[string]string `toml:"debug_checks"`
+	TraceMetrics           string            `toml:"trace_metrics"`
+	APIURL                 string            `toml:"api_url"`
+	APIToken               string            `toml:"api_token"`
+	APIApp                 string            `toml:"api_app"`
+	APITLSCA               string            `toml:"api_tls_ca"`
+	CacheDir               string            `toml:"cache_dir"`
+	Broker                 string            `toml:"broker"`
+	Brokers                []string          `toml:"brokers"`
+	BrokerWeights          map[string]int    `toml:"broker_weights"`
+	BrokerFailureThreshold int               `toml:"broker_failure_threshold"`
+	SubmissionTimeout      string            `toml:"submission_timeout"`
+	CacheTTL               string            `toml:"cache_ttl"`
+	CheckTarget            string            `toml:"check_target"`
+	CheckSearchTags        []string          `toml:"check_search_tags"`
+	CheckTags              []string          `toml:"check_tags"`
+	CheckMetricFilters     [][]string        `toml:"check_metric_filters"`
+	RetireChecks           string            `toml:"retire_checks"`
+	DebugAPI               bool              `toml:"debug_api"`
+	ReconcileChecks        bool              `toml:"reconcile_checks"`
+	ReconcileDryRun        bool              `toml:"reconcile_dry_run"`
+	CacheNoVerify          bool              `toml:"cache_no_verify"`
+	CacheConfigs           bool              `toml:"cache_configs"`
 }
 
 // InputNames returns a list of strings of the configured inputs.
@@ -404,6 +442,13 @@ var agentConfig = `
   ## If set to -1, no archives are removed.
   # logfile_rotation_max_archives = 5
 
+  ## Directory where the state of plugins (e.g. tail offsets) is saved so it
+  ## survives restarts. Must be writeable by the user running the agent. When
+  ## empty no state is saved.
+  # data_directory = "/opt/circonus/unified-agent/data"
+  ## How often plugin state is saved, it is also saved when the agent stops.
+  # state_save_interval = "60s"
+
   [agent.circonus]
     ## Circonus API token must be provided to use this plugin
     ## REQUIRED
@@ -426,6 +471,15 @@ var agentConfig = `
     ## Optional
     ## Explicit broker id or blank (default blank, auto select)
     # broker = "/broker/35"
+    ##
+    ## Brokers
+    ## Optional
+    ## Brokers in order of preference, supersedes broker. New checks use the first healthy
+    ## broker (or a weighted random choice with broker_weights), a check is moved to another
+    ## healthy broker after broker_failure_threshold consecutive failed submissions
+    # brokers = [ "/broker/35", "/broker/36" ]
+    # broker_weights = { "/broker/35" = 3, "/broker/36" = 1 }
+    # broker_failure_threshold = 5
 
     ## Cache check configurations
     ## Optional
@@ -436,6 +490,11 @@ var agentConfig = `
     ## Optional (required if cache_configs is true)
     ## Note: cache_dir must be read/write for the user running the cua process
     # cache_dir = "/opt/circonus/etc/cache.d"
+    ##
+    ## Cache TTL
+    ## Optional: cached checks older than this are revalidated with the API,
+    ## in the background, "0" never revalidates
+    # cache_ttl = "24h"
 
     ## Check tags configurations
     ## Optional
@@ -443,6 +502,25 @@ var agentConfig = `
     ## eg: [ "team:red", "team:blue", "env:dev", "security:pci", "security:sox" ]
     # check_tags = [ "foo:bar", "baz:buzz" ]
 
+    ## Check metric filters
+    ## Optional
+    ## [type, rule regex, comment] filters applied when checks are created (default allow all)
+    # check_metric_filters = [ ["allow", "^.+$", "all metrics"] ]
+
+    ## Reconcile checks
+    ## Optional
+    ## update existing checks (tags, display name, target and check_metric_filters)
+    ## to match the config on startup and reload, reconcile_dry_run only logs the updates
+    # reconcile_checks = false
+    # reconcile_dry_run = false
+
+    ## Retire checks
+    ## Optional
+    ## checks created for plugin instances no longer in the config, found by check_target,
+    ## are tagged _retired:<date> ("tag") or also disabled ("deactivate") a few minutes
+    ## after startup and reload, "log" only logs them
+    # retire_checks = ""
+
     ## Debug circonus api calls and trap submissions
     ## Optional 
     # debug_api = true
@@ -452,6 +530,18 @@ var agentConfig = `
     ## Note: directory to write metrics sent to broker (must be writeable by user running cua process)
     ##       output json sent to broker (path to write files to or '-' for logger)
     # trace_metrics = "/opt/circonus/trace.d"
+
+  ## Circonus profiles
+  ## Optional
+  ## Additional circonus accounts, the circonus output and direct metrics
+  ## inputs select one with circonus_profile = "<name>". A profile takes the
+  ## same settings as agent.circonus, check_target, check_tags,
+  ## check_search_tags and submission_timeout default to the agent.circonus
+  ## settings. With cache_configs and no cache_dir checks are cached in a
+  ## sub directory, named after the profile, of the agent.circonus cache_dir.
+  # [agent.circonus_profiles.tenant_a]
+  #   api_token = ""
+  #   api_url = "https://api.circonus.com/"
 `
 
 var outputHeader = `
@@ -816,11 +906,19 @@ func (c *Config) LoadConfig(path string) error {
 		}
 	}
 	data, err := loadConfig(path)
-	if err != nil {
-		return fmt.Errorf("Error loading config file %s: %w", path, err)
+	if err == nil {
+		c.file = path
+		err = c.LoadConfigData(data)
+		if err == nil && c.check == nil && isRemoteConfig(path) {
+			remoteConfigLoaded(path, data)
+		}
 	}
-
-	if err = c.LoadConfigData(data); err != nil {
+	if err != nil {
+		if c.check != nil {
+			// keep checking the remaining files
+			c.addProblem(path, 0, "", err)
+			return nil
+		}
 		return fmt.Errorf("Error loading config file %s: %w", path, err)
 	}
 	return nil
@@ -833,6 +931,21 @@ func (c *Config) LoadConfigData(data []byte) error {
 		return fmt.Errorf("error parsing data: %w", err)
 	}
 
+	// Secret stores first, their secrets can be referenced anywhere in the config
+	if val, ok := tbl.Fields["secretstores"]; ok {
+		subTable, ok := val.(*ast.Table)
+		if !ok {
+			return fmt.Errorf("invalid configuration, error parsing secretstores table")
+		}
+		if err = c.addSecretStores(subTable); err != nil {
+			return err
+		}
+		delete(tbl.Fields, "secretstores")
+	}
+	if err = c.resolveSecrets(tbl); err != nil {
+		return fmt.Errorf("resolving secrets: %w", err)
+	}
+
 	// Parse tags tables first:
 	for _, tableName := range []string{"tags", "global_tags"} {
 		if val, ok := tbl.Fields[tableName]; ok {
@@ -881,7 +994,16 @@ func (c *Config) LoadConfigData(data []byte) error {
 	// }
 
 	if len(c.UnusedFields) > 0 {
-		return fmt.Errorf("line %d: configuration specified the fields %q, but they weren't used", tbl.Line, keys(c.UnusedFields))
+		if c.check == nil {
+			return fmt.Errorf("line %d: configuration specified the fields %q, but they weren't used", tbl.Line, keys(c.UnusedFields))
+		}
+		var tables []*ast.Table
+		for _, name := range []string{"tags", "global_tags", "agent"} {
+			if subTable, ok := tbl.Fields[name].(*ast.Table); ok {
+				tables = append(tables, subTable)
+			}
+		}
+		c.addUnusedFields("", 0, tables...)
 	}
 
 	// Parse all the rest of the plugins:
@@ -898,12 +1020,12 @@ func (c *Config) LoadConfigData(data []byte) error {
 				switch pluginSubTable := pluginVal.(type) {
 				// legacy [outputs.circonus] support
 				case *ast.Table:
-					if err = c.addOutput(pluginName, pluginSubTable); err != nil {
+					if err = c.addPlugin("outputs", pluginName, pluginSubTable, c.addOutput); err != nil {
 						return fmt.Errorf("error parsing %s, %w", pluginName, err)
 					}
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
-						if err = c.addOutput(pluginName, t); err != nil {
+						if err = c.addPlugin("outputs", pluginName, t, c.addOutput); err != nil {
 							return fmt.Errorf("error parsing %s array, %w", pluginName, err)
 						}
 					}
@@ -925,12 +1047,12 @@ func (c *Config) LoadConfigData(data []byte) error {
 				switch pluginSubTable := pluginVal.(type) {
 				// legacy [inputs.cpu] support
 				case *ast.Table:
-					if err = c.addInput(pluginName, pluginSubTable); err != nil {
+					if err = c.addPlugin("inputs", pluginName, pluginSubTable, c.addInput); err != nil {
 						return fmt.Errorf("error parsing %s, %w", pluginName, err)
 					}
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
-						if err = c.addInput(pluginName, t); err != nil {
+						if err = c.addPlugin("inputs", pluginName, t, c.addInput); err != nil {
 							return fmt.Errorf("error parsing %s: %w", pluginName, err)
 						}
 					}
@@ -946,7 +1068,7 @@ func (c *Config) LoadConfigData(data []byte) error {
 				switch pluginSubTable := pluginVal.(type) {
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
-						if err = c.addProcessor(pluginName, t); err != nil {
+						if err = c.addPlugin("processors", pluginName, t, c.addProcessor); err != nil {
 							return fmt.Errorf("error parsing %s: %w", pluginName, err)
 						}
 					}
@@ -962,7 +1084,7 @@ func (c *Config) LoadConfigData(data []byte) error {
 				switch pluginSubTable := pluginVal.(type) {
 				case []*ast.Table:
 					for _, t := range pluginSubTable {
-						if err = c.addAggregator(pluginName, t); err != nil {
+						if err = c.addPlugin("aggregators", pluginName, t, c.addAggregator); err != nil {
 							return fmt.Errorf("error parsing %s: %w", pluginName, err)
 						}
 					}
@@ -976,7 +1098,7 @@ func (c *Config) LoadConfigData(data []byte) error {
 		// Assume it's an input input for legacy config file support if no other
 		// identifiers are present
 		default:
-			if err = c.addInput(name, subTable); err != nil {
+			if err = c.addPlugin("inputs", name, subTable, c.addInput); err != nil {
 				return fmt.Errorf("error parsing %s: %w", name, err)
 			}
 		}
@@ -1025,30 +1147,6 @@ func loadConfig(config string) ([]byte, error) {
 
 }
 
-func fetchConfig(u fmt.Stringer) ([]byte, error) {
-	req, err := http.NewRequest("GET", u.String(), nil)
-	if err != nil {
-		return nil, fmt.Errorf("http new req (%s): %w", u.String(), err)
-	}
-
-	if v, exists := os.LookupEnv("INFLUX_TOKEN"); exists {
-		req.Header.Add("Authorization", "Token "+v)
-	}
-	req.Header.Add("Accept", "application/toml")
-	req.Header.Set("User-Agent", internal.ProductToken())
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("http do: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to retrieve remote config: %s", resp.Status)
-	}
-
-	defer resp.Body.Close()
-	return io.ReadAll(resp.Body) //nolint:wrapcheck
-}
-
 // parseConfig loads a TOML configuration from a provided path and
 // returns the AST produced from the TOML parser. When loading the file, it
 // will find environment variables and replace them.
@@ -1081,6 +1179,82 @@ func parseConfig(contents []byte) (*ast.Table, error) {
 	return toml.Parse(contents) //nolint:wrapcheck
 }
 
+// tableHash returns a digest of a plugin table's settings, it is used to detect
+// which plugins changed between config loads. It must be called before the table
+// is passed to the build functions, they delete the fields they consume.
+func tableHash(tbl *ast.Table) string {
+	h := sha256.New()
+	writeTableHash(h, tbl)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeTableHash(w io.Writer, tbl *ast.Table) {
+	names := make([]string, 0, len(tbl.Fields))
+	for name := range tbl.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	_, _ = io.WriteString(w, "{")
+	for _, name := range names {
+		_, _ = io.WriteString(w, strconv.Quote(name)+"=")
+		switch v := tbl.Fields[name].(type) {
+		case *ast.KeyValue:
+			_, _ = io.WriteString(w, v.Value.Source())
+		case *ast.Table:
+			writeTableHash(w, v)
+		case []*ast.Table:
+			_, _ = io.WriteString(w, "[")
+			for _, t := range v {
+				writeTableHash(w, t)
+			}
+			_, _ = io.WriteString(w, "]")
+		}
+		_, _ = io.WriteString(w, ";")
+	}
+	_, _ = io.WriteString(w, "}")
+}
+
+// addPlugin adds the plugin defined by table using add. In check mode problems
+// are recorded rather than returned, so loading continues with the next plugin.
+func (c *Config) addPlugin(kind, name string, table *ast.Table, add func(string, *ast.Table) error) error {
+	if c.check == nil {
+		return add(name, table)
+	}
+
+	plugin := kind + "." + name
+	ni, no, np, na := len(c.Inputs), len(c.Outputs), len(c.Processors), len(c.Aggregators)
+	if err := add(name, table); err != nil {
+		c.addProblem(c.file, table.Line, plugin, err)
+	}
+	if len(c.UnusedFields) > 0 {
+		c.addUnusedFields(plugin, table.Line, table)
+	}
+	c.errs = nil
+
+	loaded := checkedPlugin{name: plugin, file: c.file, line: table.Line}
+	for _, ri := range c.Inputs[ni:] {
+		loaded.plugin, loaded.raw, loaded.id = ri, ri.Input, ri.Config.InstanceID
+		c.check.plugins = append(c.check.plugins, loaded)
+	}
+	for _, ro := range c.Outputs[no:] {
+		loaded.plugin, loaded.raw = outputInit{output: ro.Output}, ro.Output
+		c.check.plugins = append(c.check.plugins, loaded)
+	}
+	for _, rp := range c.Processors[np:] {
+		loaded.plugin, loaded.raw = rp, rp.Processor
+		if sp, ok := rp.Processor.(interface{ Unwrap() cua.Processor }); ok {
+			loaded.raw = sp.Unwrap()
+		}
+		c.check.plugins = append(c.check.plugins, loaded)
+	}
+	for _, ra := range c.Aggregators[na:] {
+		loaded.plugin, loaded.raw = ra, ra.Aggregator
+		c.check.plugins = append(c.check.plugins, loaded)
+	}
+	return nil
+}
+
 func (c *Config) addAggregator(name string, table *ast.Table) error {
 	creator, ok := aggregators.Aggregators[name]
 	if !ok {
@@ -1088,10 +1262,12 @@ func (c *Config) addAggregator(name string, table *ast.Table) error {
 	}
 	aggregator := creator()
 
+	hash := tableHash(table)
 	conf, err := c.buildAggregator(name, table)
 	if err != nil {
 		return err
 	}
+	conf.Hash = hash
 
 	if err := c.toml.UnmarshalTable(table, aggregator); err != nil {
 		return fmt.Errorf("toml unmarshaltable: %w", err)
@@ -1107,10 +1283,12 @@ func (c *Config) addProcessor(name string, table *ast.Table) error {
 		return fmt.Errorf("undefined but requested processor: %s", name)
 	}
 
+	hash := tableHash(table)
 	processorConfig, err := c.buildProcessor(name, table)
 	if err != nil {
 		return err
 	}
+	processorConfig.Hash = hash
 
 	rf, err := c.newRunningProcessor(creator, processorConfig, name, table)
 	if err != nil {
@@ -1159,6 +1337,7 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 		return fmt.Errorf("undefined but requested output: %s", name)
 	}
 	output := creator()
+	hash := tableHash(table)
 
 	// If the output has a SetSerializer function, then this means it can write
 	// arbitrary types of output, so build the serializer and set it.
@@ -1176,6 +1355,15 @@ func (c *Config) addOutput(name string, table *ast.Table) error {
 	if err != nil {
 		return err
 	}
+	outputConfig.Hash = hash
+
+	if dir := outputConfig.DiskBufferDirectory(); dir != "" {
+		for _, ro := range c.Outputs {
+			if filepath.Clean(ro.Config.DiskBufferDirectory()) == filepath.Clean(dir) {
+				return fmt.Errorf("disk buffer directory %s is already used by output %s, set a unique alias", dir, ro.LogName())
+			}
+		}
+	}
 
 	if err := c.toml.UnmarshalTable(table, output); err != nil {
 		return fmt.Errorf("toml unmarshaltable: %w", err)
@@ -1207,6 +1395,7 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 		return fmt.Errorf("Undefined but requested input: %s", name)
 	}
 	input := creator()
+	hash := tableHash(table)
 
 	// If the input has a SetParser function, then this means it can accept
 	// arbitrary types of input, so build the parser and set it.
@@ -1223,6 +1412,12 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 		if err != nil {
 			return err
 		}
+		if c.check != nil {
+			// parsers are created when the input starts, validate the options now
+			if _, err := parsers.NewParser(config); err != nil {
+				return fmt.Errorf("parser: %w", err)
+			}
+		}
 		t.SetParserFunc(func() (parsers.Parser, error) {
 			return parsers.NewParser(config) //nolint:wrapcheck
 		})
@@ -1232,6 +1427,7 @@ func (c *Config) addInput(name string, table *ast.Table) error {
 	if err != nil {
 		return err
 	}
+	pluginConfig.Hash = hash
 
 	if err := c.toml.UnmarshalTable(table, input); err != nil {
 		return fmt.Errorf("toml unmarshaltable: %w", err)
@@ -1613,11 +1809,24 @@ func (c *Config) buildOutput(name string, tbl *ast.Table) (*models.OutputConfig,
 
 	c.getFieldInt(tbl, "metric_buffer_limit", &oc.MetricBufferLimit)
 	c.getFieldInt(tbl, "metric_batch_size", &oc.MetricBatchSize)
+	c.getFieldString(tbl, "buffer_type", &oc.BufferType)
+	c.getFieldString(tbl, "buffer_directory", &oc.BufferDirectory)
+	c.getFieldInt64(tbl, "buffer_max_size", &oc.BufferMaxSize)
 	c.getFieldString(tbl, "alias", &oc.Alias)
 	c.getFieldString(tbl, "name_override", &oc.NameOverride)
 	c.getFieldString(tbl, "name_suffix", &oc.NameSuffix)
 	c.getFieldString(tbl, "name_prefix", &oc.NamePrefix)
 
+	switch oc.BufferType {
+	case "", models.BufferTypeMemory:
+	case models.BufferTypeDisk:
+		if oc.BufferDirectory == "" {
+			c.addError(tbl, fmt.Errorf("buffer_directory is required when buffer_type is %q", oc.BufferType))
+		}
+	default:
+		c.addError(tbl, fmt.Errorf("invalid buffer_type %q, expecting %q or %q", oc.BufferType, models.BufferTypeMemory, models.BufferTypeDisk))
+	}
+
 	if c.hasErrs() {
 		return nil, c.firstErr()
 	}
@@ -1645,6 +1854,7 @@ func (c *Config) missingTomlField(typ reflect.Type, key string) error {
 		"prefix", "prometheus_export_timestamp", "prometheus_sort_metrics", "prometheus_string_as_label",
 		"separator", "splunkmetric_hec_routing", "splunkmetric_multimetric", "tag_keys",
 		"tagdrop", "tagexclude", "taginclude", "tagpass", "tags", "template", "templates",
+		"buffer_type", "buffer_directory", "buffer_max_size",
 		"wavefront_source_override", "wavefront_use_strict", "check_tags", "check_target", "check_display_name":
 
 		// ignore fields that are common to all plugins.
@@ -1996,9 +2206,8 @@ func (c *Config) disableDefaultPlugin(name string) {
 
 	defaultPluginListMU.Lock()
 	defer defaultPluginListMU.Unlock()
-	if cfg, ok := (*plugList)[name]; ok {
-		cfg.Enabled = false
-		(*plugList)[name] = cfg
+	if _, ok := (*plugList)[name]; ok {
+		c.overriddenPlugins[name] = true
 	}
 }
 
@@ -2006,7 +2215,7 @@ func (c *Config) addDefaultPlugins() error {
 	if !defaultPluginsEnabled {
 		return nil
 	}
-	if defaultPluginsLoaded {
+	if c.defaultPluginsLoaded {
 		return nil
 	}
 	plugList := getDefaultPluginList()
@@ -2018,8 +2227,8 @@ func (c *Config) addDefaultPlugins() error {
 	defaultPluginListMU.Lock()
 	defer defaultPluginListMU.Unlock()
 	for pluginName, pluginConfig := range *plugList {
-		if !pluginConfig.Enabled {
-			continue // user override in configuration
+		if !pluginConfig.Enabled || c.overriddenPlugins[pluginName] {
+			continue // not supported on os, or user override in configuration
 		}
 		tbl, err := parseConfig(pluginConfig.Data)
 		if err != nil {
@@ -2030,7 +2239,7 @@ func (c *Config) addDefaultPlugins() error {
 		}
 	}
 
-	defaultPluginsLoaded = true
+	c.defaultPluginsLoaded = true
 
 	return nil
 }
@@ -2077,9 +2286,8 @@ func (c *Config) disableAgentPlugin(name string) {
 		return
 	}
 
-	if cfg, ok := (*plugList)[name]; ok {
-		cfg.Enabled = false
-		(*plugList)[name] = cfg
+	if _, ok := (*plugList)[name]; ok {
+		c.overriddenPlugins[name] = true
 	}
 }
 
@@ -2088,12 +2296,12 @@ func (c *Config) addAgentPlugins() error {
 	if plugList == nil {
 		return fmt.Errorf("no agent plugin list available for GOOS %s", runtime.GOOS)
 	}
-	if agentPluginsLoaded {
+	if c.agentPluginsLoaded {
 		return nil
 	}
 
 	for pluginName, pluginConfig := range *plugList {
-		if !pluginConfig.Enabled {
+		if !pluginConfig.Enabled || c.overriddenPlugins[pluginName] {
 			continue // user override in configuration
 		}
 		tbl, err := parseConfig(pluginConfig.Data)
@@ -2105,7 +2313,7 @@ func (c *Config) addAgentPlugins() error {
 		}
 	}
 
-	agentPluginsLoaded = true
+	c.agentPluginsLoaded = true
 
 	return nil
 }
@@ -2128,3 +2336,36 @@ func (c *Config) GetGlobalCirconusConfig() *CirconusConfig {
 	}
 	return &c.Agent.Circonus
 }
+
+// GetCirconusProfiles returns the circonus profiles, keyed by name, with the
+// settings not specific to an account defaulted from agent.circonus.
+func (c *Config) GetCirconusProfiles() (map[string]*CirconusConfig, error) {
+	profiles := make(map[string]*CirconusConfig, len(c.Agent.CirconusProfiles))
+	for name, profile := range c.Agent.CirconusProfiles {
+		if name == "" {
+			return nil, fmt.Errorf("circonus profile: invalid name (empty)")
+		}
+		profile := profile
+		if profile.CheckTarget == "" {
+			profile.CheckTarget = c.Agent.Circonus.CheckTarget
+		}
+		if len(profile.CheckTags) == 0 {
+			profile.CheckTags = c.Agent.Circonus.CheckTags
+		}
+		if len(profile.CheckSearchTags) == 0 {
+			profile.CheckSearchTags = c.Agent.Circonus.CheckSearchTags
+		}
+		if profile.SubmissionTimeout == "" {
+			profile.SubmissionTimeout = c.Agent.Circonus.SubmissionTimeout
+		}
+		if profile.CacheTTL == "" {
+			profile.CacheTTL = c.Agent.Circonus.CacheTTL
+		}
+		if profile.CacheConfigs && profile.CacheDir == "" && c.Agent.Circonus.CacheDir != "" {
+			// checks in different accounts must not share cache entries
+			profile.CacheDir = filepath.Join(c.Agent.Circonus.CacheDir, name)
+		}
+		profiles[name] = &profile
+	}
+	return profiles, nil
+}
@@ -13,6 +13,7 @@ import (
 	httplistenerv2 "github.com/circonus-labs/circonus-unified-agent/plugins/inputs/http_listener_v2"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs/memcached"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs/procstat"
+	_ "github.com/circonus-labs/circonus-unified-agent/plugins/outputs/discard"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/parsers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -283,3 +284,61 @@ func TestConfig_NonASCIIHostName(t *testing.T) {
 	require.Error(t, err, "invalid field name")
 	assert.Equal(t, "Error loading config file ./testdata/non-ascii-hostname.toml: hostname must contain only ASCII characters, øøø is invalid. You can set the hostname in the CUA config in the [agent] section", err.Error())
 }
+
+func TestConfig_PluginHash(t *testing.T) {
+	load := func(data string) *models.RunningInput {
+		t.Helper()
+		c := NewConfig()
+		require.NoError(t, c.LoadConfigData([]byte(data)))
+		require.Len(t, c.Inputs, 1)
+		return c.Inputs[0]
+	}
+
+	a := load(`
+[[inputs.memcached]]
+  instance_id = "mc"
+  servers = ["localhost"]
+  [inputs.memcached.tags]
+    env = "prod"
+`)
+	b := load(`
+[[inputs.memcached]]
+  servers = ["localhost"]
+  instance_id = "mc"
+  [inputs.memcached.tags]
+    env = "prod"
+`)
+	c := load(`
+[[inputs.memcached]]
+  instance_id = "mc"
+  servers = ["localhost"]
+  [inputs.memcached.tags]
+    env = "dev"
+`)
+
+	require.NotEmpty(t, a.Config.Hash)
+	require.Equal(t, a.Config.Hash, b.Config.Hash)
+	require.NotEqual(t, a.Config.Hash, c.Config.Hash)
+}
+
+func TestConfig_DiskBufferDirectory(t *testing.T) {
+	load := func(alias string) error {
+		t.Helper()
+		c := NewConfig()
+		return c.LoadConfigData([]byte(strings.NewReplacer("$DIR", t.TempDir(), "$ALIAS", alias).Replace(`
+[[outputs.discard]]
+  buffer_type = "disk"
+  buffer_directory = "$DIR"
+[[outputs.discard]]
+  alias = "$ALIAS"
+  buffer_type = "disk"
+  buffer_directory = "$DIR"
+`)))
+	}
+
+	err := load("")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "already used by output")
+
+	require.NoError(t, load("second"))
+}
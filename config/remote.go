@@ -0,0 +1,322 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/internal"
+	"github.com/circonus-labs/circonus-unified-agent/internal/secret"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/tls"
+)
+
+const defaultRemoteTimeout = 30 * time.Second
+
+// headerEnvRe matches the ${VAR} environment variable references in header values
+var headerEnvRe = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// RemoteOptions configures how remote (http/https) config files are fetched.
+type RemoteOptions struct {
+	// Headers are added to each request (e.g. Authorization), ${VAR} in a value
+	// is replaced with the environment variable
+	Headers map[string]string
+	// TLSCA, TLSCert and TLSKey verify the server with a custom CA and
+	// authenticate with a client certificate
+	TLSCA   string
+	TLSCert string
+	TLSKey  string
+	// LastKnownGood is a local copy of the last remote config which loaded
+	// successfully, it is used when the server can't be reached at startup
+	LastKnownGood string
+	// Timeout of each request, default 30s
+	Timeout time.Duration
+}
+
+// remoteState is what is known about a remote config, the validators are sent
+// with polls so an unchanged config is not downloaded again.
+type remoteState struct {
+	etag         string
+	lastModified string
+	digest       [sha256.Size]byte
+	loaded       bool // a config from the server has been loaded
+}
+
+var (
+	remoteOpts   RemoteOptions
+	remoteHeader = make(http.Header)
+	remoteClient = &http.Client{Timeout: defaultRemoteTimeout}
+	remoteStates = make(map[string]*remoteState)
+	remotemu     sync.Mutex
+)
+
+// SetRemoteOptions configures fetching remote config files, it is called before
+// the config is loaded.
+func SetRemoteOptions(opts RemoteOptions) error {
+	header := make(http.Header, len(opts.Headers))
+	for name, value := range opts.Headers {
+		value = headerEnvRe.ReplaceAllStringFunc(value, func(ref string) string {
+			return os.Getenv(headerEnvRe.FindStringSubmatch(ref)[1])
+		})
+		secret.Register(value)
+		header.Set(name, value)
+	}
+
+	tc := tls.ClientConfig{TLSCA: opts.TLSCA, TLSCert: opts.TLSCert, TLSKey: opts.TLSKey}
+	tlsConfig, err := tc.TLSConfig()
+	if err != nil {
+		return fmt.Errorf("remote config tls: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if tlsConfig != nil {
+		transport.TLSClientConfig = tlsConfig
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultRemoteTimeout
+	}
+
+	remotemu.Lock()
+	defer remotemu.Unlock()
+	remoteOpts = opts
+	remoteHeader = header
+	remoteClient = &http.Client{Timeout: timeout, Transport: transport}
+	return nil
+}
+
+func getRemoteState(u string) *remoteState {
+	st, ok := remoteStates[u]
+	if !ok {
+		st = &remoteState{}
+		remoteStates[u] = st
+	}
+	return st
+}
+
+// newRemoteRequest returns a request for the config with the configured headers.
+func newRemoteRequest(ctx context.Context, u string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http new req (%s): %w", u, err)
+	}
+	remotemu.Lock()
+	for name, values := range remoteHeader {
+		req.Header[name] = values
+	}
+	remotemu.Unlock()
+	if req.Header.Get("Authorization") == "" {
+		// inherited from telegraf, kept for existing deployments
+		if v, exists := os.LookupEnv("INFLUX_TOKEN"); exists {
+			req.Header.Add("Authorization", "Token "+v)
+		}
+	}
+	req.Header.Add("Accept", "application/toml")
+	req.Header.Set("User-Agent", internal.ProductToken())
+	return req, nil
+}
+
+func getRemoteClient() *http.Client {
+	remotemu.Lock()
+	defer remotemu.Unlock()
+	return remoteClient
+}
+
+// fetchConfig downloads a remote config. If it can't be, and a config from the
+// server has not been loaded yet (startup), the last known good copy is used.
+func fetchConfig(u fmt.Stringer) ([]byte, error) {
+	data, err := fetchRemoteConfig(u.String())
+	if err == nil {
+		return data, nil
+	}
+
+	remotemu.Lock()
+	lkg := remoteOpts.LastKnownGood
+	loaded := getRemoteState(u.String()).loaded
+	remotemu.Unlock()
+	if lkg == "" || loaded {
+		return nil, err
+	}
+	data, lerr := os.ReadFile(lkg)
+	if lerr != nil {
+		if os.IsNotExist(lerr) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w (last known good config: %s)", err, lerr)
+	}
+	log.Printf("W! [agent] unable to fetch remote config, using last known good config %s: %s", lkg, err)
+	return data, nil
+}
+
+func fetchRemoteConfig(u string) ([]byte, error) {
+	req, err := newRemoteRequest(context.Background(), u)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := getRemoteClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to retrieve remote config: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading remote config: %w", err)
+	}
+
+	remotemu.Lock()
+	st := getRemoteState(u)
+	st.etag = resp.Header.Get("ETag")
+	st.lastModified = resp.Header.Get("Last-Modified")
+	st.digest = sha256.Sum256(data)
+	remotemu.Unlock()
+
+	return data, nil
+}
+
+// remoteConfigLoaded records that a remote config loaded successfully, it is
+// saved as the last known good copy.
+func remoteConfigLoaded(u string, data []byte) {
+	remotemu.Lock()
+	st := getRemoteState(u)
+	fromServer := st.digest == sha256.Sum256(data)
+	if fromServer {
+		st.loaded = true
+	}
+	lkg := remoteOpts.LastKnownGood
+	remotemu.Unlock()
+
+	if lkg == "" || !fromServer {
+		return
+	}
+	if err := writeLastKnownGood(lkg, data); err != nil {
+		log.Printf("W! [agent] saving last known good config: %s", err)
+	}
+}
+
+// writeLastKnownGood replaces the last known good copy, the new copy is
+// renamed into place so a partially written copy is never used.
+func writeLastKnownGood(path string, data []byte) error {
+	if current, err := os.ReadFile(path); err == nil && sha256.Sum256(current) == sha256.Sum256(data) {
+		return nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("writing %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("closing %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("renaming %s: %w", tmp.Name(), err)
+	}
+	return nil
+}
+
+// pollRemoteConfig checks whether a remote config has changed since it was last
+// fetched, using the ETag and Last-Modified validators when the server sends them
+// and the content's digest otherwise.
+func pollRemoteConfig(ctx context.Context, u string) (bool, error) {
+	req, err := newRemoteRequest(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	remotemu.Lock()
+	st := getRemoteState(u)
+	if st.etag != "" {
+		req.Header.Set("If-None-Match", st.etag)
+	}
+	if st.lastModified != "" {
+		req.Header.Set("If-Modified-Since", st.lastModified)
+	}
+	remotemu.Unlock()
+
+	resp, err := getRemoteClient().Do(req)
+	if err != nil {
+		return false, fmt.Errorf("http do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return false, nil
+	case http.StatusOK:
+	default:
+		return false, fmt.Errorf("polling remote config: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("reading remote config: %w", err)
+	}
+
+	remotemu.Lock()
+	defer remotemu.Unlock()
+	digest := sha256.Sum256(data)
+	// the change is reported once, a config which fails to load is not retried every poll
+	changed := digest != st.digest
+	st.etag = resp.Header.Get("ETag")
+	st.lastModified = resp.Header.Get("Last-Modified")
+	st.digest = digest
+	return changed, nil
+}
+
+// RemoteWatcher polls a remote config for changes.
+type RemoteWatcher struct {
+	url      string
+	interval time.Duration
+}
+
+// NewRemoteWatcher returns a watcher polling the remote config at url every interval.
+func NewRemoteWatcher(url string, interval time.Duration) (*RemoteWatcher, error) {
+	if !isRemoteConfig(url) {
+		return nil, fmt.Errorf("remote config watcher: %s is not an http or https url", url)
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("remote config watcher: invalid poll interval %s", interval)
+	}
+	return &RemoteWatcher{url: url, interval: interval}, nil
+}
+
+// Run sends on changed when the remote config has changed. It returns when the
+// context is done.
+func (w *RemoteWatcher) Run(ctx context.Context, changed chan<- struct{}) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			updated, err := pollRemoteConfig(ctx, w.url)
+			if err != nil {
+				log.Printf("W! [agent] remote config watcher: %s", err)
+				continue
+			}
+			if !updated {
+				continue
+			}
+			log.Printf("D! [agent] remote config change detected: %s", w.url)
+			select {
+			case changed <- struct{}{}:
+			default: // a reload is already pending
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteConfig(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		body   = "[agent]\n  interval = \"10s\"\n"
+		etag   = `"v1"`
+		header string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		header = r.Header.Get("Authorization")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	lkg := filepath.Join(t.TempDir(), "remote.conf.last")
+	t.Setenv("REMOTE_CONFIG_TOKEN", "remote-token")
+	require.NoError(t, SetRemoteOptions(RemoteOptions{
+		Headers:       map[string]string{"Authorization": "Bearer ${REMOTE_CONFIG_TOKEN}"},
+		LastKnownGood: lkg,
+	}))
+	defer func() { require.NoError(t, SetRemoteOptions(RemoteOptions{})) }()
+
+	c := NewConfig()
+	require.NoError(t, c.LoadConfig(srv.URL))
+	require.Equal(t, "Bearer remote-token", header)
+	saved, err := os.ReadFile(lkg)
+	require.NoError(t, err)
+	require.Equal(t, body, string(saved))
+
+	// unchanged, the server answers 304
+	changed, err := pollRemoteConfig(context.Background(), srv.URL)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	mu.Lock()
+	body = "[agent]\n  interval = \"20s\"\n"
+	etag = `"v2"`
+	mu.Unlock()
+	changed, err = pollRemoteConfig(context.Background(), srv.URL)
+	require.NoError(t, err)
+	require.True(t, changed)
+	// the change is reported once
+	changed, err = pollRemoteConfig(context.Background(), srv.URL)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// once a config has been loaded an unreachable server is an error, the running config is kept
+	srv.Close()
+	_, err = loadConfig(srv.URL)
+	require.Error(t, err)
+
+	// at startup the last known good copy is used
+	remotemu.Lock()
+	delete(remoteStates, srv.URL)
+	remotemu.Unlock()
+	c = NewConfig()
+	require.NoError(t, c.LoadConfig(srv.URL))
+	require.Equal(t, 10*time.Second, c.Agent.Interval.Duration)
+}
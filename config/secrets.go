@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/internal/secret"
+	"github.com/influxdata/toml/ast"
+)
+
+// secretStoreConfig configures a [[secretstores.<type>]] store:
+//
+//	directory - path, a directory with a file per secret named after the key
+//	keyfile   - path and passphrase (or passphrase_file), an encrypted local keyfile
+//	exec      - command (and timeout), a helper printing the secret for the key passed as its last argument
+type secretStoreConfig struct {
+	ID             string   `toml:"id"`
+	Path           string   `toml:"path"`
+	Passphrase     string   `toml:"passphrase"`
+	PassphraseFile string   `toml:"passphrase_file"`
+	Command        []string `toml:"command"`
+	Timeout        Duration `toml:"timeout"`
+}
+
+// addSecretStores adds the stores defined in the secretstores table, the stores are
+// used to resolve @{store:key} references in this and subsequently loaded files.
+func (c *Config) addSecretStores(tbl *ast.Table) error {
+	if c.secrets == nil {
+		c.secrets = secret.NewResolver()
+	}
+
+	// stores are created in the order they are defined, so a store's settings can
+	// reference the stores defined before it regardless of their types
+	type storeTable struct {
+		typ string
+		tbl *ast.Table
+	}
+	var stores []storeTable
+	for typ, val := range tbl.Fields {
+		tables, ok := val.([]*ast.Table)
+		if !ok {
+			return fmt.Errorf("secretstores.%s: invalid configuration, expected [[secretstores.%s]]", typ, typ)
+		}
+		for _, t := range tables {
+			stores = append(stores, storeTable{typ: typ, tbl: t})
+		}
+	}
+	sort.SliceStable(stores, func(i, j int) bool { return stores[i].tbl.Line < stores[j].tbl.Line })
+
+	for _, st := range stores {
+		typ, t := st.typ, st.tbl
+		// the store settings may themselves reference secrets of stores defined before
+		if err := c.resolveSecrets(t); err != nil {
+			return fmt.Errorf("secretstores.%s: %w", typ, err)
+		}
+		var cfg secretStoreConfig
+		if err := c.toml.UnmarshalTable(t, &cfg); err != nil {
+			return fmt.Errorf("secretstores.%s: %w", typ, err)
+		}
+		if len(c.UnusedFields) > 0 {
+			return fmt.Errorf("secretstores.%s: line %d: configuration specified the fields %q, but they weren't used", typ, t.Line, keys(c.UnusedFields))
+		}
+		store, err := newSecretStore(typ, &cfg)
+		if err != nil {
+			return fmt.Errorf("secretstores.%s: %w", typ, err)
+		}
+		if err := c.secrets.Add(cfg.ID, store); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+	return nil
+}
+
+func newSecretStore(typ string, cfg *secretStoreConfig) (secret.Store, error) { //nolint:ireturn
+	if cfg.ID == "" {
+		return nil, fmt.Errorf("id not set")
+	}
+	switch typ {
+	case "directory":
+		return secret.NewDirectoryStore(cfg.Path) //nolint:wrapcheck
+	case "keyfile":
+		passphrase := cfg.Passphrase
+		if cfg.PassphraseFile != "" {
+			data, err := os.ReadFile(cfg.PassphraseFile)
+			if err != nil {
+				return nil, fmt.Errorf("passphrase_file: %w", err)
+			}
+			passphrase = strings.TrimRight(string(data), "\r\n")
+		}
+		return secret.NewKeyfileStore(cfg.Path, passphrase) //nolint:wrapcheck
+	case "exec":
+		return secret.NewExecStore(cfg.Command, time.Duration(cfg.Timeout)) //nolint:wrapcheck
+	}
+	return nil, fmt.Errorf("unknown secret store type %q (directory, keyfile, exec)", typ)
+}
+
+// resolveSecrets replaces the @{store:key} references in the table's string values.
+func (c *Config) resolveSecrets(tbl *ast.Table) error {
+	for name, val := range tbl.Fields {
+		switch v := val.(type) {
+		case *ast.KeyValue:
+			if err := c.resolveSecretValue(v.Value); err != nil {
+				return fmt.Errorf("line %d: %s: %w", v.Line, name, err)
+			}
+		case *ast.Table:
+			if err := c.resolveSecrets(v); err != nil {
+				return err
+			}
+		case []*ast.Table:
+			for _, t := range v {
+				if err := c.resolveSecrets(t); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) resolveSecretValue(val ast.Value) error {
+	switch v := val.(type) {
+	case *ast.String:
+		if !secret.HasReference(v.Value) {
+			return nil
+		}
+		if c.secrets == nil {
+			return fmt.Errorf("secret reference %q, no secretstores configured", v.Value)
+		}
+		resolved, err := c.secrets.Resolve(v.Value)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+		v.Value = resolved
+		// the source is hashed to detect changed plugins on reload, a rotated secret restarts the plugin
+		v.Data = []rune(strconv.Quote(resolved))
+	case *ast.Array:
+		for _, av := range v.Value {
+			if err := c.resolveSecretValue(av); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
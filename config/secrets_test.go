@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus-labs/circonus-unified-agent/internal/secret"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_SecretStoresDefinitionOrder(t *testing.T) {
+	dir := t.TempDir()
+	passDir := filepath.Join(dir, "pass")
+	require.NoError(t, os.Mkdir(passDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(passDir, "passphrase"), []byte("hunter2\n"), 0o600))
+	tokenDir := filepath.Join(dir, "tokens")
+	require.NoError(t, os.Mkdir(tokenDir, 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(tokenDir, "api"), []byte("token_value\n"), 0o600))
+	keyfile := filepath.Join(dir, "secrets.json")
+	require.NoError(t, secret.WriteKeyfile(keyfile, "hunter2", map[string]string{"token_dir": tokenDir}))
+
+	// each store references the one defined before it, of another type
+	data := fmt.Sprintf(`
+[[secretstores.directory]]
+  id = "pass"
+  path = %q
+
+[[secretstores.keyfile]]
+  id = "kf"
+  path = %q
+  passphrase = "@{pass:passphrase}"
+
+[[secretstores.directory]]
+  id = "tokens"
+  path = "@{kf:token_dir}"
+
+[global_tags]
+  token = "@{tokens:api}"
+`, passDir, keyfile)
+
+	c := NewConfig()
+	require.NoError(t, c.LoadConfigData([]byte(data)))
+	require.Equal(t, "token_value", c.Tags["token"])
+}
@@ -0,0 +1,168 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	fsnotify "gopkg.in/fsnotify.v1"
+)
+
+// DefaultWatchDelay is how long the config files have to be unchanged before a
+// change is reported, so a set of files dropped by config management results in
+// a single reload.
+const DefaultWatchDelay = 2 * time.Second
+
+// Watcher watches the config file and config directory for changes.
+type Watcher struct {
+	watcher *fsnotify.Watcher
+	file    string
+	dir     string
+	delay   time.Duration
+}
+
+// NewWatcher returns a watcher for the config file and directory, either may
+// be empty. Remote (http/https) config files are not watched.
+func NewWatcher(file, dir string, delay time.Duration) (*Watcher, error) {
+	if delay <= 0 {
+		delay = DefaultWatchDelay
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("config watcher: %w", err)
+	}
+
+	w := &Watcher{
+		watcher: fw,
+		delay:   delay,
+	}
+
+	if file == "" {
+		// LoadConfig uses the default config file when none is given
+		if path, err := getDefaultConfigPath(); err == nil {
+			file = path
+		}
+	}
+	if file != "" && !isRemoteConfig(file) {
+		w.file = filepath.Clean(file)
+		// watch the parent so files replaced by renames (editors, symlink swaps) are seen
+		if err := fw.Add(filepath.Dir(w.file)); err != nil {
+			fw.Close()
+			return nil, fmt.Errorf("watching %s: %w", filepath.Dir(w.file), err)
+		}
+	}
+
+	if dir != "" {
+		w.dir = filepath.Clean(dir)
+		if err := w.addDir(w.dir); err != nil {
+			fw.Close()
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+func isRemoteConfig(file string) bool {
+	u, err := url.Parse(file)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// addDir watches a directory and its sub directories, LoadDirectory loads them recursively.
+func (w *Watcher) addDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error { //nolint:wrapcheck
+		if err != nil {
+			return nil //nolint:nilerr // skip, LoadDirectory reports inaccessible paths
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(info.Name(), "..") {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(path); err != nil {
+			return fmt.Errorf("watching %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+// relevant reports whether an event affects the loaded configuration.
+func (w *Watcher) relevant(ev fsnotify.Event) bool {
+	if ev.Op == fsnotify.Chmod {
+		return false
+	}
+	name := filepath.Clean(ev.Name)
+	if w.file != "" && name == w.file {
+		return true
+	}
+	if w.dir == "" || !strings.HasPrefix(name, w.dir+string(filepath.Separator)) {
+		return false
+	}
+	if strings.HasSuffix(name, ".conf") {
+		return true
+	}
+	// new sub directories are loaded too, removed ones may have held config files
+	if ev.Op&fsnotify.Create == fsnotify.Create {
+		if info, err := os.Stat(name); err == nil && info.IsDir() {
+			if err := w.addDir(name); err != nil {
+				log.Printf("W! [agent] %s", err)
+			}
+			return true
+		}
+	}
+	return ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && filepath.Ext(name) == ""
+}
+
+// Run sends on changed once the watched files have changed and then been left
+// unchanged for the watch delay. It returns when the context is done.
+func (w *Watcher) Run(ctx context.Context, changed chan<- struct{}) {
+	defer w.watcher.Close()
+
+	timer := time.NewTimer(w.delay)
+	if !timer.Stop() {
+		<-timer.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !w.relevant(ev) {
+				continue
+			}
+			log.Printf("D! [agent] config change detected: %s", ev)
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(w.delay)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("W! [agent] config watcher: %s", err)
+		case <-timer.C:
+			select {
+			case changed <- struct{}{}:
+			default: // a reload is already pending
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(t.TempDir(), "agent.conf")
+	require.NoError(t, os.WriteFile(file, []byte(""), 0600))
+
+	w, err := NewWatcher(file, dir, 50*time.Millisecond)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go w.Run(ctx, changed)
+
+	expectChange := func(want bool) {
+		t.Helper()
+		select {
+		case <-changed:
+			require.True(t, want, "unexpected change reported")
+		case <-time.After(500 * time.Millisecond):
+			require.False(t, want, "change not reported")
+		}
+	}
+
+	// files not loaded by LoadDirectory are ignored
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("x"), 0600))
+	expectChange(false)
+
+	// several files dropped at once result in a single change
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.conf"), []byte("x"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.conf"), []byte("x"), 0600))
+	expectChange(true)
+	expectChange(false)
+
+	require.NoError(t, os.WriteFile(file, []byte("# changed"), 0600))
+	expectChange(true)
+
+	// new sub directories are watched
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.Mkdir(sub, 0700))
+	expectChange(true)
+	require.NoError(t, os.WriteFile(filepath.Join(sub, "c.conf"), []byte("x"), 0600))
+	expectChange(true)
+}
@@ -154,4 +154,9 @@ type Metric interface {
 	OriginCheckDisplayName() string
 	// SetOriginCheckDisplayName sets the origin check display name
 	SetOriginCheckDisplayName(string)
+
+	// TypeHints gets the circonus type hints, keyed by field key ("" for all the fields)
+	TypeHints() map[string]string
+	// SetTypeHint sets the circonus type hint of a field ("" for all the fields)
+	SetTypeHint(field, typ string)
 }
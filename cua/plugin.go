@@ -9,6 +9,37 @@ type Initializer interface {
 	Init() error
 }
 
+// ConfigChecker is an interface plugins whose Init has side effects (e.g. it
+// creates directories, starts goroutines or creates checks through the Circonus
+// API) can optionally implement. When the configuration is checked, without
+// running the agent, CheckConfig is called instead of Init.
+type ConfigChecker interface {
+	// CheckConfig returns an error if the configuration is invalid, it must
+	// not change the host or any external system.
+	CheckConfig() error
+}
+
+// StatusReporter is an interface plugins can optionally implement to expose
+// their internal state on the agent's admin endpoint.
+type StatusReporter interface {
+	// Status returns a JSON serializable snapshot of the plugin's state.
+	Status() interface{}
+}
+
+// StatefulPlugin is an interface plugins can optionally implement to have
+// their state persisted by the agent, so it survives agent restarts and
+// config reloads. State is only persisted when the agent has a data_directory.
+type StatefulPlugin interface {
+	// GetState returns the state to persist, it must be JSON serializable.
+	// It may be called at any time while the plugin is running.
+	GetState() interface{}
+
+	// SetState restores the state previously returned by GetState. It is
+	// called after Init and before the plugin is started, with a value of
+	// the same type as GetState returns.
+	SetState(state interface{}) error
+}
+
 // PluginDescriber contains the functions all plugins must implement to describe
 // themselves to the agent. Note that all plugins may define a logger that is
 // not part of the interface, but will receive an injected logger if it's set.
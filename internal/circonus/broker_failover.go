@@ -0,0 +1,274 @@
+package circonus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/go-apiclient"
+	"github.com/circonus-labs/go-trapcheck"
+	"github.com/circonus-labs/go-trapmetrics"
+)
+
+const (
+	defaultBrokerFailureThreshold = 5
+	// brokerRecoveryDelay is how long an unhealthy broker is avoided, after which
+	// it is eligible again (a successful submission makes it healthy immediately)
+	brokerRecoveryDelay = 5 * time.Minute
+)
+
+// brokerHealth tracks consecutive submission failures for each of a profile's
+// brokers, checks are moved off a broker once the failure threshold is reached.
+type brokerHealth struct {
+	failures    map[string]int
+	lastFailure map[string]time.Time
+	mu          sync.Mutex
+}
+
+func newBrokerHealth() *brokerHealth {
+	return &brokerHealth{
+		failures:    make(map[string]int),
+		lastFailure: make(map[string]time.Time),
+	}
+}
+
+func (h *brokerHealth) failed(broker string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures[broker]++
+	h.lastFailure[broker] = time.Now()
+	return h.failures[broker]
+}
+
+func (h *brokerHealth) succeeded(broker string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.failures, broker)
+	delete(h.lastFailure, broker)
+}
+
+func (h *brokerHealth) healthy(broker string, threshold int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failures[broker] < threshold {
+		return true
+	}
+	return time.Since(h.lastFailure[broker]) > brokerRecoveryDelay
+}
+
+var brokerCIDRx = regexp.MustCompile(`^/broker/[0-9]+$`)
+
+// isBrokerFailure indicates whether a submission error means the broker is unhealthy:
+// connection errors, timeouts and 5xx responses. Client errors (4xx, the check is gone
+// or the payload was rejected), canceled submissions and local errors are not counted.
+func isBrokerFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	if status := SubmitStatus(err); status != 0 {
+		return status >= http.StatusInternalServerError
+	}
+	// retries exhausted, the broker kept responding with 5xx (or 429)
+	return strings.Contains(err.Error(), "giving up after")
+}
+
+// normalizeBrokerCID returns the broker cid for a broker id or cid from the config.
+func normalizeBrokerCID(bid string) (string, error) {
+	bid = strings.TrimSpace(bid)
+	if !strings.HasPrefix(bid, "/broker/") {
+		bid = "/broker/" + bid
+	}
+	if !brokerCIDRx.MatchString(bid) {
+		return "", fmt.Errorf("invalid broker cid (%s)", bid)
+	}
+	return bid, nil
+}
+
+// initBrokers validates the profile's brokers and broker_weights settings.
+func (ch *Circonus) initBrokers() error {
+	ch.brokerHealth = newBrokerHealth()
+	ch.brokerWeights = make(map[string]int)
+
+	for _, b := range ch.circCfg.Brokers {
+		cid, err := normalizeBrokerCID(b)
+		if err != nil {
+			return fmt.Errorf("brokers: %w", err)
+		}
+		ch.brokers = append(ch.brokers, cid)
+	}
+	for b, w := range ch.circCfg.BrokerWeights {
+		cid, err := normalizeBrokerCID(b)
+		if err != nil {
+			return fmt.Errorf("broker_weights: %w", err)
+		}
+		if w < 0 {
+			return fmt.Errorf("broker_weights: invalid weight %d for %s", w, cid)
+		}
+		ch.brokerWeights[cid] = w
+	}
+
+	ch.brokerFailureThreshold = ch.circCfg.BrokerFailureThreshold
+	if ch.brokerFailureThreshold == 0 {
+		ch.brokerFailureThreshold = defaultBrokerFailureThreshold
+	}
+	return nil
+}
+
+// selectBroker returns a healthy broker from the brokers list for a new check (or
+// to move a check to), excluding a broker. The first healthy broker is returned,
+// or with broker_weights a weighted random choice of the healthy brokers. Returns
+// an empty string when no broker is available.
+func (ch *Circonus) selectBroker(exclude string) string {
+	candidates := make([]string, 0, len(ch.brokers))
+	for _, b := range ch.brokers {
+		if b != exclude && ch.brokerHealth.healthy(b, ch.brokerFailureThreshold) {
+			candidates = append(candidates, b)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	if len(ch.brokerWeights) == 0 {
+		return candidates[0]
+	}
+
+	total := 0
+	for _, b := range candidates {
+		total += ch.brokerWeight(b)
+	}
+	if total == 0 {
+		return candidates[0]
+	}
+	n := rand.Intn(total) //nolint:gosec
+	for _, b := range candidates {
+		n -= ch.brokerWeight(b)
+		if n < 0 {
+			return b
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+func (ch *Circonus) brokerWeight(broker string) int {
+	if w, ok := ch.brokerWeights[broker]; ok {
+		return w
+	}
+	return 1
+}
+
+// failoverTrap submits to a check's current broker, tracking the broker's health. Once
+// the check's consecutive failures reach the threshold the check is moved, via the API,
+// to a healthy broker from the profile's brokers list.
+type failoverTrap struct {
+	tc       *trapcheck.TrapCheck
+	ch       *Circonus
+	client   *apiclient.API
+	logger   cua.Logger
+	destKey  string
+	failures int
+	mu       sync.Mutex
+}
+
+// SendMetrics submits metrics to the check's broker.
+func (t *failoverTrap) SendMetrics(ctx context.Context, metrics bytes.Buffer) (*trapcheck.TrapResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	broker := ""
+	if bundle, err := t.tc.GetCheckBundle(); err == nil && len(bundle.Brokers) > 0 {
+		broker = bundle.Brokers[0]
+	}
+
+	result, err := t.tc.SendMetrics(ctx, metrics)
+	if err == nil {
+		t.failures = 0
+		t.ch.brokerHealth.succeeded(broker)
+		return result, nil
+	}
+	if !isBrokerFailure(err) {
+		return result, err //nolint:wrapcheck
+	}
+
+	t.failures++
+	t.ch.brokerHealth.failed(broker)
+	if t.failures >= t.ch.brokerFailureThreshold {
+		if moveErr := t.moveCheck(broker); moveErr != nil {
+			t.logger.Warnf("%s: broker failover: %s", t.destKey, moveErr)
+		} else {
+			t.failures = 0
+		}
+	}
+
+	return result, err //nolint:wrapcheck
+}
+
+// UpdateCheckTags updates the check's tags.
+func (t *failoverTrap) UpdateCheckTags(ctx context.Context, tags []string) (*apiclient.CheckBundle, error) {
+	return t.tc.UpdateCheckTags(ctx, tags) //nolint:wrapcheck
+}
+
+// RefreshCheckBundle refreshes the check bundle from the API, not while metrics
+// are submitted or the check is moved.
+func (t *failoverTrap) RefreshCheckBundle() (apiclient.CheckBundle, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.tc.RefreshCheckBundle() //nolint:wrapcheck
+}
+
+// moveCheck moves the check off the broker to a healthy broker.
+func (t *failoverTrap) moveCheck(broker string) error {
+	target := t.ch.selectBroker(broker)
+	if target == "" {
+		return fmt.Errorf("%d consecutive failures on %s, no healthy broker to move the check to", t.failures, broker)
+	}
+
+	bundle, err := t.tc.GetCheckBundle()
+	if err != nil {
+		return fmt.Errorf("moving check: %w", err)
+	}
+	t.logger.Warnf("%s: broker failover: %d consecutive failures on %s, moving check %s to %s", t.destKey, t.failures, broker, bundle.CID, target)
+
+	bundle.Brokers = []string{target}
+	if _, err := t.client.UpdateCheckBundle(&bundle); err != nil {
+		return fmt.Errorf("moving check %s to %s: %w", bundle.CID, target, err)
+	}
+	// pick up the new submission url and broker tls config
+	refreshed, err := t.tc.RefreshCheckBundle()
+	if err != nil {
+		return fmt.Errorf("refreshing check %s after move: %w", bundle.CID, err)
+	}
+	t.ch.saveCheckConfig(t.destKey, &refreshed)
+
+	return nil
+}
+
+// TrapCheck returns the trap check of a metric destination's trap, false if the
+// destination does not use a check (static submission url).
+func TrapCheck(trap trapmetrics.Trap) (*trapcheck.TrapCheck, bool) {
+	switch t := trap.(type) {
+	case *trapcheck.TrapCheck:
+		return t, t != nil
+	case *failoverTrap:
+		if t == nil {
+			return nil, false
+		}
+		return t.tc, t.tc != nil
+	}
+	return nil, false
+}
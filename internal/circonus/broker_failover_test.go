@@ -0,0 +1,85 @@
+package circonus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectBroker(t *testing.T) {
+	require.Error(t, InitializeProfile("bad_brokers", &config.CirconusConfig{
+		APIToken: "token",
+		Brokers:  []string{"abc"},
+	}))
+
+	require.NoError(t, InitializeProfile("brokers", &config.CirconusConfig{
+		APIToken:               "token",
+		Brokers:                []string{"1", "/broker/2", "3"},
+		BrokerFailureThreshold: 2,
+	}))
+	ch, err := getProfile("brokers")
+	require.NoError(t, err)
+	require.Equal(t, []string{"/broker/1", "/broker/2", "/broker/3"}, ch.brokers)
+
+	// ordered, first healthy broker
+	require.Equal(t, "/broker/1", ch.selectBroker(""))
+	require.Equal(t, "/broker/2", ch.selectBroker("/broker/1"))
+
+	ch.brokerHealth.failed("/broker/1")
+	require.Equal(t, "/broker/1", ch.selectBroker(""), "below the failure threshold")
+	ch.brokerHealth.failed("/broker/1")
+	require.Equal(t, "/broker/2", ch.selectBroker(""))
+	ch.brokerHealth.succeeded("/broker/1")
+	require.Equal(t, "/broker/1", ch.selectBroker(""))
+
+	for _, b := range ch.brokers {
+		ch.brokerHealth.failed(b)
+		ch.brokerHealth.failed(b)
+	}
+	require.Empty(t, ch.selectBroker(""))
+}
+
+func TestSelectBrokerWeighted(t *testing.T) {
+	require.NoError(t, InitializeProfile("weighted", &config.CirconusConfig{
+		APIToken:      "token",
+		Brokers:       []string{"1", "2", "3"},
+		BrokerWeights: map[string]int{"1": 0, "2": 3, "/broker/3": 1},
+	}))
+	ch, err := getProfile("weighted")
+	require.NoError(t, err)
+
+	selected := make(map[string]int)
+	for i := 0; i < 400; i++ {
+		selected[ch.selectBroker("")]++
+	}
+	require.Zero(t, selected["/broker/1"])
+	require.Greater(t, selected["/broker/2"], selected["/broker/3"])
+	require.NotZero(t, selected["/broker/3"])
+}
+
+func TestIsBrokerFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		name string
+		want bool
+	}{
+		{name: "connection refused", err: fmt.Errorf("making request: %w", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}), want: true},
+		{name: "timeout", err: fmt.Errorf("making request: %w", context.DeadlineExceeded), want: true},
+		{name: "5xx", err: fmt.Errorf("501 Not Implemented - https://broker/module/httptrap/uuid/secret"), want: true},
+		{name: "retries exhausted", err: fmt.Errorf("making request: POST https://broker/module/httptrap/uuid/secret giving up after 8 attempt(s)"), want: true},
+		{name: "4xx", err: fmt.Errorf("406 Not Acceptable - https://broker/module/httptrap/uuid/secret"), want: false},
+		{name: "check gone", err: fmt.Errorf("unable to refresh: %w", fmt.Errorf("404 Not Found - https://broker/module/httptrap/uuid/secret")), want: false},
+		{name: "canceled", err: fmt.Errorf("making request: %w", context.Canceled), want: false},
+		{name: "local", err: fmt.Errorf("zero length data, no metrics to submit"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isBrokerFailure(tt.err))
+		})
+	}
+}
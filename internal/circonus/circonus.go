@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"reflect"
 	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
 	"github.com/circonus-labs/circonus-unified-agent/config"
@@ -25,17 +27,38 @@ import (
 	"github.com/valyala/fasttemplate"
 )
 
-var ch *Circonus
+// DefaultProfile is the name of the profile configured by agent.circonus, it
+// is used by plugins which do not reference a profile.
+const DefaultProfile = ""
 
+var (
+	// profiles are the circonus accounts checks can be managed in, keyed by name
+	profiles   = make(map[string]*Circonus)
+	profilesmu sync.RWMutex
+
+	globalTags   = make(trapmetrics.Tags, 0)
+	globalTagsmu sync.RWMutex
+)
+
+// Circonus manages the checks of one circonus account (profile), each has its
+// own API client, broker TLS configs and check bundle cache.
 type Circonus struct {
 	logger           cua.Logger
 	brokerTLSConfigs map[string]*tls.Config
 	circCfg          *config.CirconusConfig
+	settings         config.CirconusConfig // as configured, before defaults are applied
 	apiCfg           *apiclient.Config
 	brokerCIDrx      string
-	globalTags       trapmetrics.Tags
+	name             string
+	brokers          []string       // failover brokers, in order of preference
+	brokerWeights    map[string]int // weighted selection of brokers, when set
+	brokerHealth     *brokerHealth
+	cacheTTL         time.Duration
+	owned            map[string]MetricMeta // check bundle cid -> destination, checks in use
+	ownedmu          sync.Mutex
 	sync.Mutex
-	ready bool
+	brokerFailureThreshold int
+	ready                  bool
 }
 
 type MetricMeta struct {
@@ -54,6 +77,10 @@ type MetricDestConfig struct {
 	CheckTags         map[string]string // tags for a specific instance of a check
 	APIToken          string            // allow override of api token for a specific plugin (dm input or circonus output)
 	Broker            string            // allow override of broker for a specific plugin (dm input or circonus output)
+	Profile           string            // circonus profile (account) to manage the check in, default agent.circonus
+	SubmissionURL     string            // static submission url, the API is not used to find or create a check
+	BrokerCAFile      string            // CA to verify the broker certificate with when using a static submission url
+	MetricFilters     [][]string        // metric filters for the check, default agent.circonus check_metric_filters
 	MetricMeta        MetricMeta
 }
 
@@ -88,23 +115,43 @@ func (l Logshim) Errorf(fmt string, args ...interface{}) {
 	l.logh.Errorf(l.prefix+": "+fmt, args...)
 }
 
+// Initialize configures the default profile from agent.circonus.
 func Initialize(cfg *config.CirconusConfig) error {
-	if ch != nil {
-		return nil // already initialized
-	}
+	return InitializeProfile(DefaultProfile, cfg)
+}
+
+// InitializeProfile configures a named circonus profile. A profile that is already
+// initialized is replaced when its settings changed (e.g. on a full reload of the
+// agent), if the new settings are invalid the profile is kept and an error returned.
+func InitializeProfile(name string, cfg *config.CirconusConfig) error {
+	profilesmu.Lock()
+	defer profilesmu.Unlock()
+
 	if cfg == nil {
 		return fmt.Errorf("circonus metric destination management module: invalid circonus config (nil)")
 	}
+	if current, ok := profiles[name]; ok {
+		if reflect.DeepEqual(current.settings, *cfg) {
+			return nil // already initialized
+		}
+		log.Printf("I! circonus metric destination management module: profile %q settings changed, reinitializing", name)
+	}
 
+	circCfg := *cfg // defaults are applied to the profile's copy
 	c := &Circonus{
-		circCfg:          cfg,
+		circCfg:          &circCfg,
+		settings:         *cfg,
 		brokerTLSConfigs: make(map[string]*tls.Config),
-		globalTags:       make(trapmetrics.Tags, 0),
 		brokerCIDrx:      `^/broker/[0-9]+$`,
+		name:             name,
 	}
 
 	if c.circCfg.APIToken == "" {
-		log.Print("W! circonus metric destination management module may not function properly without a valid API Token")
+		if name == DefaultProfile {
+			log.Print("W! circonus metric destination management module may not function properly without a valid API Token")
+		} else {
+			log.Printf("W! circonus metric destination management module: profile %q: api_token not set, only usable with a submission_url", name)
+		}
 	}
 
 	if c.circCfg.APIApp == "" {
@@ -139,6 +186,12 @@ func Initialize(cfg *config.CirconusConfig) error {
 		return fmt.Errorf("circonus metric destination management module: cache_configs on, cache_dir not set")
 	}
 	if c.circCfg.CacheConfigs && c.circCfg.CacheDir != "" {
+		if name != DefaultProfile {
+			// a profile's cache_dir defaults to a sub directory of the agent.circonus cache_dir
+			if err := os.MkdirAll(c.circCfg.CacheDir, 0o750); err != nil {
+				return fmt.Errorf("circonus metric destination management module: profile %q: cache_dir (%s): %w", name, c.circCfg.CacheDir, err)
+			}
+		}
 		info, err := os.Stat(c.circCfg.CacheDir)
 		if err != nil {
 			return fmt.Errorf("circonus metric destination management module: cache_dir (%s): %w", c.circCfg.CacheDir, err)
@@ -146,6 +199,21 @@ func Initialize(cfg *config.CirconusConfig) error {
 			return fmt.Errorf("circonus metric destination management module: cache_dir (%s): not a directory", c.circCfg.CacheDir)
 		}
 	}
+	if err := c.initBrokers(); err != nil {
+		return fmt.Errorf("circonus metric destination management module: %w", err)
+	}
+	if err := validateRetireChecks(c.circCfg.RetireChecks); err != nil {
+		return fmt.Errorf("circonus metric destination management module: %w", err)
+	}
+
+	c.cacheTTL = defaultCacheTTL
+	if c.circCfg.CacheTTL != "" {
+		ttl, err := time.ParseDuration(c.circCfg.CacheTTL)
+		if err != nil {
+			return fmt.Errorf("circonus metric destination management module: cache_ttl (%s): %w", c.circCfg.CacheTTL, err)
+		}
+		c.cacheTTL = ttl
+	}
 
 	if c.circCfg.CheckTarget == "" {
 		hn, err := os.Hostname()
@@ -155,46 +223,63 @@ func Initialize(cfg *config.CirconusConfig) error {
 		c.circCfg.CheckTarget = hn
 	}
 
-	c.logger = models.NewLogger("agent", "circ_metric_dest_mgr", "")
+	c.logger = models.NewLogger("agent", "circ_metric_dest_mgr", name)
 
 	c.ready = true
 
-	ch = c
+	profiles[name] = c
 
 	return nil
 }
 
+// Ready indicates whether the default profile has been initialized.
 func Ready() bool {
-	if ch == nil {
-		return false
+	return ProfileReady(DefaultProfile)
+}
+
+// ProfileReady indicates whether the named profile has been initialized.
+func ProfileReady(name string) bool {
+	profilesmu.RLock()
+	defer profilesmu.RUnlock()
+	c, ok := profiles[name]
+	return ok && c.ready
+}
+
+// getProfile returns the named profile or an error if it is not initialized.
+func getProfile(name string) (*Circonus, error) {
+	profilesmu.RLock()
+	c, ok := profiles[name]
+	profilesmu.RUnlock()
+	if !ok {
+		if name == DefaultProfile {
+			return nil, fmt.Errorf("circonus metric destination management module: module not initialized")
+		}
+		return nil, fmt.Errorf("circonus metric destination management module: profile %q not configured", name)
+	}
+	if !c.ready {
+		return nil, fmt.Errorf("circonus metric destination management module: invalid agent circonus config")
 	}
-	return ch.ready
+	return c, nil
 }
 
 func AddGlobalTags(tags map[string]string) {
-	if ch == nil {
-		return
-	}
+	globalTagsmu.Lock()
+	defer globalTagsmu.Unlock()
 	for k, v := range tags {
 		if k != "" && v != "" {
-			ch.globalTags = append(ch.globalTags, trapmetrics.Tag{Category: k, Value: v})
+			globalTags = append(globalTags, trapmetrics.Tag{Category: k, Value: v})
 		}
 	}
 }
 
 func GetGlobalTags() trapmetrics.Tags {
-	return ch.globalTags
+	globalTagsmu.RLock()
+	defer globalTagsmu.RUnlock()
+	return globalTags
 }
 
-// getAPIClient returns a Circonus API client or an error
-func getAPIClient(opts *MetricDestConfig) (*apiclient.API, error) {
-	if ch == nil {
-		return nil, fmt.Errorf("circonus metric destination management module: module not initialized")
-	}
-	if !ch.ready {
-		return nil, fmt.Errorf("circonus metric destination management module: invalid agent circonus config")
-	}
-
+// getAPIClient returns a Circonus API client for the profile
+func (ch *Circonus) getAPIClient(opts *MetricDestConfig) (*apiclient.API, error) {
 	cfg := *ch.apiCfg
 	if opts != nil {
 		// only option which may currently be overridden is the api key
@@ -216,13 +301,6 @@ func getAPIClient(opts *MetricDestConfig) (*apiclient.API, error) {
 
 // createCheck retrieves, finds, or creates a Check bundle in Circonus and returns a trap check or an error
 func createCheck(cfg *trapcheck.Config) (*trapcheck.TrapCheck, error) {
-	if ch == nil {
-		return nil, fmt.Errorf("circonus metric destination management module: module not initialized")
-	}
-	if !ch.ready {
-		return nil, fmt.Errorf("circonus metric destination management module: invalid agent circonus config")
-	}
-
 	tc, err := trapcheck.New(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("circonus metric destination management module: creating trap check: %w", err)
@@ -232,13 +310,6 @@ func createCheck(cfg *trapcheck.Config) (*trapcheck.TrapCheck, error) {
 
 // createMetrics creates an instance of trap metrics and returns it or an error
 func createMetrics(cfg *trapmetrics.Config) (*trapmetrics.TrapMetrics, error) {
-	if ch == nil {
-		return nil, fmt.Errorf("circonus metric destination management module: module not initialized")
-	}
-	if !ch.ready {
-		return nil, fmt.Errorf("circonus metric destination management module: invalid agent circonus config")
-	}
-
 	tm, err := trapmetrics.New(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("circonus metric destination management module: creating trap metrics: %w", err)
@@ -255,11 +326,28 @@ func createMetrics(cfg *trapmetrics.Config) (*trapmetrics.TrapMetrics, error) {
 //	hostname = used in the display name and target of the check
 //	logger = an instance of cua logger (already configured for the plugin requesting the metric destination)
 func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetrics.TrapMetrics, error) {
-	if ch == nil {
-		return nil, fmt.Errorf("circonus metric destination management module: module not initialized")
+	metrics, _, err := NewMetricDestinationWithTrap(opts, logger)
+	if err != nil {
+		return nil, err
 	}
-	if !ch.ready {
-		return nil, fmt.Errorf("circonus metric destination management module: invalid agent circonus config")
+	return metrics, nil
+}
+
+// NewMetricDestinationWithTrap is the same as NewMetricDestination but also returns the trap
+// backing the metric destination - so that callers can submit previously serialized metric payloads
+// (e.g. retrying a failed submission) without going through the trap metrics container. The trap
+// is a *trapcheck.TrapCheck unless a static submission url is configured.
+func NewMetricDestinationWithTrap(opts *MetricDestConfig, logger cua.Logger) (*trapmetrics.TrapMetrics, trapmetrics.Trap, error) {
+	ch, err := getProfile(opts.Profile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.SubmissionURL != "" {
+		return ch.newStaticMetricDestination(opts, logger)
+	}
+	if ch.name != DefaultProfile && ch.circCfg.APIToken == "" && opts.APIToken == "" {
+		return nil, nil, fmt.Errorf("circonus metric destination management module: profile %q: api_token not set", ch.name)
 	}
 
 	// serialize, don't want too many checks being created simultaneously - api rate limits, overwhelm broker, duplicate checks, etc.
@@ -290,7 +378,7 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 
 	// if check target was all non-printable chars and is now empty...
 	if checkTarget == "" {
-		log.Fatalf("check target is empty after processing cfg:'%v' opts:'%v'", ch.circCfg.CheckTarget, opts.CheckTarget) //nolint:gocritic
+		return nil, nil, fmt.Errorf("circonus metric destination management module: check target is empty after processing cfg:'%v' opts:'%v'", ch.circCfg.CheckTarget, opts.CheckTarget)
 	}
 
 	debugCheckSet := false
@@ -304,7 +392,18 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 		traceMetrics = *opts.TraceMetrics
 	}
 
-	bundle, bundleInCache := loadCheckConfig(destKey)
+	var bundle *apiclient.CheckBundle
+	cached := ch.loadCheckConfig(destKey)
+	bundleInCache := cached != nil
+	verifyCached := false
+	if cached != nil {
+		bundle = cached.Bundle
+		// stale cached checks are verified with the API even with cache_no_verify
+		verifyCached = !ch.circCfg.CacheNoVerify || cached.Stale(ch.cacheTTL)
+		if ch.circCfg.CacheNoVerify && verifyCached {
+			ch.logger.Infof("cached config for %s fetched %s, verifying", destKey, cached.Fetched.Format(time.RFC3339))
+		}
+	}
 	if bundle != nil {
 		// NOTE: api call debug won't be set on existing checks unless they are cached.
 		//       submission debugging will work as the flags will be set after the
@@ -334,6 +433,11 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 	}
 	checkType = append(checkType, runtime.GOOS)
 
+	metricFilters := ch.circCfg.CheckMetricFilters
+	if len(opts.MetricFilters) > 0 {
+		metricFilters = opts.MetricFilters
+	}
+
 	checkDisplayName := ""
 	switch pluginID {
 	case "stackdriver_circonus":
@@ -366,7 +470,7 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 				ct, err := fasttemplate.NewTemplate(opts.CheckDisplayName, "{{", "}}")
 				if err != nil {
 					logger.Errorf("compiling custom template %s: %s", opts.CheckDisplayName, err)
-					return nil, fmt.Errorf("compiling custom template %s: %w", opts.CheckDisplayName, err)
+					return nil, nil, fmt.Errorf("compiling custom template %s: %w", opts.CheckDisplayName, err)
 				}
 				t = ct
 			}
@@ -412,9 +516,9 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 	}
 
 	// API client
-	circAPI, err := getAPIClient(opts)
+	circAPI, err := ch.getAPIClient(opts)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	circAPI.Log = instanceLogger
 	circAPI.Debug = debugAPI
@@ -442,19 +546,19 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 	var tch *trapcheck.TrapCheck
 
 	switch {
-	case bundle != nil && ch.circCfg.CacheNoVerify: // use cached check bundle and don't verify by pulling from API again
+	case bundle != nil && !verifyCached: // use cached check bundle and don't verify by pulling from API again
 		if tlscfg, ok := ch.brokerTLSConfigs[bundle.Brokers[0]]; ok {
 			tc.SubmitTLSConfig = tlscfg.Clone()
 		}
 		var err error
 		tch, err = trapcheck.NewFromCheckBundle(tc, bundle)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		if tc.SubmitTLSConfig == nil {
 			t, err := tch.GetBrokerTLSConfig()
 			if err != nil {
-				return nil, fmt.Errorf("circonus metric destination management module: unable to get broker tls config: %w", err)
+				return nil, nil, fmt.Errorf("circonus metric destination management module: unable to get broker tls config: %w", err)
 			}
 			if t != nil {
 				ch.brokerTLSConfigs[bundle.Brokers[0]] = t.Clone()
@@ -484,14 +588,21 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 		notes := fmt.Sprintf("%s-%s", info.Name, info.Version)
 
 		cc = &apiclient.CheckBundle{
-			Type:        strings.Join(checkType, ":"),
-			DisplayName: checkDisplayName,
-			Target:      checkTarget,
-			Tags:        tags,
-			Notes:       &notes,
+			Type:          strings.Join(checkType, ":"),
+			DisplayName:   checkDisplayName,
+			Target:        checkTarget,
+			Tags:          tags,
+			Notes:         &notes,
+			MetricFilters: metricFilters,
 		}
 		if opts.Broker != "" {
 			cc.Brokers = []string{opts.Broker}
+		} else if len(ch.brokers) > 0 {
+			if b := ch.selectBroker(""); b != "" {
+				cc.Brokers = []string{b}
+			} else {
+				cc.Brokers = []string{ch.brokers[0]} // none healthy, use the preferred broker
+			}
 		} else if ch.circCfg.Broker != "" {
 			cc.Brokers = []string{ch.circCfg.Broker}
 		}
@@ -502,10 +613,10 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 				bid = "/broker/" + bid
 				matched, err := regexp.MatchString(ch.brokerCIDrx, bid)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 				if !matched {
-					return nil, fmt.Errorf("invalid broker cid (%s): %w", bid, err)
+					return nil, nil, fmt.Errorf("invalid broker cid (%s): %w", bid, err)
 				}
 				cc.Brokers[0] = bid
 			}
@@ -521,17 +632,59 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 		logger.Debug("find/create check using API")
 		tch, err = createCheck(tc)
 		if err != nil {
-			return nil, err
+			if bundleInCache && IsCheckGone(err) {
+				// self-heal, the check will be found or created on the next attempt
+				logger.Warnf("cached check %s no longer exists, removing from cache", bundle.CID)
+				ch.purgeCheckConfig(destKey)
+			}
+			return nil, nil, err
 		}
 	}
 
-	if bundle == nil { // it wasn't loaded from cache
+	if bundle == nil || verifyCached { // it wasn't loaded from cache, or was verified with the API
 		b, err := tch.GetCheckBundle()
 		if err != nil {
-			return nil, fmt.Errorf("circonus metric destination management module: unable to get check bundle: %w", err)
+			return nil, nil, fmt.Errorf("circonus metric destination management module: unable to get check bundle: %w", err)
 		}
 		bundle = &b
-		saveCheckConfig(destKey, bundle)
+		ch.saveCheckConfig(destKey, bundle)
+	}
+
+	ch.trackOwned(bundle.CID, opts.MetricMeta)
+	if isRetired(bundle) {
+		if b, err := unretireCheck(circAPI, bundle, logger); err != nil {
+			logger.Warnf("circonus metric destination management module: %s", err)
+		} else {
+			bundle = b
+			ch.saveCheckConfig(destKey, b)
+		}
+	}
+
+	if ch.circCfg.ReconcileChecks || ch.circCfg.ReconcileDryRun {
+		spec := &checkSpec{
+			DisplayName:   checkDisplayName,
+			Target:        checkTarget,
+			Tags:          checkTags,
+			MetricFilters: metricFilters,
+		}
+		if cleanTags, ok := VerifyTags(customTags); ok {
+			spec.Tags = append(append([]string{}, checkTags...), cleanTags...)
+		}
+		if _, changes := diffCheck(bundle, spec); len(changes) > 0 && bundleInCache {
+			// diff against the live bundle, not a possibly outdated cached copy
+			b, err := tch.RefreshCheckBundle()
+			if err != nil {
+				return nil, nil, fmt.Errorf("circonus metric destination management module: unable to refresh check bundle: %w", err)
+			}
+			bundle = &b
+			ch.saveCheckConfig(destKey, bundle)
+		}
+		if b, err := reconcileCheck(circAPI, bundle, spec, ch.circCfg.ReconcileDryRun, logger); err != nil {
+			logger.Warnf("circonus metric destination management module: %s", err)
+		} else if b != nil {
+			bundle = b
+			ch.saveCheckConfig(destKey, b)
+		}
 	}
 
 	// custom tags can be set by a specific plugin via `check_tags` generic config option
@@ -542,8 +695,9 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 	// applied when a check is created, not whenever the agent restarts. The logic is here
 	// to update custom tags - when/if the impact to fault is mitigated. To implement, just
 	// remove the `if pluginID == "host" {` constraint and revert the hard false setting
-	// above on updateCustomTags to the commented out checkForTagDelta call.
-	if pluginID == "host" {
+	// above on updateCustomTags to the commented out checkForTagDelta call. Or enable
+	// reconcile_checks, which updates all checks.
+	if pluginID == "host" && !ch.circCfg.ReconcileChecks && !ch.circCfg.ReconcileDryRun {
 		// the common tags are the main check tags (global tags in conf, os tags for host,
 		// and generic plugin tags common to all plugins)
 		updateCommonTags := checkForTagDelta(bundle, checkTags)
@@ -552,10 +706,10 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 			// the API, so we do not squash any out-of-band updates to tags...
 			b, err := tch.RefreshCheckBundle()
 			if err != nil {
-				return nil, fmt.Errorf("circonus metric destination management module: unable to refresh check bundle: %w", err)
+				return nil, nil, fmt.Errorf("circonus metric destination management module: unable to refresh check bundle: %w", err)
 			}
 			bundle = &b
-			saveCheckConfig(destKey, bundle)
+			ch.saveCheckConfig(destKey, bundle)
 		}
 		if updateCommonTags || updateCustomTags {
 			var tags []string
@@ -570,7 +724,7 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 			if b, err := updateCheckTags(circAPI, bundle, tags, logger); err != nil {
 				logger.Warnf("circonus metric destination management module: updating check tags %s", err)
 			} else if b != nil {
-				saveCheckConfig(destKey, b)
+				ch.saveCheckConfig(destKey, b)
 			}
 		}
 	}
@@ -581,7 +735,7 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 	if _, ok := ch.brokerTLSConfigs[bundle.Brokers[0]]; !ok {
 		t, err := tch.GetBrokerTLSConfig()
 		if err != nil {
-			return nil, fmt.Errorf("circonus metric destination management module: unable to get broker tls config: %w", err)
+			return nil, nil, fmt.Errorf("circonus metric destination management module: unable to get broker tls config: %w", err)
 		}
 		if t != nil {
 			ch.brokerTLSConfigs[bundle.Brokers[0]] = t.Clone()
@@ -591,14 +745,25 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 		}
 	}
 
+	var trap trapmetrics.Trap = tch
+	if len(ch.brokers) > 1 {
+		trap = &failoverTrap{
+			tc:      tch,
+			ch:      ch,
+			client:  circAPI,
+			logger:  logger,
+			destKey: destKey,
+		}
+	}
+
 	// Trap Metrics
 	tm := &trapmetrics.Config{
-		Trap:   tch,
+		Trap:   trap,
 		Logger: instanceLogger,
 	}
 	metrics, err := createMetrics(tm)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if bundle != nil && !debugCheckSet {
@@ -624,7 +789,7 @@ func NewMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetri
 		}
 	}
 
-	return metrics, nil
+	return metrics, trap, nil
 }
 
 func getOSCheckTags() []string {
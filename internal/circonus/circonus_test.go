@@ -0,0 +1,86 @@
+package circonus
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitializeProfile(t *testing.T) {
+	// without an api token a profile can only be used with a submission url
+	require.NoError(t, InitializeProfile("no_token", &config.CirconusConfig{}))
+	require.True(t, ProfileReady("no_token"))
+	_, _, err := NewMetricDestinationWithTrap(&MetricDestConfig{Profile: "no_token"}, nil)
+	require.ErrorContains(t, err, `profile "no_token": api_token not set`)
+
+	require.NoError(t, InitializeProfile("tenant_a", &config.CirconusConfig{
+		APIToken: "token_a",
+		APIURL:   "https://a.example.com/api",
+	}))
+	require.NoError(t, InitializeProfile("tenant_b", &config.CirconusConfig{
+		APIToken: "token_b",
+		APIURL:   "https://b.example.com/api",
+	}))
+	require.True(t, ProfileReady("tenant_a"))
+	require.True(t, ProfileReady("tenant_b"))
+
+	// each profile has its own api client config
+	a, err := getProfile("tenant_a")
+	require.NoError(t, err)
+	b, err := getProfile("tenant_b")
+	require.NoError(t, err)
+	require.Equal(t, "token_a", a.apiCfg.TokenKey)
+	require.Equal(t, "https://b.example.com/api", b.apiCfg.URL)
+
+	// a profile's cache_dir is created when the profile is initialized
+	cacheDir := filepath.Join(t.TempDir(), "tenant_d")
+	require.NoError(t, InitializeProfile("tenant_d", &config.CirconusConfig{
+		APIToken:     "token_d",
+		CacheConfigs: true,
+		CacheDir:     cacheDir,
+	}))
+	require.DirExists(t, cacheDir)
+
+	_, err = getProfile("tenant_c")
+	require.ErrorContains(t, err, `profile "tenant_c" not configured`)
+
+	_, _, err = NewMetricDestinationWithTrap(&MetricDestConfig{Profile: "tenant_c"}, nil)
+	require.Error(t, err)
+}
+
+func TestInitializeProfileReload(t *testing.T) {
+	cfg := config.CirconusConfig{
+		APIToken: "token_r",
+		APIURL:   "https://r.example.com/api",
+	}
+	require.NoError(t, InitializeProfile("tenant_r", &cfg))
+	orig, err := getProfile("tenant_r")
+	require.NoError(t, err)
+
+	// same settings, profile is kept as is
+	same := cfg
+	require.NoError(t, InitializeProfile("tenant_r", &same))
+	p, err := getProfile("tenant_r")
+	require.NoError(t, err)
+	require.Same(t, orig, p)
+
+	// changed settings replace the profile
+	changed := cfg
+	changed.APIToken = "token_r2"
+	require.NoError(t, InitializeProfile("tenant_r", &changed))
+	p, err = getProfile("tenant_r")
+	require.NoError(t, err)
+	require.NotSame(t, orig, p)
+	require.Equal(t, "token_r2", p.apiCfg.TokenKey)
+	require.Empty(t, changed.CacheTTL, "caller's config must not be modified")
+
+	// invalid settings are rejected, the current profile is kept
+	invalid := changed
+	invalid.CacheTTL = "bogus"
+	require.ErrorContains(t, InitializeProfile("tenant_r", &invalid), "cache_ttl")
+	cur, err := getProfile("tenant_r")
+	require.NoError(t, err)
+	require.Same(t, p, cur)
+}
@@ -2,46 +2,96 @@ package circonus
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/circonus-labs/go-apiclient"
 	apiclicfg "github.com/circonus-labs/go-apiclient/config"
+	"github.com/circonus-labs/go-trapmetrics"
 )
 
 // Check bundle config caching
 
-// loadCheckConfig will determine if caching is enabled and attempt to load the check bundle, returns check bundle and whether successful.
-func loadCheckConfig(id string) (*apiclient.CheckBundle, bool) {
+const defaultCacheTTL = 24 * time.Hour
+
+// CachedCheck is a check bundle saved in the cache directory along with when it
+// was fetched from the API.
+type CachedCheck struct {
+	Fetched time.Time              `json:"fetched"`
+	Bundle  *apiclient.CheckBundle `json:"bundle"`
+	Err     error                  `json:"-"` // the cache file could not be read
+	Key     string                 `json:"-"` // destination key, as used in the file name
+	Path    string                 `json:"-"`
+}
+
+// Stale indicates whether the cached check is older than the ttl, a ttl of zero never expires.
+func (cc *CachedCheck) Stale(ttl time.Duration) bool {
+	return ttl > 0 && time.Since(cc.Fetched) > ttl
+}
+
+func cacheFile(dir, id string) string {
+	return filepath.Join(dir, strings.ReplaceAll(id, ":", "_")+".json")
+}
+
+// readCachedCheck reads a cache file, bundles cached by earlier versions of the agent
+// (a bare check bundle) have no fetch time so they are always stale.
+func readCachedCheck(path string) (*CachedCheck, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var cc CachedCheck
+	if err := json.Unmarshal(data, &cc); err != nil {
+		return nil, fmt.Errorf("parsing check config %s: %w", path, err)
+	}
+	if cc.Bundle == nil {
+		var bundle apiclient.CheckBundle
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			return nil, fmt.Errorf("parsing check config %s: %w", path, err)
+		}
+		cc = CachedCheck{Bundle: &bundle}
+	}
+	if cc.Bundle.CID == "" || len(cc.Bundle.CheckUUIDs) == 0 || len(cc.Bundle.Brokers) == 0 {
+		return nil, fmt.Errorf("parsing check config %s: incomplete check bundle", path)
+	}
+	cc.Path = path
+	cc.Key = strings.TrimSuffix(filepath.Base(path), ".json")
+
+	return &cc, nil
+}
+
+// loadCheckConfig will determine if caching is enabled and attempt to load the check bundle, returns the cached check or nil.
+func (ch *Circonus) loadCheckConfig(id string) *CachedCheck {
 	if !ch.circCfg.CacheConfigs {
-		return nil, false
+		return nil
 	}
 	if id == "" || ch.circCfg.CacheDir == "" {
-		return nil, false
+		return nil
 	}
 
-	path := ch.circCfg.CacheDir
-	checkConfigFile := filepath.Join(path, strings.ReplaceAll(id, ":", "_")+".json")
+	checkConfigFile := cacheFile(ch.circCfg.CacheDir, id)
 
-	data, err := os.ReadFile(checkConfigFile)
+	cc, err := readCachedCheck(checkConfigFile)
 	if err != nil {
 		ch.logger.Warnf("unable to read %s: %s", checkConfigFile, err)
-		return nil, false
-	}
-
-	var bundle apiclient.CheckBundle
-	if err := json.Unmarshal(data, &bundle); err != nil {
-		ch.logger.Warnf("parsing check config %s: %s", checkConfigFile, err)
-		return nil, false
+		return nil
 	}
-	ch.logger.Infof("using cached config: %s - %s", checkConfigFile, bundle.Config[apiclicfg.SubmissionURL])
+	ch.logger.Infof("using cached config: %s - %s", checkConfigFile, cc.Bundle.Config[apiclicfg.SubmissionURL])
 
-	return &bundle, true
+	return cc
 }
 
 // saveCheckConfig will determine if caching is enabled and attempt to save the check bundle as a json blob.
-func saveCheckConfig(id string, bundle *apiclient.CheckBundle) {
+func (ch *Circonus) saveCheckConfig(id string, bundle *apiclient.CheckBundle) {
 	if !ch.circCfg.CacheConfigs {
 		return
 	}
@@ -52,10 +102,9 @@ func saveCheckConfig(id string, bundle *apiclient.CheckBundle) {
 		return
 	}
 
-	path := ch.circCfg.CacheDir
-	checkConfigFile := filepath.Join(path, strings.ReplaceAll(id, ":", "_")+".json")
+	checkConfigFile := cacheFile(ch.circCfg.CacheDir, id)
 
-	data, err := json.Marshal(bundle)
+	data, err := json.Marshal(&CachedCheck{Fetched: time.Now(), Bundle: bundle})
 	if err != nil {
 		ch.logger.Warnf("marshal check conf: %s", err)
 		return
@@ -67,3 +116,211 @@ func saveCheckConfig(id string, bundle *apiclient.CheckBundle) {
 	}
 	ch.logger.Infof("saved check config to cache: %s", checkConfigFile)
 }
+
+// purgeCheckConfig removes a check bundle from the cache, e.g. the check was deleted.
+func (ch *Circonus) purgeCheckConfig(id string) {
+	if !ch.circCfg.CacheConfigs {
+		return
+	}
+	if id == "" || ch.circCfg.CacheDir == "" {
+		return
+	}
+
+	checkConfigFile := cacheFile(ch.circCfg.CacheDir, id)
+	if err := os.Remove(checkConfigFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		ch.logger.Warnf("purge check conf %s: %s", checkConfigFile, err)
+		return
+	}
+	ch.logger.Infof("purged check config from cache: %s", checkConfigFile)
+}
+
+// submitStatusRx finds the http status in an error from the broker ("404 Not Found - url")
+// or the api ("API response code 404: ..."), a port (":443:") is not a status.
+var submitStatusRx = regexp.MustCompile(`(?:^|[^0-9.:])([1-5][0-9]{2})(?: [A-Z]|:)`)
+
+// SubmitStatus returns the http status of a failed submission to the broker, or
+// request to the API, zero when the request did not get a response (e.g. connection
+// refused, timeout) or the error is not from a request.
+func SubmitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	m := submitStatusRx.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	status, _ := strconv.Atoi(m[1])
+	return status
+}
+
+// IsCheckGone indicates whether an error from the API, or the broker, means the check
+// no longer exists or is no longer accessible (deleted, moved to another account, etc.).
+func IsCheckGone(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch SubmitStatus(err) {
+	case http.StatusNotFound, http.StatusForbidden:
+		return true
+	}
+	return strings.Contains(err.Error(), "check bundle deleted")
+}
+
+// CacheTTL returns the age after which the profile's cached checks are revalidated,
+// zero if caching is disabled or cached checks never expire.
+func CacheTTL(profile string) time.Duration {
+	ch, err := getProfile(profile)
+	if err != nil || !ch.circCfg.CacheConfigs {
+		return 0
+	}
+	return ch.cacheTTL
+}
+
+// checkRefresher is a trap whose check bundle can be refreshed from the API, a
+// *trapcheck.TrapCheck or a *failoverTrap (which serializes the refresh with its
+// submissions and check moves).
+type checkRefresher interface {
+	RefreshCheckBundle() (apiclient.CheckBundle, error)
+}
+
+// RevalidateCachedCheck refreshes the cached copy of a destination's check bundle from
+// the API when it is older than the cache ttl. If the check no longer exists it is
+// removed from the cache and the returned error satisfies IsCheckGone. The caller must
+// not submit metrics to the trap concurrently.
+func RevalidateCachedCheck(profile, destKey string, trap trapmetrics.Trap) error {
+	ch, err := getProfile(profile)
+	if err != nil {
+		return err
+	}
+	if !ch.circCfg.CacheConfigs || ch.cacheTTL <= 0 {
+		return nil
+	}
+	if _, ok := TrapCheck(trap); !ok {
+		return nil // static submission url
+	}
+	tc, ok := trap.(checkRefresher)
+	if !ok {
+		return nil
+	}
+
+	if cc, err := readCachedCheck(cacheFile(ch.circCfg.CacheDir, destKey)); err == nil && !cc.Stale(ch.cacheTTL) {
+		return nil
+	}
+
+	bundle, err := tc.RefreshCheckBundle()
+	if err == nil && bundle.Status == "deleted" {
+		err = fmt.Errorf("check bundle deleted (%s)", bundle.CID)
+	}
+	if err != nil {
+		if IsCheckGone(err) {
+			ch.purgeCheckConfig(destKey)
+		}
+		return fmt.Errorf("revalidating cached check: %w", err)
+	}
+	ch.saveCheckConfig(destKey, &bundle)
+
+	return nil
+}
+
+// PurgeCachedCheck removes a destination's check bundle from the profile's cache.
+func PurgeCachedCheck(profile, destKey string) error {
+	ch, err := getProfile(profile)
+	if err != nil {
+		return err
+	}
+	ch.purgeCheckConfig(destKey)
+	return nil
+}
+
+// ListCachedChecks returns the checks in the profile's cache directory ordered by key,
+// files which could not be read are included with Err set.
+func ListCachedChecks(profile string) ([]*CachedCheck, error) {
+	ch, err := getProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	if ch.circCfg.CacheDir == "" {
+		return nil, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(ch.circCfg.CacheDir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("listing check cache: %w", err)
+	}
+	sort.Strings(files)
+
+	checks := make([]*CachedCheck, 0, len(files))
+	for _, file := range files {
+		cc, err := readCachedCheck(file)
+		if err != nil {
+			cc = &CachedCheck{
+				Err:  err,
+				Key:  strings.TrimSuffix(filepath.Base(file), ".json"),
+				Path: file,
+			}
+		}
+		checks = append(checks, cc)
+	}
+
+	return checks, nil
+}
+
+// VerifyCachedCheck fetches a cached check's bundle from the API and reports whether it
+// still exists and matches the cached copy (submission url and brokers).
+func VerifyCachedCheck(profile string, cc *CachedCheck) error {
+	if cc.Err != nil {
+		return cc.Err
+	}
+	ch, err := getProfile(profile)
+	if err != nil {
+		return err
+	}
+	client, err := ch.getAPIClient(nil)
+	if err != nil {
+		return err
+	}
+
+	cid := cc.Bundle.CID
+	bundle, err := client.FetchCheckBundle(&cid)
+	if err != nil {
+		return fmt.Errorf("fetching check bundle %s: %w", cid, err)
+	}
+	if bundle.Status == "deleted" {
+		return fmt.Errorf("check bundle deleted (%s)", cid)
+	}
+	if bundle.Config[apiclicfg.SubmissionURL] != cc.Bundle.Config[apiclicfg.SubmissionURL] {
+		return fmt.Errorf("submission url changed (%s)", cid)
+	}
+	if strings.Join(bundle.Brokers, ",") != strings.Join(cc.Bundle.Brokers, ",") {
+		return fmt.Errorf("moved to broker(s) %s (%s)", strings.Join(bundle.Brokers, ","), cid)
+	}
+
+	return nil
+}
+
+// PurgeCachedChecks removes cached checks from the profile's cache directory, all of
+// them when no keys are given. Returns the number removed.
+func PurgeCachedChecks(profile string, keys []string) (int, error) {
+	checks, err := ListCachedChecks(profile)
+	if err != nil {
+		return 0, err
+	}
+
+	purge := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		purge[strings.ReplaceAll(key, ":", "_")] = true
+	}
+
+	n := 0
+	for _, cc := range checks {
+		if len(keys) > 0 && !purge[cc.Key] {
+			continue
+		}
+		if err := os.Remove(cc.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return n, fmt.Errorf("purging %s: %w", cc.Path, err)
+		}
+		n++
+	}
+
+	return n, nil
+}
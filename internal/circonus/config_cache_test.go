@@ -0,0 +1,87 @@
+package circonus
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/circonus-labs/go-apiclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckConfigCache(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, InitializeProfile("cache", &config.CirconusConfig{
+		APIToken:     "token",
+		CacheConfigs: true,
+		CacheDir:     dir,
+		CacheTTL:     "1h",
+	}))
+	ch, err := getProfile("cache")
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, CacheTTL("cache"))
+
+	bundle := &apiclient.CheckBundle{
+		CID:        "/check_bundle/123",
+		CheckUUIDs: []string{"abc"},
+		Brokers:    []string{"/broker/1"},
+	}
+	ch.saveCheckConfig("test:instance", bundle)
+
+	cc := ch.loadCheckConfig("test:instance")
+	require.NotNil(t, cc)
+	require.Equal(t, "/check_bundle/123", cc.Bundle.CID)
+	require.False(t, cc.Stale(time.Hour))
+	require.True(t, cc.Stale(time.Nanosecond))
+	require.False(t, cc.Stale(0))
+
+	// bundles cached by earlier versions have no fetch time
+	legacy := `{"_cid":"/check_bundle/456","_check_uuids":["def"],"brokers":["/broker/2"]}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "legacy_instance.json"), []byte(legacy), 0o600))
+	cc = ch.loadCheckConfig("legacy:instance")
+	require.NotNil(t, cc)
+	require.Equal(t, "/check_bundle/456", cc.Bundle.CID)
+	require.True(t, cc.Stale(time.Hour))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{}`), 0o600))
+	checks, err := ListCachedChecks("cache")
+	require.NoError(t, err)
+	require.Len(t, checks, 3)
+	require.Equal(t, "bad", checks[0].Key)
+	require.Error(t, checks[0].Err)
+	require.Equal(t, "legacy_instance", checks[1].Key)
+	require.Equal(t, "test_instance", checks[2].Key)
+
+	require.NoError(t, PurgeCachedCheck("cache", "test:instance"))
+	require.Nil(t, ch.loadCheckConfig("test:instance"))
+
+	n, err := PurgeCachedChecks("cache", []string{"legacy:instance"})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	n, err = PurgeCachedChecks("cache", nil)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	checks, err = ListCachedChecks("cache")
+	require.NoError(t, err)
+	require.Empty(t, checks)
+}
+
+func TestSubmitStatus(t *testing.T) {
+	require.Equal(t, 404, SubmitStatus(errors.New("unable to refresh: 404 Not Found - https://broker:43191/module/httptrap/uuid/secret")))
+	require.Equal(t, 403, SubmitStatus(errors.New("API response code 403: forbidden")))
+	require.Equal(t, 503, SubmitStatus(errors.New("submitting metrics: 503 Service Unavailable: ")))
+	require.Zero(t, SubmitStatus(errors.New("making request: dial tcp 10.0.0.1:43191: connect: connection refused")))
+	require.Zero(t, SubmitStatus(errors.New("making request: dial tcp 10.0.0.1:443: connect: connection refused")))
+	require.Zero(t, SubmitStatus(nil))
+}
+
+func TestIsCheckGone(t *testing.T) {
+	require.False(t, IsCheckGone(nil))
+	require.False(t, IsCheckGone(errors.New("making request: connection refused")))
+	require.True(t, IsCheckGone(errors.New("API response code 404: not found")))
+	require.True(t, IsCheckGone(errors.New("403 Forbidden - https://broker/module/httptrap/uuid/secret")))
+	require.False(t, IsCheckGone(errors.New("503 Service Unavailable - https://broker/module/httptrap/uuid/secret")))
+}
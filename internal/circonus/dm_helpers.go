@@ -28,7 +28,13 @@ func AddMetricToDest(dest *trapmetrics.TrapMetrics, pluginID, metricGroup, metri
 	return nil
 }
 
-func UpdateCheckTags(ctx context.Context, dest *trapmetrics.TrapMetrics) error {
+// UpdateCheckTags updates the tags of a direct metrics destination's check, the
+// updated check bundle is cached in the profile the check belongs to.
+func UpdateCheckTags(ctx context.Context, profile string, dest *trapmetrics.TrapMetrics) error {
+	ch, err := getProfile(profile)
+	if err != nil {
+		return err
+	}
 
 	b, err := dest.UpdateCheckTags(ctx)
 	if err != nil {
@@ -37,7 +43,7 @@ func UpdateCheckTags(ctx context.Context, dest *trapmetrics.TrapMetrics) error {
 
 	// bundle will be nil if no updates were needed
 	if b != nil {
-		saveCheckConfig(dest.TrapID(), b)
+		ch.saveCheckConfig(dest.TrapID(), b)
 	}
 
 	return nil
@@ -0,0 +1,109 @@
+package circonus
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/go-apiclient"
+)
+
+// checkSpec is the part of a check bundle derived from the agent config, it is
+// reconciled with the live check bundle when reconcile_checks is enabled.
+type checkSpec struct {
+	DisplayName   string
+	Target        string
+	Tags          []string
+	MetricFilters [][]string // nil, the filters are not managed
+}
+
+// ReconcileEnabled indicates whether the profile reconciles checks with the config
+// (reconcile_checks or reconcile_dry_run).
+func ReconcileEnabled(profile string) bool {
+	ch, err := getProfile(profile)
+	if err != nil {
+		return false
+	}
+	return ch.circCfg.ReconcileChecks || ch.circCfg.ReconcileDryRun
+}
+
+// diffCheck returns the bundle updated to match the spec and a description of each
+// change, tags are only added or modified (tags added out-of-band are kept).
+func diffCheck(bundle *apiclient.CheckBundle, spec *checkSpec) (*apiclient.CheckBundle, []string) {
+	updated := *bundle
+	var changes []string
+
+	if spec.DisplayName != "" && spec.DisplayName != bundle.DisplayName {
+		changes = append(changes, fmt.Sprintf("display_name %q -> %q", bundle.DisplayName, spec.DisplayName))
+		updated.DisplayName = spec.DisplayName
+	}
+	if spec.Target != "" && spec.Target != bundle.Target {
+		changes = append(changes, fmt.Sprintf("target %q -> %q", bundle.Target, spec.Target))
+		updated.Target = spec.Target
+	}
+
+	tags := append([]string{}, bundle.Tags...)
+	tagsChanged := false
+	for _, tag := range spec.Tags {
+		cat, _, hasValue := strings.Cut(tag, ":")
+		found := false
+		for i, ctag := range tags {
+			if ctag == tag {
+				found = true
+				break
+			}
+			ccat, _, cHasValue := strings.Cut(ctag, ":")
+			if hasValue && cHasValue && cat == ccat {
+				changes = append(changes, fmt.Sprintf("tag %q -> %q", ctag, tag))
+				tags[i] = tag
+				tagsChanged = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			changes = append(changes, fmt.Sprintf("tag + %q", tag))
+			tags = append(tags, tag)
+			tagsChanged = true
+		}
+	}
+	if tagsChanged {
+		sort.Strings(tags)
+		updated.Tags = tags
+	}
+
+	if spec.MetricFilters != nil && !reflect.DeepEqual(spec.MetricFilters, bundle.MetricFilters) {
+		changes = append(changes, fmt.Sprintf("metric_filters %v -> %v", bundle.MetricFilters, spec.MetricFilters))
+		updated.MetricFilters = spec.MetricFilters
+	}
+
+	return &updated, changes
+}
+
+// reconcileCheck applies the differences between the spec and the check bundle through
+// the API, with dryRun the differences are only logged. Returns the updated bundle, nil
+// if it was not changed.
+func reconcileCheck(client *apiclient.API, bundle *apiclient.CheckBundle, spec *checkSpec, dryRun bool, logger cua.Logger) (*apiclient.CheckBundle, error) {
+	updated, changes := diffCheck(bundle, spec)
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	if dryRun {
+		for _, change := range changes {
+			logger.Infof("reconcile dry-run, check %s would update %s", bundle.CID, change)
+		}
+		return nil, nil
+	}
+
+	for _, change := range changes {
+		logger.Infof("reconcile check %s, updating %s", bundle.CID, change)
+	}
+	b, err := client.UpdateCheckBundle(updated)
+	if err != nil {
+		return nil, fmt.Errorf("reconcile check %s: %w", bundle.CID, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,48 @@
+package circonus
+
+import (
+	"testing"
+
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/circonus-labs/go-apiclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffCheck(t *testing.T) {
+	bundle := &apiclient.CheckBundle{
+		CID:           "/check_bundle/123",
+		DisplayName:   "host ping",
+		Target:        "host",
+		Tags:          []string{"_plugin_id:ping", "team:red", "manual"},
+		MetricFilters: [][]string{{"allow", ".", ""}},
+	}
+
+	// in sync, unmanaged metric filters and out-of-band tags are kept
+	updated, changes := diffCheck(bundle, &checkSpec{
+		DisplayName: "host ping",
+		Target:      "host",
+		Tags:        []string{"_plugin_id:ping"},
+	})
+	require.Empty(t, changes)
+	require.Equal(t, bundle.Tags, updated.Tags)
+
+	updated, changes = diffCheck(bundle, &checkSpec{
+		DisplayName:   "host ping dc1",
+		Target:        "host",
+		Tags:          []string{"_plugin_id:ping", "team:blue", "env:prod"},
+		MetricFilters: [][]string{{"deny", "^debug_", ""}, {"allow", ".", ""}},
+	})
+	require.Len(t, changes, 4)
+	require.Equal(t, "host ping dc1", updated.DisplayName)
+	require.Equal(t, []string{"_plugin_id:ping", "env:prod", "manual", "team:blue"}, updated.Tags)
+	require.Equal(t, [][]string{{"deny", "^debug_", ""}, {"allow", ".", ""}}, updated.MetricFilters)
+
+	// the original is not modified
+	require.Equal(t, "host ping", bundle.DisplayName)
+	require.Equal(t, []string{"_plugin_id:ping", "team:red", "manual"}, bundle.Tags)
+
+	// dry-run makes no api calls
+	b, err := reconcileCheck(nil, bundle, &checkSpec{DisplayName: "renamed"}, true, testutil.Logger{})
+	require.NoError(t, err)
+	require.Nil(t, b)
+}
@@ -0,0 +1,253 @@
+package circonus
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal/release"
+	"github.com/circonus-labs/go-apiclient"
+)
+
+// Check retirement, checks the agent created for plugin instances which have been
+// removed from the config are tagged as retired or deactivated (retire_checks).
+
+const (
+	RetireOff        = ""
+	RetireLog        = "log"        // only log the checks which would be retired
+	RetireTag        = "tag"        // add a _retired:<date> tag to the check
+	RetireDeactivate = "deactivate" // tag and disable the check
+
+	retiredTagCategory = "_retired"
+
+	// retireChecksDelay is how long after startup, or a reload, checks are retired; the
+	// configured plugins' destinations have been initialized by then, so checks in use
+	// are known even if a plugin's id differs from its check's _plugin_id tag.
+	retireChecksDelay = 5 * time.Minute
+)
+
+// PluginInstance identifies a configured plugin instance, checks are retired when
+// their _plugin_id and _instance_id tags do not match a configured instance.
+type PluginInstance struct {
+	PluginID   string
+	InstanceID string
+}
+
+func (pi PluginInstance) key() string {
+	return pi.PluginID + ":" + strings.ToLower(pi.InstanceID)
+}
+
+var (
+	retireTimer   *time.Timer
+	retireTimermu sync.Mutex
+)
+
+// validateRetireChecks returns an error if the retire_checks setting is invalid.
+func validateRetireChecks(mode string) error {
+	switch mode {
+	case RetireOff, RetireLog, RetireTag, RetireDeactivate:
+		return nil
+	}
+	return fmt.Errorf("retire_checks: invalid setting %q (log, tag, deactivate)", mode)
+}
+
+// ScheduleRetireChecks retires, in each profile with retire_checks set, the checks of
+// plugin instances not in the configured instances. It runs in the background after a
+// delay, a later call (e.g. another reload) replaces a pending one.
+func ScheduleRetireChecks(instances []PluginInstance) {
+	retireTimermu.Lock()
+	defer retireTimermu.Unlock()
+
+	if retireTimer != nil {
+		retireTimer.Stop()
+	}
+	retireTimer = time.AfterFunc(retireChecksDelay, func() {
+		profilesmu.RLock()
+		chs := make([]*Circonus, 0, len(profiles))
+		for _, ch := range profiles {
+			chs = append(chs, ch)
+		}
+		profilesmu.RUnlock()
+
+		for _, ch := range chs {
+			if ch.circCfg.RetireChecks == RetireOff {
+				continue
+			}
+			if _, err := ch.retireChecks(instances); err != nil {
+				ch.logger.Warnf("retire checks: %s", err)
+			}
+		}
+	})
+}
+
+// trackOwned records a check in use by a metric destination, checks in use by a configured
+// plugin instance are never retired.
+func (ch *Circonus) trackOwned(cid string, meta MetricMeta) {
+	ch.ownedmu.Lock()
+	defer ch.ownedmu.Unlock()
+	if ch.owned == nil {
+		ch.owned = make(map[string]MetricMeta)
+	}
+	ch.owned[cid] = meta
+}
+
+// isOwned indicates whether a check is in use by the destination of a configured instance,
+// instanceIDs are the lower cased instance ids configured. The destinations of instances
+// removed by a reload remain until the agent restarts, their checks are no longer in use.
+func (ch *Circonus) isOwned(cid string, instanceIDs map[string]bool) bool {
+	ch.ownedmu.Lock()
+	defer ch.ownedmu.Unlock()
+	meta, ok := ch.owned[cid]
+	return ok && instanceIDs[strings.ToLower(meta.InstanceID)]
+}
+
+func (ch *Circonus) disown(cid string) {
+	ch.ownedmu.Lock()
+	defer ch.ownedmu.Unlock()
+	delete(ch.owned, cid)
+}
+
+// retireChecks finds the agent's checks (this check target, tagged _service:circonus-unified-agent)
+// which do not correspond to a configured plugin instance and retires them according to
+// retire_checks. Returns the number of checks retired (or which would be, with log).
+func (ch *Circonus) retireChecks(instances []PluginInstance) (int, error) {
+	client, err := ch.getAPIClient(nil)
+	if err != nil {
+		return 0, err
+	}
+
+	query := apiclient.SearchQueryType(fmt.Sprintf(`(active:1)(host:"%s")(tags:_service:%s)`, ch.circCfg.CheckTarget, release.NAME))
+	bundles, err := client.SearchCheckBundles(&query, nil)
+	if err != nil {
+		return 0, fmt.Errorf("searching for checks (%s): %w", query, err)
+	}
+	if bundles == nil {
+		return 0, nil
+	}
+
+	configured := make(map[string]bool, len(instances))
+	instanceIDs := make(map[string]bool, len(instances))
+	for _, pi := range instances {
+		configured[pi.key()] = true
+		instanceIDs[strings.ToLower(pi.InstanceID)] = true
+	}
+
+	retired := 0
+	for i := range *bundles {
+		bundle := &(*bundles)[i]
+		if !retirable(bundle, configured) || ch.isOwned(bundle.CID, instanceIDs) {
+			continue
+		}
+		pi := PluginInstance{PluginID: checkTagValue(bundle.Tags, "_plugin_id"), InstanceID: checkTagValue(bundle.Tags, "_instance_id")}
+		if ch.circCfg.RetireChecks == RetireLog {
+			ch.logger.Infof("retire checks: check %s (%s) plugin %s instance %s is not configured, would retire", bundle.CID, bundle.DisplayName, pi.PluginID, pi.InstanceID)
+			retired++
+			continue
+		}
+		if err := retireCheck(client, bundle, ch.circCfg.RetireChecks == RetireDeactivate, time.Now()); err != nil {
+			ch.logger.Warnf("retire checks: %s", err)
+			continue
+		}
+		ch.logger.Infof("retire checks: retired (%s) check %s (%s) plugin %s instance %s, not configured", ch.circCfg.RetireChecks, bundle.CID, bundle.DisplayName, pi.PluginID, pi.InstanceID)
+		ch.purgeCachedCID(bundle.CID)
+		ch.disown(bundle.CID)
+		retired++
+	}
+
+	return retired, nil
+}
+
+// retirable indicates whether a check belongs to a plugin instance which is not configured,
+// the agent and host checks and checks already retired are not retirable.
+func retirable(bundle *apiclient.CheckBundle, configured map[string]bool) bool {
+	if isRetired(bundle) {
+		return false
+	}
+	pluginID := checkTagValue(bundle.Tags, "_plugin_id")
+	instanceID := checkTagValue(bundle.Tags, "_instance_id")
+	if pluginID == "" || instanceID == "" {
+		return false // not created by the agent
+	}
+	if pluginID == "agent" || pluginID == "host" {
+		return false
+	}
+	return !configured[PluginInstance{PluginID: pluginID, InstanceID: instanceID}.key()]
+}
+
+// retireCheck tags the check as retired, and disables it with deactivate.
+func retireCheck(client *apiclient.API, bundle *apiclient.CheckBundle, deactivate bool, now time.Time) error {
+	updated := *bundle
+	updated.Tags = append(append([]string{}, bundle.Tags...), retiredTagCategory+":"+now.UTC().Format("2006-01-02"))
+	sort.Strings(updated.Tags)
+	if deactivate {
+		updated.Status = "disabled"
+	}
+	if _, err := client.UpdateCheckBundle(&updated); err != nil {
+		return fmt.Errorf("retiring check %s: %w", bundle.CID, err)
+	}
+	return nil
+}
+
+// unretireCheck removes the retired tag from a check in use again (the plugin instance was
+// added back to the config), re-enabling it if it was deactivated.
+func unretireCheck(client *apiclient.API, bundle *apiclient.CheckBundle, logger cua.Logger) (*apiclient.CheckBundle, error) {
+	updated := *bundle
+	updated.Tags = make([]string, 0, len(bundle.Tags))
+	for _, tag := range bundle.Tags {
+		if cat, _, _ := strings.Cut(tag, ":"); cat != retiredTagCategory {
+			updated.Tags = append(updated.Tags, tag)
+		}
+	}
+	if updated.Status == "disabled" {
+		updated.Status = "active"
+	}
+	logger.Infof("check %s was retired, the plugin instance is configured again, reactivating", bundle.CID)
+	b, err := client.UpdateCheckBundle(&updated)
+	if err != nil {
+		return nil, fmt.Errorf("reactivating retired check %s: %w", bundle.CID, err)
+	}
+	return b, nil
+}
+
+// isRetired indicates whether the check was retired by the agent.
+func isRetired(bundle *apiclient.CheckBundle) bool {
+	for _, tag := range bundle.Tags {
+		if cat, _, _ := strings.Cut(tag, ":"); cat == retiredTagCategory {
+			return true
+		}
+	}
+	return false
+}
+
+// checkTagValue returns the value of the first check tag in the category.
+func checkTagValue(tags []string, category string) string {
+	for _, tag := range tags {
+		if cat, val, ok := strings.Cut(tag, ":"); ok && cat == category {
+			return val
+		}
+	}
+	return ""
+}
+
+// purgeCachedCID removes a retired check from the cache, the cache files are keyed by
+// destination (MetricMeta.Key()) so the cached checks are matched by cid.
+func (ch *Circonus) purgeCachedCID(cid string) {
+	if !ch.circCfg.CacheConfigs || ch.circCfg.CacheDir == "" {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(ch.circCfg.CacheDir, "*.json"))
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		cc, err := readCachedCheck(file)
+		if err != nil || cc.Bundle.CID != cid {
+			continue
+		}
+		ch.purgeCheckConfig(cc.Key)
+	}
+}
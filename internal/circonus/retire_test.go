@@ -0,0 +1,95 @@
+package circonus
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/circonus-labs/go-apiclient"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetireChecks(t *testing.T) {
+	bundles := []apiclient.CheckBundle{
+		{CID: "/check_bundle/1", Tags: []string{"_plugin_id:ping", "_instance_id:dc1"}},
+		{CID: "/check_bundle/2", Tags: []string{"_plugin_id:ping", "_instance_id:dc2"}},
+		{CID: "/check_bundle/3", Tags: []string{"_plugin_id:host", "_instance_id:host"}},
+		{CID: "/check_bundle/4", Tags: []string{"_plugin_id:snmp", "_instance_id:sw1", "_retired:2026-01-01"}},
+		{CID: "/check_bundle/5", Tags: []string{"_plugin_id:snmp", "_instance_id:sw2"}},
+		{CID: "/check_bundle/6", Tags: []string{"team:red"}},
+	}
+
+	var mu sync.Mutex
+	updated := make(map[string]apiclient.CheckBundle)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			require.Contains(t, r.URL.Query().Get("search"), `(host:"host1")`)
+			_ = json.NewEncoder(w).Encode(bundles)
+		case http.MethodPut:
+			var b apiclient.CheckBundle
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&b))
+			mu.Lock()
+			updated[b.CID] = b
+			mu.Unlock()
+			_ = json.NewEncoder(w).Encode(b)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer srv.Close()
+
+	ch := &Circonus{
+		circCfg: &config.CirconusConfig{CheckTarget: "host1", RetireChecks: RetireDeactivate},
+		apiCfg:  &apiclient.Config{TokenKey: "token", URL: srv.URL},
+		logger:  testutil.Logger{},
+	}
+	// in use, e.g. a plugin id differing from the input name
+	ch.trackOwned("/check_bundle/5", MetricMeta{PluginID: "snmp", InstanceID: "SW2"})
+
+	instances := []PluginInstance{{PluginID: "ping", InstanceID: "DC1"}, {PluginID: "snmp_lldp", InstanceID: "SW2"}}
+
+	// log only
+	ch.circCfg.RetireChecks = RetireLog
+	n, err := ch.retireChecks(instances)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Empty(t, updated)
+
+	ch.circCfg.RetireChecks = RetireDeactivate
+	n, err = ch.retireChecks(instances)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Len(t, updated, 1)
+	b := updated["/check_bundle/2"]
+	require.Equal(t, "disabled", b.Status)
+	require.True(t, isRetired(&b))
+	require.True(t, strings.HasPrefix(b.Tags[0], "_instance_id:"))
+
+	// reactivated when the instance is configured again
+	client, err := ch.getAPIClient(nil)
+	require.NoError(t, err)
+	reactivated, err := unretireCheck(client, &b, testutil.Logger{})
+	require.NoError(t, err)
+	require.Equal(t, "active", reactivated.Status)
+	require.False(t, isRetired(reactivated))
+
+	// the instance using check 5 was removed by a reload, its destination remains
+	// but the check is no longer in use
+	_, err = ch.retireChecks(instances[:1])
+	require.NoError(t, err)
+	require.Contains(t, updated, "/check_bundle/5")
+	require.False(t, ch.isOwned("/check_bundle/5", map[string]bool{"sw2": true}))
+}
+
+func TestValidateRetireChecks(t *testing.T) {
+	for _, mode := range []string{"", "log", "tag", "deactivate"} {
+		require.NoError(t, validateRetireChecks(mode))
+	}
+	require.Error(t, validateRetireChecks("delete"))
+}
@@ -0,0 +1,189 @@
+package circonus
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/go-apiclient"
+	"github.com/circonus-labs/go-trapcheck"
+	"github.com/circonus-labs/go-trapmetrics"
+)
+
+const (
+	defaultStaticSubmissionTimeout = 10 * time.Second
+	staticCompressionThreshold     = 1024
+)
+
+// staticTrap submits metrics to a fixed broker submission url, without using the
+// Circonus API to find or create a check, for sites where only the broker's
+// httptrap endpoint is reachable.
+type staticTrap struct {
+	client *http.Client
+	url    string
+}
+
+// newStaticTrap returns a trap for the submission url. When a broker CA file is
+// given the broker certificate is verified against it, the host name is not
+// checked as broker certificates are issued for the broker's CN rather than the
+// address used to reach it.
+func newStaticTrap(submissionURL, brokerCAFile, timeout string) (*staticTrap, error) {
+	u, err := url.Parse(submissionURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing submission url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid submission url scheme (%s)", u.Scheme)
+	}
+
+	to := defaultStaticSubmissionTimeout
+	if timeout != "" {
+		to, err = time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("parsing submission timeout (%s): %w", timeout, err)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if brokerCAFile != "" {
+		cert, err := os.ReadFile(brokerCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load broker ca file (%s): %w", brokerCAFile, err)
+		}
+		cp := x509.NewCertPool()
+		if !cp.AppendCertsFromPEM(cert) {
+			return nil, fmt.Errorf("unable to parse broker ca file (%s)", brokerCAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{
+			InsecureSkipVerify: true, //nolint:gosec // the chain is verified in VerifyConnection
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				return verifyBrokerCert(cs, cp)
+			},
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	return &staticTrap{
+		client: &http.Client{Transport: transport, Timeout: to},
+		url:    submissionURL,
+	}, nil
+}
+
+func verifyBrokerCert(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("broker presented no certificates")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		return fmt.Errorf("verifying broker certificate: %w", err)
+	}
+	return nil
+}
+
+// SendMetrics submits httptrap json metrics to the submission url.
+func (t *staticTrap) SendMetrics(ctx context.Context, metrics bytes.Buffer) (*trapcheck.TrapResult, error) {
+	if metrics.Len() == 0 {
+		return nil, fmt.Errorf("zero length data, no metrics to submit")
+	}
+
+	start := time.Now()
+	result := &trapcheck.TrapResult{BytesSent: metrics.Len()}
+
+	var body bytes.Buffer
+	compressed := metrics.Len() > staticCompressionThreshold
+	if compressed {
+		zw := gzip.NewWriter(&body)
+		if _, err := zw.Write(metrics.Bytes()); err != nil {
+			return nil, fmt.Errorf("compressing metrics: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("compressing metrics: %w", err)
+		}
+		result.BytesSentGzip = body.Len()
+	} else {
+		body = metrics
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.url, &body)
+	if err != nil {
+		return nil, fmt.Errorf("creating submission request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("submitting metrics: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading submission response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("submitting metrics: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	if err := json.Unmarshal(data, result); err != nil {
+		return nil, fmt.Errorf("parsing submission response (%s): %w", data, err)
+	}
+	result.SubmitDuration = time.Since(start)
+	result.LastReqDuration = result.SubmitDuration
+
+	return result, nil
+}
+
+// UpdateCheckTags is a no-op, without the API there is no check bundle to update.
+func (t *staticTrap) UpdateCheckTags(_ context.Context, _ []string) (*apiclient.CheckBundle, error) {
+	return nil, nil
+}
+
+// newStaticMetricDestination returns a metric destination submitting to a fixed
+// submission url, check management is skipped entirely.
+func (ch *Circonus) newStaticMetricDestination(opts *MetricDestConfig, logger cua.Logger) (*trapmetrics.TrapMetrics, trapmetrics.Trap, error) {
+	timeout := ch.circCfg.SubmissionTimeout
+	if opts.SubmissionTimeout != "" {
+		timeout = opts.SubmissionTimeout
+	}
+
+	trap, err := newStaticTrap(opts.SubmissionURL, opts.BrokerCAFile, timeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("circonus metric destination management module: %w", err)
+	}
+
+	metrics, err := createMetrics(&trapmetrics.Config{
+		Trap: trap,
+		Logger: &Logshim{
+			logh:   logger,
+			prefix: opts.MetricMeta.Key(),
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Infof("submitting to static submission url, check management disabled")
+
+	return metrics, trap, nil
+}
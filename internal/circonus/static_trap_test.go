@@ -0,0 +1,79 @@
+package circonus
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticMetricDestination(t *testing.T) {
+	var received map[string]interface{}
+	var compressed bool
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		compressed = r.Header.Get("Content-Encoding") == "gzip"
+		if compressed {
+			zr, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = zr
+		}
+		require.NoError(t, json.NewDecoder(body).Decode(&received))
+		_, _ = w.Write([]byte(`{"stats":1}`))
+	}))
+	defer srv.Close()
+
+	// the api is never used, an unreachable api url makes sure of it, and no
+	// api token is needed
+	require.NoError(t, InitializeProfile("static", &config.CirconusConfig{
+		APIURL: "http://127.0.0.1:1/v2",
+	}))
+
+	opts := &MetricDestConfig{
+		Profile:       "static",
+		SubmissionURL: srv.URL + "/module/httptrap/uuid/secret",
+	}
+
+	// broker certificate not trusted
+	metrics, _, err := NewMetricDestinationWithTrap(opts, testutil.Logger{})
+	require.NoError(t, err)
+	require.NoError(t, metrics.GaugeSet("test", nil, 1, nil))
+	_, err = metrics.Flush(context.Background())
+	require.Error(t, err)
+
+	ca := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(ca, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: srv.Certificate().Raw,
+	}), 0o600))
+	opts.BrokerCAFile = ca
+
+	metrics, _, err = NewMetricDestinationWithTrap(opts, testutil.Logger{})
+	require.NoError(t, err)
+	require.NoError(t, metrics.GaugeSet("test", nil, 1, nil))
+	result, err := metrics.Flush(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), result.Stats)
+	require.Contains(t, received, "test")
+	require.False(t, compressed)
+
+	// large payloads are compressed
+	for i := 0; i < 100; i++ {
+		require.NoError(t, metrics.GaugeSet("test_"+strings.Repeat("x", i), nil, i, nil))
+	}
+	_, err = metrics.Flush(context.Background())
+	require.NoError(t, err)
+	require.True(t, compressed)
+	require.Contains(t, received, "test_xxxxx")
+}
@@ -0,0 +1,42 @@
+package secret
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// keyRx restricts the keys of file based stores to file names in the store directory
+var keyRx = regexp.MustCompile(`^[A-Za-z0-9_-][A-Za-z0-9._-]*$`)
+
+// DirectoryStore reads each secret from a file named after its key in a directory
+// (e.g. mounted kubernetes or docker secrets), a trailing newline is removed.
+type DirectoryStore struct {
+	path string
+}
+
+// NewDirectoryStore returns a store for the secret files in path.
+func NewDirectoryStore(path string) (*DirectoryStore, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("secret directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("secret directory: %s is not a directory", path)
+	}
+	return &DirectoryStore{path: path}, nil
+}
+
+// Get returns the contents of the key's file.
+func (d *DirectoryStore) Get(key string) (string, error) {
+	if !keyRx.MatchString(key) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	data, err := os.ReadFile(filepath.Join(d.path, key))
+	if err != nil {
+		return "", fmt.Errorf("reading secret: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
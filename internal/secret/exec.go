@@ -0,0 +1,49 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const defaultExecTimeout = 5 * time.Second
+
+// ExecStore runs a helper command for each secret, with the key as its last argument,
+// the secret is the command's output less a trailing newline.
+type ExecStore struct {
+	command []string
+	timeout time.Duration
+}
+
+// NewExecStore returns a store running command, timeout defaults to 5s.
+func NewExecStore(command []string, timeout time.Duration) (*ExecStore, error) {
+	if len(command) == 0 || command[0] == "" {
+		return nil, fmt.Errorf("secret exec: command not set")
+	}
+	if timeout <= 0 {
+		timeout = defaultExecTimeout
+	}
+	return &ExecStore{command: command, timeout: timeout}, nil
+}
+
+// Get runs the command for the key.
+func (e *ExecStore) Get(key string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	args := append(append([]string{}, e.command[1:]...), key)
+	cmd := exec.CommandContext(ctx, e.command[0], args...) //nolint:gosec
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("running %s: %w (%s)", e.command[0], err, msg)
+		}
+		return "", fmt.Errorf("running %s: %w", e.command[0], err)
+	}
+	return strings.TrimRight(stdout.String(), "\r\n"), nil
+}
@@ -0,0 +1,136 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const keyfileVersion = 1
+
+// keyfile is the on disk format of an encrypted keyfile, the secrets are a JSON
+// object encrypted with AES-256-GCM using a key derived from the passphrase (scrypt).
+type keyfile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// KeyfileStore reads secrets from an encrypted local keyfile.
+type KeyfileStore struct {
+	secrets map[string]string
+}
+
+// NewKeyfileStore decrypts the keyfile at path with the passphrase.
+func NewKeyfileStore(path, passphrase string) (*KeyfileStore, error) {
+	secrets, err := ReadKeyfile(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyfileStore{secrets: secrets}, nil
+}
+
+// Get returns the key's secret.
+func (k *KeyfileStore) Get(key string) (string, error) {
+	v, ok := k.secrets[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found", key)
+	}
+	return v, nil
+}
+
+func keyfileCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("keyfile: passphrase not set")
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("keyfile: deriving key: %w", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("keyfile: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("keyfile: %w", err)
+	}
+	return gcm, nil
+}
+
+// ReadKeyfile decrypts the secrets in a keyfile, a missing keyfile has no secrets.
+func ReadKeyfile(path, passphrase string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, fmt.Errorf("keyfile: %w", err)
+	}
+
+	var kf keyfile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("keyfile %s: %w", path, err)
+	}
+	if kf.Version != keyfileVersion {
+		return nil, fmt.Errorf("keyfile %s: unsupported version %d", path, kf.Version)
+	}
+	gcm, err := keyfileCipher(passphrase, kf.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(kf.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("keyfile %s: invalid nonce", path)
+	}
+	plain, err := gcm.Open(nil, kf.Nonce, kf.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("keyfile %s: decrypting, wrong passphrase or corrupt file", path)
+	}
+
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("keyfile %s: %w", path, err)
+	}
+	return secrets, nil
+}
+
+// WriteKeyfile encrypts the secrets to a keyfile with the passphrase, readable only by its owner.
+func WriteKeyfile(path, passphrase string, secrets map[string]string) error {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("keyfile: %w", err)
+	}
+	gcm, err := keyfileCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("keyfile: %w", err)
+	}
+
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("keyfile: %w", err)
+	}
+	data, err := json.Marshal(&keyfile{
+		Version: keyfileVersion,
+		Salt:    salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plain, nil),
+	})
+	if err != nil {
+		return fmt.Errorf("keyfile: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("keyfile: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Package secret resolves @{store:key} secret references in the configuration
+// through secret stores, and redacts the resolved values from logs and output.
+package secret
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// Redacted replaces secret values in logs and printed configs.
+	Redacted = "<redacted>"
+
+	// minRedactLength, shorter secrets are not redacted, they would mask
+	// unrelated text in every log line
+	minRedactLength = 4
+)
+
+var (
+	// refRx matches a secret reference, @{store:key}
+	refRx = regexp.MustCompile(`@\{([\w-]+):([^{}]+)\}`)
+	// idRx matches a valid store id
+	idRx = regexp.MustCompile(`^[\w-]+$`)
+)
+
+// Store looks up secrets by key.
+type Store interface {
+	Get(key string) (string, error)
+}
+
+// Resolver resolves secret references using its stores, keyed by id.
+type Resolver struct {
+	stores   map[string]Store
+	resolved map[string]string
+}
+
+// NewResolver returns a resolver without stores.
+func NewResolver() *Resolver {
+	return &Resolver{
+		stores:   make(map[string]Store),
+		resolved: make(map[string]string),
+	}
+}
+
+// Add adds a store, the id is the store part of references.
+func (r *Resolver) Add(id string, store Store) error {
+	if !idRx.MatchString(id) {
+		return fmt.Errorf("secret store: invalid id %q", id)
+	}
+	if _, ok := r.stores[id]; ok {
+		return fmt.Errorf("secret store: duplicate id %q", id)
+	}
+	r.stores[id] = store
+	return nil
+}
+
+// HasReference indicates whether the value contains a secret reference.
+func HasReference(s string) bool {
+	return refRx.MatchString(s)
+}
+
+// Resolve replaces the secret references in the value with the secrets, resolved
+// secrets are registered for redaction.
+func (r *Resolver) Resolve(s string) (string, error) {
+	var rerr error
+	resolved := refRx.ReplaceAllStringFunc(s, func(ref string) string {
+		if rerr != nil {
+			return ref
+		}
+		if v, ok := r.resolved[ref]; ok {
+			return v
+		}
+		m := refRx.FindStringSubmatch(ref)
+		store, ok := r.stores[m[1]]
+		if !ok {
+			rerr = fmt.Errorf("secret %s: unknown secret store %q", ref, m[1])
+			return ref
+		}
+		v, err := store.Get(m[2])
+		if err != nil {
+			rerr = fmt.Errorf("secret %s: %w", ref, err)
+			return ref
+		}
+		r.resolved[ref] = v
+		Register(v)
+		return v
+	})
+	if rerr != nil {
+		return "", rerr
+	}
+	return resolved, nil
+}
+
+var (
+	registered = make(map[string]bool)
+	replacer   = strings.NewReplacer()
+	registermu sync.RWMutex
+)
+
+// Register adds a value to be redacted by Redact.
+func Register(value string) {
+	if len(value) < minRedactLength {
+		return
+	}
+
+	registermu.Lock()
+	defer registermu.Unlock()
+
+	if registered[value] {
+		return
+	}
+	registered[value] = true
+
+	values := make([]string, 0, len(registered))
+	for v := range registered {
+		values = append(values, v)
+	}
+	// longest first, a secret containing another is redacted whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	pairs := make([]string, 0, len(values)*2)
+	for _, v := range values {
+		pairs = append(pairs, v, Redacted)
+	}
+	replacer = strings.NewReplacer(pairs...)
+}
+
+// Redact replaces the registered secret values in s.
+func Redact(s string) string {
+	registermu.RLock()
+	r := replacer
+	n := len(registered)
+	registermu.RUnlock()
+	if n == 0 {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// RedactBytes replaces the registered secret values in b.
+func RedactBytes(b []byte) []byte {
+	registermu.RLock()
+	n := len(registered)
+	registermu.RUnlock()
+	if n == 0 {
+		return b
+	}
+	return []byte(Redact(string(b)))
+}
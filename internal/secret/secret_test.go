@@ -0,0 +1,116 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mapStore map[string]string
+
+func (m mapStore) Get(key string) (string, error) {
+	v, ok := m[key]
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	return v, nil
+}
+
+func TestResolve(t *testing.T) {
+	r := NewResolver()
+	require.NoError(t, r.Add("vault", mapStore{"token": "s3cr3t-token", "user": "admin"}))
+	require.Error(t, r.Add("vault", mapStore{}))
+	require.Error(t, r.Add("bad id", mapStore{}))
+
+	require.True(t, HasReference("Bearer @{vault:token}"))
+	require.False(t, HasReference("no reference"))
+
+	v, err := r.Resolve("Bearer @{vault:token} as @{vault:user}")
+	require.NoError(t, err)
+	require.Equal(t, "Bearer s3cr3t-token as admin", v)
+
+	v, err = r.Resolve("plain")
+	require.NoError(t, err)
+	require.Equal(t, "plain", v)
+
+	_, err = r.Resolve("@{other:token}")
+	require.Error(t, err)
+	_, err = r.Resolve("@{vault:missing}")
+	require.Error(t, err)
+}
+
+func TestRedact(t *testing.T) {
+	r := NewResolver()
+	require.NoError(t, r.Add("s", mapStore{"long": "hunter2-password", "short": "abc"}))
+	_, err := r.Resolve("@{s:long} @{s:short}")
+	require.NoError(t, err)
+
+	require.Equal(t, "password=<redacted> user=abc", Redact("password=hunter2-password user=abc"))
+	require.Equal(t, []byte("token <redacted>\n"), RedactBytes([]byte("token hunter2-password\n")))
+
+	Register("hunter2")
+	require.Equal(t, "<redacted> <redacted>", Redact("hunter2-password hunter2"))
+}
+
+func TestDirectoryStore(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api_token"), []byte("abc123\n"), 0600))
+
+	_, err := NewDirectoryStore(filepath.Join(dir, "missing"))
+	require.Error(t, err)
+
+	s, err := NewDirectoryStore(dir)
+	require.NoError(t, err)
+	v, err := s.Get("api_token")
+	require.NoError(t, err)
+	require.Equal(t, "abc123", v)
+
+	_, err = s.Get("../api_token")
+	require.Error(t, err)
+	_, err = s.Get("missing")
+	require.Error(t, err)
+}
+
+func TestKeyfileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.json")
+
+	secrets, err := ReadKeyfile(path, "passphrase")
+	require.NoError(t, err)
+	require.Empty(t, secrets)
+
+	require.NoError(t, WriteKeyfile(path, "passphrase", map[string]string{"api_token": "abc123"}))
+
+	_, err = NewKeyfileStore(path, "wrong")
+	require.Error(t, err)
+
+	s, err := NewKeyfileStore(path, "passphrase")
+	require.NoError(t, err)
+	v, err := s.Get("api_token")
+	require.NoError(t, err)
+	require.Equal(t, "abc123", v)
+	_, err = s.Get("missing")
+	require.Error(t, err)
+}
+
+func TestExecStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+
+	_, err := NewExecStore(nil, 0)
+	require.Error(t, err)
+
+	s, err := NewExecStore([]string{"sh", "-c", `echo "secret-$1"`, "sh"}, 0)
+	require.NoError(t, err)
+	v, err := s.Get("api_token")
+	require.NoError(t, err)
+	require.Equal(t, "secret-api_token", v)
+
+	s, err = NewExecStore([]string{"sh", "-c", "echo failed >&2; exit 1", "sh"}, 0)
+	require.NoError(t, err)
+	_, err = s.Get("api_token")
+	require.Error(t, err)
+}
@@ -12,14 +12,33 @@ Usage:
 The commands & flags are:
 
   config              print out full sample configuration to stdout
+  check-cache <cmd>   manage the circonus check bundle cache (cache_configs):
+                      list, verify (against the API) or purge [keys...]
+  secret-keyfile <cmd> manage an encrypted secret keyfile ([[secretstores.keyfile]]),
+                      passphrase in CUA_SECRET_PASSPHRASE: list <file>,
+                      set <file> <key> (secret read from stdin) or remove <file> <key>
   version             print the version to stdout
 
   --aggregator-filter <filter>   filter the aggregators to enable, separator is :
   --config <file>                configuration file to load
   --config-directory <directory> directory containing additional *.conf files
+  --config-check                 validate the config file and directory, initializing
+                                 each plugin, print any problems found and exit
+  --config-header <header>       header to fetch a remote (http/https) config file with,
+                                 'Name: value', ${VAR} is replaced with the environment
+                                 variable, may be repeated
+  --config-last-known-good <file> local copy of the last remote config loaded, used
+                                 when the server can't be reached at startup
+  --config-poll-interval <dur>   poll a remote config for changes (ETag/Last-Modified)
+                                 and reload automatically when it changes
+  --config-tls-ca <file>         CA to verify the remote config server with
+  --config-tls-cert <file>       client certificate to fetch a remote config with
+  --config-tls-key <file>        client key to fetch a remote config with
   --plugin-directory             directory containing *.so files, this directory will be
                                  searched recursively. Any Plugin found will be loaded
                                  and namespaced.
+  --admin-addr <address>         admin api address to listen on (json introspection of the
+                                 running agent), don't activate the admin api if empty
   --debug                        turn on debug logging
   --input-filter <filter>        filter the inputs to enable, separator is :
   --input-list                   print available input plugins.
@@ -39,6 +58,8 @@ The commands & flags are:
                                  inputs to complete in test or once mode
   --usage <plugin>               print usage for a plugin, ie, 'circonus-unified-agent --usage mysql'
   --version                      display the version and exit
+  --watch-config                 watch the config file and directory for changes and
+                                 reload automatically
 
 Examples:
 
@@ -51,6 +72,9 @@ Examples:
   # run a single collection, outputting metrics to stdout
   circonus-unified-agent --config circonus-unified-agent.conf --test
 
+  # validate the configuration without running the agent
+  circonus-unified-agent --config circonus-unified-agent.conf --config-check
+
   # run with all plugins defined in config file
   circonus-unified-agent --config circonus-unified-agent.conf
 
@@ -10,6 +10,7 @@ import (
 
 	"github.com/circonus-labs/circonus-unified-agent/internal"
 	"github.com/circonus-labs/circonus-unified-agent/internal/rotate"
+	"github.com/circonus-labs/circonus-unified-agent/internal/secret"
 	"github.com/influxdata/wlog"
 )
 
@@ -65,7 +66,10 @@ func (t *cuaLog) Write(b []byte) (n int, err error) {
 	} else {
 		line = append([]byte(time.Now().UTC().Format(time.RFC3339)+" "), b...)
 	}
-	return t.writer.Write(line)
+	if _, err := t.writer.Write(secret.RedactBytes(line)); err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+	return len(b), nil
 }
 
 func (t *cuaLog) Close() error {
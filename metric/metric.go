@@ -17,6 +17,7 @@ type metric struct {
 	originCheckDipslayName string
 	originCheckTarget      string
 	originCheckTags        map[string]string
+	typeHints              map[string]string
 	fields                 []*cua.Field
 	tags                   []*cua.Tag
 	tp                     cua.ValueType
@@ -97,6 +98,10 @@ func FromMetric(other cua.Metric) cua.Metric {
 		m.originCheckTags[k] = v
 	}
 
+	for k, v := range other.TypeHints() {
+		m.SetTypeHint(k, v)
+	}
+
 	return m
 }
 
@@ -272,6 +277,10 @@ func (m *metric) Copy() cua.Metric {
 		m2.originCheckTags[k] = v
 	}
 
+	for k, v := range m.typeHints {
+		m2.SetTypeHint(k, v)
+	}
+
 	return m2
 }
 
@@ -445,3 +454,17 @@ func (m *metric) OriginCheckDisplayName() string {
 func (m *metric) SetOriginCheckDisplayName(checkDipslayName string) {
 	m.originCheckDipslayName = checkDipslayName
 }
+
+func (m *metric) TypeHints() map[string]string {
+	ret := make(map[string]string, len(m.typeHints))
+	for k, v := range m.typeHints {
+		ret[k] = v
+	}
+	return ret
+}
+func (m *metric) SetTypeHint(field, typ string) {
+	if m.typeHints == nil {
+		m.typeHints = make(map[string]string)
+	}
+	m.typeHints[field] = typ
+}
@@ -12,6 +12,16 @@ var (
 	AgentMetricsDropped = selfstat.Register("agent", "metrics_dropped", map[string]string{})
 )
 
+// metricBuffer is the contract between RunningOutput and the buffer holding
+// metrics until they have been written by the output.
+type metricBuffer interface {
+	Len() int
+	Add(metrics ...cua.Metric) int
+	Batch(batchSize int) []cua.Metric
+	Accept(batch []cua.Metric)
+	Reject(batch []cua.Metric)
+}
+
 // Buffer stores metrics in a circular buffer.
 type Buffer struct {
 	sync.Mutex
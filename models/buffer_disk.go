@@ -0,0 +1,675 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/metric"
+	"github.com/circonus-labs/circonus-unified-agent/selfstat"
+)
+
+const (
+	// maximum size of a single segment file, segments are also rotated
+	// when they hold a tenth of the buffer limit so that eviction of the
+	// oldest segment does not discard an excessive number of metrics.
+	diskBufferSegmentSize = 4 * 1024 * 1024
+	diskBufferSegmentExt  = ".seg"
+	diskBufferHeadFile    = "head"
+	diskBufferLockFile    = "lock"
+)
+
+// diskSegment is a single append-only file of newline delimited, json encoded, metrics.
+type diskSegment struct {
+	path  string
+	seq   uint64
+	size  int64 // bytes
+	count int   // metrics
+}
+
+// diskCursor is a position within the segments of a disk buffer.
+type diskCursor struct {
+	seq    uint64 // segment sequence number
+	offset int64  // byte offset within the segment
+	n      int    // number of metrics before offset in the segment
+}
+
+// DiskBuffer stores metrics in segment files on disk so that they survive an
+// agent restart. It satisfies the same Add/Batch/Accept/Reject contract as
+// Buffer. Metrics are accepted (for tracking purposes) as soon as they are
+// persisted, the metrics returned by Batch are reconstructed from disk.
+type DiskBuffer struct {
+	sync.Mutex
+	BufferSize     selfstat.Stat
+	MetricsDropped selfstat.Stat
+	MetricsWritten selfstat.Stat
+	MetricsAdded   selfstat.Stat
+	BufferLimit    selfstat.Stat
+	log            cua.Logger
+	lock           *os.File
+	writer         *os.File
+	dir            string
+	segments       []*diskSegment
+	head           diskCursor // oldest unwritten metric
+	batchEnd       diskCursor // one after the newest metric in the outstanding batch
+	maxSize        int64      // max bytes on disk, 0 = no limit
+	cap            int        // max number of metrics
+	size           int        // number of metrics currently in the buffer
+	batchPending   bool
+}
+
+type diskMetric struct {
+	Tags                   map[string]string `json:"tg,omitempty"`
+	OriginCheckTags        map[string]string `json:"oct,omitempty"`
+	TypeHints              map[string]string `json:"th,omitempty"`
+	Name                   string            `json:"n"`
+	Origin                 string            `json:"o,omitempty"`
+	OriginInstance         string            `json:"oi,omitempty"`
+	OriginCheckTarget      string            `json:"ot,omitempty"`
+	OriginCheckDisplayName string            `json:"od,omitempty"`
+	Fields                 []diskField       `json:"f"`
+	Time                   int64             `json:"ts"`
+	Type                   cua.ValueType     `json:"vt"`
+	Aggregate              bool              `json:"a,omitempty"`
+}
+
+type diskField struct {
+	Key   string `json:"k"`
+	Kind  string `json:"t"`
+	Value string `json:"v"`
+}
+
+// NewDiskBuffer returns a disk backed buffer using dir for its segment files. Any
+// metrics left in dir by a previous run are replayed, oldest first. The directory
+// is locked until the buffer is closed, it can't be shared by buffers.
+func NewDiskBuffer(name, alias, dir string, capacity int, maxSize int64, log cua.Logger) (*DiskBuffer, error) {
+	tags := map[string]string{"output": name}
+	if alias != "" {
+		tags["alias"] = alias
+	}
+
+	if dir == "" {
+		return nil, fmt.Errorf("disk buffer: directory not set")
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("disk buffer: creating directory (%s): %w", dir, err)
+	}
+
+	lock, err := os.OpenFile(filepath.Join(dir, diskBufferLockFile), os.O_CREATE|os.O_RDWR, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("disk buffer: opening lock file: %w", err)
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		return nil, fmt.Errorf("disk buffer: directory (%s) is in use by another buffer: %w", dir, err)
+	}
+
+	b := &DiskBuffer{
+		lock:    lock,
+		dir:     dir,
+		cap:     capacity,
+		maxSize: maxSize,
+		log:     log,
+
+		MetricsAdded: selfstat.Register(
+			"write",
+			"metrics_added",
+			tags,
+		),
+		MetricsWritten: selfstat.Register(
+			"write",
+			"metrics_written",
+			tags,
+		),
+		MetricsDropped: selfstat.Register(
+			"write",
+			"metrics_dropped",
+			tags,
+		),
+		BufferSize: selfstat.Register(
+			"write",
+			"buffer_size",
+			tags,
+		),
+		BufferLimit: selfstat.Register(
+			"write",
+			"buffer_limit",
+			tags,
+		),
+	}
+
+	if err := b.load(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	b.BufferSize.Set(int64(b.size))
+	b.BufferLimit.Set(int64(capacity))
+
+	if b.size > 0 {
+		b.log.Infof("Disk buffer replaying %d metrics from %s", b.size, dir)
+	}
+
+	return b, nil
+}
+
+// load scans the buffer directory for existing segments and the head position.
+func (b *DiskBuffer) load() error {
+	files, err := filepath.Glob(filepath.Join(b.dir, "*"+diskBufferSegmentExt))
+	if err != nil {
+		return fmt.Errorf("disk buffer: listing segments: %w", err)
+	}
+
+	for _, file := range files {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(file), diskBufferSegmentExt), 10, 64)
+		if err != nil {
+			b.log.Warnf("Disk buffer ignoring unknown file %s", file)
+			continue
+		}
+		seg := &diskSegment{path: file, seq: seq}
+		if err := seg.scan(); err != nil {
+			return err
+		}
+		b.segments = append(b.segments, seg)
+	}
+	sort.Slice(b.segments, func(i, j int) bool { return b.segments[i].seq < b.segments[j].seq })
+
+	if len(b.segments) > 0 {
+		b.head = diskCursor{seq: b.segments[0].seq}
+		if head, ok := b.readHead(); ok {
+			b.head = head
+		}
+		// discard segments which were completely written before the restart
+		for len(b.segments) > 0 && b.segments[0].seq < b.head.seq {
+			b.removeSegment(b.segments[0])
+			b.segments = b.segments[1:]
+		}
+		if len(b.segments) > 0 {
+			first := b.segments[0]
+			if first.seq != b.head.seq || b.head.offset > first.size || b.head.n > first.count {
+				b.head = diskCursor{seq: first.seq}
+			}
+		}
+	}
+
+	for _, seg := range b.segments {
+		b.size += seg.count
+	}
+	b.size -= b.head.n
+
+	var seq uint64
+	if len(b.segments) > 0 {
+		seq = b.segments[len(b.segments)-1].seq
+	} else {
+		seq = 1
+		b.head = diskCursor{seq: seq}
+		b.segments = append(b.segments, &diskSegment{path: b.segmentPath(seq), seq: seq})
+	}
+
+	return b.openWriter(seq)
+}
+
+// scan counts the metrics in a segment, truncating any partially written
+// trailing metric (e.g. the agent was killed during a write).
+func (s *diskSegment) scan() error {
+	f, err := os.OpenFile(s.path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("disk buffer: opening segment (%s): %w", s.path, err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			s.size += int64(len(line))
+			s.count++
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return fmt.Errorf("disk buffer: reading segment (%s): %w", s.path, err)
+		}
+	}
+
+	if err := f.Truncate(s.size); err != nil {
+		return fmt.Errorf("disk buffer: truncating segment (%s): %w", s.path, err)
+	}
+
+	return nil
+}
+
+func (b *DiskBuffer) segmentPath(seq uint64) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%020d%s", seq, diskBufferSegmentExt))
+}
+
+func (b *DiskBuffer) openWriter(seq uint64) error {
+	f, err := os.OpenFile(b.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("disk buffer: opening segment for write: %w", err)
+	}
+	b.writer = f
+	return nil
+}
+
+func (b *DiskBuffer) readHead() (diskCursor, bool) {
+	var head diskCursor
+	data, err := os.ReadFile(filepath.Join(b.dir, diskBufferHeadFile))
+	if err != nil {
+		return head, false
+	}
+	if _, err := fmt.Sscanf(string(data), "%d %d %d", &head.seq, &head.offset, &head.n); err != nil {
+		b.log.Warnf("Disk buffer invalid head file, replaying all segments: %s", err)
+		return head, false
+	}
+	return head, true
+}
+
+// writeHead saves the replay position, the file is replaced so a crash while
+// writing it leaves the previous position.
+func (b *DiskBuffer) writeHead() {
+	data := fmt.Sprintf("%d %d %d\n", b.head.seq, b.head.offset, b.head.n)
+	path := filepath.Join(b.dir, diskBufferHeadFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0640); err != nil {
+		b.log.Errorf("Disk buffer saving head position: %s", err)
+		return
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		b.log.Errorf("Disk buffer saving head position: %s", err)
+	}
+}
+
+func (b *DiskBuffer) removeSegment(seg *diskSegment) {
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		b.log.Errorf("Disk buffer removing segment: %s", err)
+	}
+}
+
+func (b *DiskBuffer) writeSegment() *diskSegment {
+	return b.segments[len(b.segments)-1]
+}
+
+// rotate starts a new write segment and closes the current one, if the new
+// segment can't be opened the current one is kept for writing.
+func (b *DiskBuffer) rotate() error {
+	seq := b.writeSegment().seq + 1
+	prev := b.writer
+	if err := b.openWriter(seq); err != nil {
+		return err
+	}
+	if err := prev.Close(); err != nil {
+		b.log.Warnf("Disk buffer closing segment: %s", err)
+	}
+	b.segments = append(b.segments, &diskSegment{path: b.segmentPath(seq), seq: seq})
+	return nil
+}
+
+func (b *DiskBuffer) diskSize() int64 {
+	size := int64(0)
+	for _, seg := range b.segments {
+		size += seg.size
+	}
+	return size
+}
+
+func (b *DiskBuffer) overLimit() bool {
+	if b.size > b.cap {
+		return true
+	}
+	return b.maxSize > 0 && b.diskSize() > b.maxSize
+}
+
+// evict drops the oldest segment(s) until the buffer is within its limits.
+func (b *DiskBuffer) evict() {
+	for b.overLimit() && b.size > 0 {
+		if len(b.segments) == 1 {
+			if err := b.rotate(); err != nil {
+				b.log.Errorf("Disk buffer rotating segment: %s", err)
+				return
+			}
+		}
+		seg := b.segments[0]
+		dropped := seg.count
+		if seg.seq == b.head.seq {
+			dropped -= b.head.n
+		}
+		AgentMetricsDropped.Incr(int64(dropped))
+		b.MetricsDropped.Incr(int64(dropped))
+		b.size -= dropped
+		b.removeSegment(seg)
+		b.segments = b.segments[1:]
+		b.head = diskCursor{seq: b.segments[0].seq}
+	}
+	b.writeHead()
+}
+
+// Len returns the number of metrics currently in the buffer.
+func (b *DiskBuffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.size
+}
+
+// Add persists metrics to the buffer and returns number of dropped metrics.
+func (b *DiskBuffer) Add(metrics ...cua.Metric) int {
+	b.Lock()
+	defer b.Unlock()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	encoded := make([]cua.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if err := enc.Encode(toDiskMetric(m)); err != nil {
+			b.log.Errorf("Disk buffer encoding metric: %s", err)
+			b.metricDropped(m)
+			continue
+		}
+		encoded = append(encoded, m)
+	}
+
+	dropped := len(metrics) - len(encoded)
+
+	if len(encoded) > 0 {
+		if _, err := b.writer.Write(buf.Bytes()); err != nil {
+			b.log.Errorf("Disk buffer writing metrics: %s", err)
+			for _, m := range encoded {
+				b.metricDropped(m)
+			}
+			return len(metrics)
+		}
+		seg := b.writeSegment()
+		seg.size += int64(buf.Len())
+		seg.count += len(encoded)
+		b.size += len(encoded)
+		b.MetricsAdded.Incr(int64(len(encoded)))
+
+		// the metrics have been handed off to disk
+		for _, m := range encoded {
+			m.Accept()
+		}
+
+		segmentLimit := max(b.cap/10, 1)
+		if seg.size >= diskBufferSegmentSize || seg.count >= segmentLimit {
+			if err := b.rotate(); err != nil {
+				b.log.Errorf("Disk buffer rotating segment: %s", err)
+			}
+		}
+	}
+
+	before := b.size
+	if b.overLimit() {
+		b.evict()
+	}
+	dropped += before - b.size
+
+	b.BufferSize.Set(int64(b.size))
+	return dropped
+}
+
+// Batch returns a slice containing up to batchSize of the oldest metrics not
+// yet written.  Metrics are ordered from oldest to newest in the batch.
+func (b *DiskBuffer) Batch(batchSize int) []cua.Metric {
+	b.Lock()
+	defer b.Unlock()
+
+	out := make([]cua.Metric, 0, min(b.size, batchSize))
+	pos := b.head
+
+	for i := 0; i < len(b.segments) && len(out) < batchSize; i++ {
+		seg := b.segments[i]
+		if seg.seq < pos.seq {
+			continue
+		}
+		if seg.seq > pos.seq {
+			pos = diskCursor{seq: seg.seq}
+		}
+		if pos.n >= seg.count {
+			continue
+		}
+
+		var err error
+		out, pos, err = b.readSegment(seg, pos, out, batchSize)
+		if err != nil {
+			b.log.Errorf("Disk buffer reading segment: %s", err)
+			break
+		}
+	}
+
+	b.batchEnd = pos
+	b.batchPending = true
+
+	return out
+}
+
+// readSegment appends metrics from seg, starting at pos, to out until batchSize is reached
+func (b *DiskBuffer) readSegment(seg *diskSegment, pos diskCursor, out []cua.Metric, batchSize int) ([]cua.Metric, diskCursor, error) {
+	f, err := os.Open(seg.path)
+	if err != nil {
+		return out, pos, fmt.Errorf("opening %s: %w", seg.path, err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(pos.offset, io.SeekStart); err != nil {
+		return out, pos, fmt.Errorf("seeking %s: %w", seg.path, err)
+	}
+
+	r := bufio.NewReader(f)
+	for pos.n < seg.count && len(out) < batchSize {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return out, pos, fmt.Errorf("reading %s: %w", seg.path, err)
+		}
+		pos.offset += int64(len(line))
+		pos.n++
+
+		var dm diskMetric
+		if err := json.Unmarshal(line, &dm); err != nil {
+			b.log.Errorf("Disk buffer decoding metric: %s", err)
+			continue
+		}
+		m, err := fromDiskMetric(&dm)
+		if err != nil {
+			b.log.Errorf("Disk buffer decoding metric: %s", err)
+			continue
+		}
+		out = append(out, m)
+	}
+
+	return out, pos, nil
+}
+
+// Accept marks the batch, acquired from Batch(), as successfully written.
+func (b *DiskBuffer) Accept(batch []cua.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	for _, m := range batch {
+		AgentMetricsWritten.Incr(1)
+		b.MetricsWritten.Incr(1)
+		m.Accept()
+	}
+
+	if !b.batchPending {
+		return
+	}
+	b.batchPending = false
+
+	// the batch may have been (partially) evicted while it was being written
+	if b.batchEnd.seq < b.head.seq || (b.batchEnd.seq == b.head.seq && b.batchEnd.n <= b.head.n) {
+		b.BufferSize.Set(int64(b.size))
+		return
+	}
+
+	for _, seg := range b.segments {
+		switch {
+		case seg.seq < b.head.seq || seg.seq > b.batchEnd.seq:
+			continue
+		case seg.seq == b.head.seq && seg.seq == b.batchEnd.seq:
+			b.size -= b.batchEnd.n - b.head.n
+		case seg.seq == b.head.seq:
+			b.size -= seg.count - b.head.n
+		case seg.seq == b.batchEnd.seq:
+			b.size -= b.batchEnd.n
+		default:
+			b.size -= seg.count
+		}
+	}
+	b.head = b.batchEnd
+
+	// remove segments which have been completely written, the
+	// current write segment is always kept
+	for len(b.segments) > 1 {
+		seg := b.segments[0]
+		if seg.seq > b.head.seq || (seg.seq == b.head.seq && b.head.n < seg.count) {
+			break
+		}
+		b.removeSegment(seg)
+		b.segments = b.segments[1:]
+		if b.head.seq < b.segments[0].seq {
+			b.head = diskCursor{seq: b.segments[0].seq}
+		}
+	}
+
+	b.writeHead()
+	b.BufferSize.Set(int64(b.size))
+}
+
+// Reject returns the batch, acquired from Batch(), to the buffer and marks it
+// as unsent. The metrics remain on disk and will be returned by the next Batch.
+func (b *DiskBuffer) Reject(batch []cua.Metric) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.batchPending = false
+	b.batchEnd = diskCursor{}
+}
+
+// Close flushes and closes the current segment file and releases the directory.
+func (b *DiskBuffer) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.lock != nil {
+		// closing the file releases the lock
+		b.lock.Close()
+		b.lock = nil
+	}
+	if b.writer == nil {
+		return nil
+	}
+	if err := b.writer.Sync(); err != nil {
+		b.log.Warnf("Disk buffer syncing segment: %s", err)
+	}
+	err := b.writer.Close()
+	b.writer = nil
+	if err != nil {
+		return fmt.Errorf("disk buffer: closing segment: %w", err)
+	}
+	return nil
+}
+
+func (b *DiskBuffer) metricDropped(m cua.Metric) {
+	AgentMetricsDropped.Incr(1)
+	b.MetricsDropped.Incr(1)
+	m.Reject()
+}
+
+func toDiskMetric(m cua.Metric) *diskMetric {
+	dm := &diskMetric{
+		Name:                   m.Name(),
+		Time:                   m.Time().UnixNano(),
+		Type:                   m.Type(),
+		Aggregate:              m.IsAggregate(),
+		Origin:                 m.Origin(),
+		OriginInstance:         m.OriginInstance(),
+		OriginCheckTags:        m.OriginCheckTags(),
+		OriginCheckTarget:      m.OriginCheckTarget(),
+		OriginCheckDisplayName: m.OriginCheckDisplayName(),
+		TypeHints:              m.TypeHints(),
+		Fields:                 make([]diskField, 0, len(m.FieldList())),
+	}
+
+	if len(m.TagList()) > 0 {
+		dm.Tags = make(map[string]string, len(m.TagList()))
+		for _, tag := range m.TagList() {
+			dm.Tags[tag.Key] = tag.Value
+		}
+	}
+
+	for _, field := range m.FieldList() {
+		df := diskField{Key: field.Key}
+		switch v := field.Value.(type) {
+		case int64:
+			df.Kind, df.Value = "i", strconv.FormatInt(v, 10)
+		case uint64:
+			df.Kind, df.Value = "u", strconv.FormatUint(v, 10)
+		case float64:
+			df.Kind, df.Value = "f", strconv.FormatFloat(v, 'g', -1, 64)
+		case bool:
+			df.Kind, df.Value = "b", strconv.FormatBool(v)
+		case string:
+			df.Kind, df.Value = "s", v
+		default:
+			df.Kind, df.Value = "s", fmt.Sprintf("%v", v)
+		}
+		dm.Fields = append(dm.Fields, df)
+	}
+
+	return dm
+}
+
+func fromDiskMetric(dm *diskMetric) (cua.Metric, error) {
+	m, err := metric.New(dm.Name, dm.Tags, nil, time.Unix(0, dm.Time), dm.Type)
+	if err != nil {
+		return nil, fmt.Errorf("new metric: %w", err)
+	}
+
+	for _, df := range dm.Fields {
+		var v interface{}
+		var err error
+		switch df.Kind {
+		case "i":
+			v, err = strconv.ParseInt(df.Value, 10, 64)
+		case "u":
+			v, err = strconv.ParseUint(df.Value, 10, 64)
+		case "f":
+			v, err = strconv.ParseFloat(df.Value, 64)
+		case "b":
+			v, err = strconv.ParseBool(df.Value)
+		case "s":
+			v = df.Value
+		default:
+			err = fmt.Errorf("unknown field type %q", df.Kind)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", df.Key, err)
+		}
+		m.AddField(df.Key, v)
+	}
+
+	m.SetAggregate(dm.Aggregate)
+	m.SetOrigin(dm.Origin)
+	m.SetOriginInstance(dm.OriginInstance)
+	m.SetOriginCheckTags(dm.OriginCheckTags)
+	m.SetOriginCheckTarget(dm.OriginCheckTarget)
+	m.SetOriginCheckDisplayName(dm.OriginCheckDisplayName)
+	for field, typ := range dm.TypeHints {
+		m.SetTypeHint(field, typ)
+	}
+
+	return m, nil
+}
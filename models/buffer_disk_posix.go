@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package models
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile takes an exclusive, non-blocking, lock on f. The lock is released
+// when the file is closed or the process exits.
+func lockFile(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB) //nolint:wrapcheck
+}
@@ -0,0 +1,162 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/metric"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDiskBuffer(t *testing.T, dir string, capacity int) *DiskBuffer {
+	t.Helper()
+	b, err := NewDiskBuffer("test", "", dir, capacity, 0, testutil.Logger{})
+	require.NoError(t, err)
+	return b
+}
+
+func TestDiskBuffer_RoundTrip(t *testing.T) {
+	b := newTestDiskBuffer(t, t.TempDir(), 10)
+	defer b.Close()
+
+	m, err := metric.New(
+		"cpu",
+		map[string]string{"host": "a"},
+		map[string]interface{}{
+			"f": 42.5,
+			"i": int64(-3),
+			"u": uint64(18446744073709551615),
+			"s": "H[1]=1",
+			"b": true,
+		},
+		time.Unix(0, 1234567890),
+		cua.Histogram,
+	)
+	require.NoError(t, err)
+	m.SetOrigin("snmp")
+	m.SetOriginInstance("router1")
+	m.SetOriginCheckTags(map[string]string{"env": "prod"})
+	m.SetOriginCheckTarget("10.0.0.1")
+	m.SetOriginCheckDisplayName("router")
+	m.SetTypeHint("", "counter")
+
+	require.Equal(t, 0, b.Add(m))
+	batch := b.Batch(10)
+	require.Len(t, batch, 1)
+
+	testutil.RequireMetricEqual(t, m, batch[0])
+	require.Equal(t, cua.Histogram, batch[0].Type())
+	require.Equal(t, "snmp", batch[0].Origin())
+	require.Equal(t, "router1", batch[0].OriginInstance())
+	require.Equal(t, map[string]string{"env": "prod"}, batch[0].OriginCheckTags())
+	require.Equal(t, "10.0.0.1", batch[0].OriginCheckTarget())
+	require.Equal(t, "router", batch[0].OriginCheckDisplayName())
+	require.Equal(t, map[string]string{"": "counter"}, batch[0].TypeHints())
+}
+
+func TestDiskBuffer_AcceptReject(t *testing.T) {
+	b := newTestDiskBuffer(t, t.TempDir(), 100)
+	defer b.Close()
+
+	b.Add(MetricTime(1), MetricTime(2), MetricTime(3))
+
+	batch := b.Batch(2)
+	require.Len(t, batch, 2)
+	b.Reject(batch)
+	require.Equal(t, 3, b.Len())
+
+	batch = b.Batch(2)
+	require.Equal(t, MetricTime(1).Time(), batch[0].Time())
+	b.Accept(batch)
+	require.Equal(t, 1, b.Len())
+
+	batch = b.Batch(2)
+	require.Len(t, batch, 1)
+	require.Equal(t, MetricTime(3).Time(), batch[0].Time())
+	b.Accept(batch)
+	require.Equal(t, 0, b.Len())
+	require.Len(t, b.Batch(2), 0)
+}
+
+func TestDiskBuffer_Replay(t *testing.T) {
+	dir := t.TempDir()
+
+	b := newTestDiskBuffer(t, dir, 100)
+	b.Add(MetricTime(1), MetricTime(2), MetricTime(3))
+	b.Accept(b.Batch(1))
+	require.NoError(t, b.Close())
+	require.FileExists(t, filepath.Join(dir, diskBufferHeadFile))
+	require.NoFileExists(t, filepath.Join(dir, diskBufferHeadFile+".tmp"))
+
+	// simulate a metric partially written before the agent was killed
+	f, err := os.OpenFile(b.segmentPath(b.writeSegment().seq), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"n":"cpu","f":[`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	b = newTestDiskBuffer(t, dir, 100)
+	defer b.Close()
+	require.Equal(t, 2, b.Len())
+
+	b.Add(MetricTime(4))
+	batch := b.Batch(10)
+	require.Len(t, batch, 3)
+	require.Equal(t, MetricTime(2).Time(), batch[0].Time())
+	require.Equal(t, MetricTime(3).Time(), batch[1].Time())
+	require.Equal(t, MetricTime(4).Time(), batch[2].Time())
+}
+
+func TestDiskBuffer_EvictOldestSegment(t *testing.T) {
+	dir := t.TempDir()
+	b := newTestDiskBuffer(t, dir, 10)
+	defer b.Close()
+
+	// segments rotate every capacity/10 metrics
+	for i := int64(1); i <= 10; i++ {
+		require.Equal(t, 0, b.Add(MetricTime(i)))
+	}
+	require.Equal(t, 10, b.Len())
+
+	require.Equal(t, 1, b.Add(MetricTime(11)))
+	require.Equal(t, 10, b.Len())
+
+	batch := b.Batch(1)
+	require.Equal(t, MetricTime(2).Time(), batch[0].Time())
+	b.Accept(batch)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+diskBufferSegmentExt))
+	require.NoError(t, err)
+	require.Len(t, files, 10)
+}
+
+func TestDiskBuffer_AcceptsTrackingMetricOnAdd(t *testing.T) {
+	b := newTestDiskBuffer(t, t.TempDir(), 10)
+	defer b.Close()
+
+	var accepted int
+	mm := &MockMetric{
+		Metric:  Metric(),
+		AcceptF: func() { accepted++ },
+	}
+
+	b.Add(mm)
+	require.Equal(t, 1, accepted)
+}
+
+func TestDiskBuffer_Lock(t *testing.T) {
+	dir := t.TempDir()
+	b := newTestDiskBuffer(t, dir, 10)
+
+	_, err := NewDiskBuffer("test", "", dir, 10, 0, testutil.Logger{})
+	require.Error(t, err)
+
+	// the directory is released when the buffer is closed
+	require.NoError(t, b.Close())
+	b = newTestDiskBuffer(t, dir, 10)
+	require.NoError(t, b.Close())
+}
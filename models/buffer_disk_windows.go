@@ -0,0 +1,17 @@
+//go:build windows
+// +build windows
+
+package models
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive, non-blocking, lock on f. The lock is released
+// when the file is closed or the process exits.
+func lockFile(f *os.File) error {
+	ol := new(windows.Overlapped)
+	return windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol) //nolint:wrapcheck
+}
@@ -1,16 +1,22 @@
 package models
 
 import (
+	"fmt"
 	"log"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
 )
 
 // Logger defines a logging structure for plugins.
 type Logger struct {
-	Name   string // Name is the plugin name, will be printed in the `[]`.
-	OnErrs []func()
+	lastErrTime time.Time
+	Name        string // Name is the plugin name, will be printed in the `[]`.
+	lastErr     string
+	OnErrs      []func()
+	mu          sync.Mutex
 }
 
 // NewLogger creates a new logger instance
@@ -25,11 +31,26 @@ func (l *Logger) OnErr(f func()) {
 	l.OnErrs = append(l.OnErrs, f)
 }
 
+// LastError returns the most recent error logged and when it occurred.
+func (l *Logger) LastError() (string, time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastErr, l.lastErrTime
+}
+
+func (l *Logger) setLastError(msg string) {
+	l.mu.Lock()
+	l.lastErr = msg
+	l.lastErrTime = time.Now()
+	l.mu.Unlock()
+}
+
 // Errorf logs an error message, patterned after log.Printf.
 func (l *Logger) Errorf(format string, args ...interface{}) {
 	for _, f := range l.OnErrs {
 		f()
 	}
+	l.setLastError(fmt.Sprintf(format, args...))
 	log.Printf("E! ["+l.Name+"] "+format, args...)
 }
 
@@ -38,6 +59,7 @@ func (l *Logger) Error(args ...interface{}) {
 	for _, f := range l.OnErrs {
 		f()
 	}
+	l.setLastError(fmt.Sprint(args...))
 	log.Print(append([]interface{}{"E! [" + l.Name + "] "}, args...)...)
 }
 
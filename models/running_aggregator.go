@@ -72,6 +72,7 @@ type AggregatorConfig struct {
 	Alias             string
 	MeasurementSuffix string
 	NameOverride      string
+	Hash              string // digest of the plugin settings, used to detect changes on reload
 	MeasurementPrefix string
 	Filter            Filter
 	Grace             time.Duration
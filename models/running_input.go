@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/typehint"
 	"github.com/circonus-labs/circonus-unified-agent/selfstat"
 )
 
@@ -74,6 +75,7 @@ type InputConfig struct {
 	NameOverride      string
 	MeasurementPrefix string
 	MeasurementSuffix string
+	Hash              string // digest of the plugin settings, used to detect changes on reload
 	CheckDisplayName  string
 	CheckTarget       string
 	CheckTags         map[string]string
@@ -120,6 +122,7 @@ func (r *RunningInput) MakeMetric(metric cua.Metric) cua.Metric {
 	m.SetOriginCheckTags(r.Config.CheckTags)
 	m.SetOriginCheckTarget(r.Config.CheckTarget)
 	m.SetOriginCheckDisplayName(r.Config.CheckDisplayName)
+	typehint.Extract(m)
 
 	r.Config.Filter.Modify(metric)
 	if len(metric.FieldList()) == 0 {
@@ -150,3 +153,11 @@ func (r *RunningInput) SetDefaultTags(tags map[string]string) {
 func (r *RunningInput) Log() cua.Logger {
 	return r.log
 }
+
+// LastError returns the most recent error logged by the input and when it occurred.
+func (r *RunningInput) LastError() (string, time.Time) {
+	if l, ok := r.log.(*Logger); ok {
+		return l.LastError()
+	}
+	return "", time.Time{}
+}
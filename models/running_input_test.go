@@ -123,6 +123,31 @@ func TestMakeMetricWithPluginTags(t *testing.T) {
 	require.Equal(t, expected, m)
 }
 
+func TestMakeMetricTypeHintTags(t *testing.T) {
+	ri := NewRunningInput(&testInput{}, &InputConfig{
+		Name: "TestRunningInput",
+		Tags: map[string]string{
+			"foo":                   "bar",
+			"__circonus_type":       "gauge",
+			"__circonus_type_value": "counter",
+			"__circonus_type_other": "summary",
+		},
+	})
+
+	m := testutil.MustMetric("RITest",
+		map[string]string{},
+		map[string]interface{}{
+			"value": int64(101),
+		},
+		time.Now(),
+		cua.Untyped)
+	m = ri.MakeMetric(m)
+
+	// type hints are kept outside of the tags, invalid types are dropped
+	require.Equal(t, map[string]string{"foo": "bar"}, m.Tags())
+	require.Equal(t, map[string]string{"": "gauge", "value": "counter"}, m.TypeHints())
+}
+
 func TestMakeMetricFilteredOut(t *testing.T) {
 	now := time.Now()
 	ri := NewRunningInput(&testInput{}, &InputConfig{
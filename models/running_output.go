@@ -2,6 +2,8 @@ package models
 
 import (
 	"fmt"
+	"io"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,6 +18,10 @@ const (
 
 	// Default number of metrics kept. It should be a multiple of batch size.
 	DefaultMetricBufferLimit = 10000
+
+	// Buffer types, metrics are held in memory by default.
+	BufferTypeMemory = "memory"
+	BufferTypeDisk   = "disk"
 )
 
 // OutputConfig containing name and filter
@@ -25,11 +31,28 @@ type OutputConfig struct {
 	NamePrefix        string
 	NameSuffix        string
 	NameOverride      string
+	BufferType        string
+	BufferDirectory   string
+	Hash              string // digest of the plugin settings, used to detect changes on reload
 	Filter            Filter
 	FlushJitter       time.Duration
 	MetricBufferLimit int
 	MetricBatchSize   int
 	FlushInterval     time.Duration
+	BufferMaxSize     int64
+}
+
+// DiskBufferDirectory returns the directory of the output's disk buffer,
+// buffer_directory/<name>[_<alias>], or "" when the buffer is in memory.
+func (oc *OutputConfig) DiskBufferDirectory() string {
+	if oc.BufferType != BufferTypeDisk {
+		return ""
+	}
+	name := oc.Name
+	if oc.Alias != "" {
+		name += "_" + oc.Alias
+	}
+	return filepath.Join(oc.BufferDirectory, name)
 }
 
 // RunningOutput contains the output configuration
@@ -41,7 +64,7 @@ type RunningOutput struct {
 	log               cua.Logger
 	Config            *OutputConfig
 	BatchReady        chan time.Time
-	buffer            *Buffer
+	buffer            metricBuffer
 	newMetricsCount   int64
 	droppedMetrics    int64
 	MetricBufferLimit int
@@ -125,6 +148,30 @@ func NewRunningOutput(
 	return ro
 }
 
+// openDiskBuffer replaces the in-memory buffer with a disk buffer when one is
+// configured. It is deferred to Init so that loading a configuration, e.g. to
+// compare it with the running one on reload, does not open the buffer directory
+// while the running output is still using it.
+func (ro *RunningOutput) openDiskBuffer() error {
+	if ro.Config.BufferType != BufferTypeDisk {
+		return nil
+	}
+	if _, ok := ro.buffer.(*DiskBuffer); ok {
+		return nil
+	}
+	dir := ro.Config.DiskBufferDirectory()
+	buffer, err := NewDiskBuffer(ro.Config.Name, ro.Config.Alias, dir, ro.MetricBufferLimit, ro.Config.BufferMaxSize, ro.log)
+	if err != nil {
+		return fmt.Errorf("disk buffer (output %s): %w", ro.Config.Name, err)
+	}
+	if n := ro.buffer.Len(); n > 0 {
+		// the disk buffer takes ownership, the memory buffer is discarded
+		buffer.Add(ro.buffer.Batch(n)...)
+	}
+	ro.buffer = buffer
+	return nil
+}
+
 func (ro *RunningOutput) LogName() string {
 	return logName("outputs", ro.Config.Name, ro.Config.Alias)
 }
@@ -142,7 +189,7 @@ func (ro *RunningOutput) Init() error {
 		}
 
 	}
-	return nil
+	return ro.openDiskBuffer()
 }
 
 // AddMetric adds a metric to the output.
@@ -248,6 +295,11 @@ func (ro *RunningOutput) Close() {
 	if err != nil {
 		ro.log.Errorf("Error closing output: %v", err)
 	}
+	if b, ok := ro.buffer.(io.Closer); ok {
+		if err := b.Close(); err != nil {
+			ro.log.Errorf("Error closing buffer: %v", err)
+		}
+	}
 }
 
 func (ro *RunningOutput) write(metrics []cua.Metric) error {
@@ -266,6 +318,9 @@ func (ro *RunningOutput) write(metrics []cua.Metric) error {
 		ro.log.Debugf("Wrote %d batches in %s", len(metrics), elapsed)
 	}
 	if err != nil {
+		if l, ok := ro.log.(*Logger); ok {
+			l.setLastError(err.Error())
+		}
 		return fmt.Errorf("write (output %s): %w", ro.Config.Name, err)
 	}
 	return nil
@@ -283,3 +338,55 @@ func (ro *RunningOutput) Log() cua.Logger {
 func (ro *RunningOutput) BufferLength() int {
 	return ro.buffer.Len()
 }
+
+// ShareDiskBuffer makes ro, the replacement of old on a config reload, use the disk
+// buffer of old when both buffer to the same directory, a directory can only be opened
+// once. It must be called before Init, the buffer is shared until TransferBuffer hands
+// it over to ro or ReleaseBuffer gives it back to old. The buffer keeps the limits of old.
+func (ro *RunningOutput) ShareDiskBuffer(old *RunningOutput) {
+	if _, ok := old.buffer.(*DiskBuffer); !ok {
+		return
+	}
+	if ro.Config.DiskBufferDirectory() != old.Config.DiskBufferDirectory() {
+		return
+	}
+	ro.buffer = old.buffer
+}
+
+// ReleaseBuffer gives a disk buffer shared with old back to old, ro was not started
+// and is closed without closing the buffer.
+func (ro *RunningOutput) ReleaseBuffer(old *RunningOutput) {
+	if ro.buffer == old.buffer {
+		ro.buffer = NewBuffer(ro.Config.Name, ro.Config.Alias, ro.MetricBufferLimit)
+	}
+}
+
+// TransferBuffer moves the metrics remaining in the buffer to dst, it is used
+// when an output is replaced by a config reload. A disk buffer shared with dst
+// is handed over, other disk buffers are not moved, their metrics are replayed
+// when the directory is opened again.
+func (ro *RunningOutput) TransferBuffer(dst *RunningOutput) int {
+	if ro.buffer == dst.buffer {
+		ro.buffer = NewBuffer(ro.Config.Name, ro.Config.Alias, ro.MetricBufferLimit)
+		return 0
+	}
+	if _, ok := ro.buffer.(*DiskBuffer); ok {
+		return 0
+	}
+	n := ro.buffer.Len()
+	if n == 0 {
+		return 0
+	}
+	// dst takes ownership of the metrics, this buffer is no longer used
+	dst.buffer.Add(ro.buffer.Batch(n)...)
+	return n
+}
+
+// LastError returns the most recent error logged or returned by the output and
+// when it occurred.
+func (ro *RunningOutput) LastError() (string, time.Time) {
+	if l, ok := ro.log.(*Logger); ok {
+		return l.LastError()
+	}
+	return "", time.Time{}
+}
@@ -585,3 +585,57 @@ func (m *perfOutput) Write(metrics []cua.Metric) (int, error) {
 	}
 	return 0, nil
 }
+
+func TestRunningOutputShareDiskBuffer(t *testing.T) {
+	dir := t.TempDir()
+	newOutput := func() *RunningOutput {
+		return NewRunningOutput("test", &mockOutput{}, &OutputConfig{
+			Name:            "test",
+			BufferType:      BufferTypeDisk,
+			BufferDirectory: dir,
+		}, 1000, 10000)
+	}
+
+	old := newOutput()
+	require.NoError(t, old.Init())
+	for _, metric := range first5 {
+		old.AddMetric(metric)
+	}
+
+	// the replacement fails, the buffer is given back without being closed
+	failed := newOutput()
+	failed.ShareDiskBuffer(old)
+	require.NoError(t, failed.Init())
+	failed.ReleaseBuffer(old)
+	failed.Close()
+	old.AddMetric(next5[0])
+	require.Equal(t, 6, old.BufferLength())
+
+	// the buffer directory is locked by old, the replacement takes over its buffer
+	replacement := newOutput()
+	replacement.ShareDiskBuffer(old)
+	require.NoError(t, replacement.Init())
+	require.Zero(t, old.TransferBuffer(replacement))
+	old.Close()
+	require.Equal(t, 6, replacement.BufferLength())
+	require.NoError(t, replacement.Write())
+	require.Zero(t, replacement.BufferLength())
+	replacement.Close()
+}
+
+func TestRunningOutputDiskBufferOpenError(t *testing.T) {
+	dir := t.TempDir()
+	conf := &OutputConfig{
+		Name:            "test",
+		BufferType:      BufferTypeDisk,
+		BufferDirectory: dir,
+	}
+
+	ro := NewRunningOutput("test", &mockOutput{}, conf, 1000, 10000)
+	require.NoError(t, ro.Init())
+	defer ro.Close()
+
+	// the directory is locked by the first output
+	locked := NewRunningOutput("test", &mockOutput{}, conf, 1000, 10000)
+	require.Error(t, locked.Init())
+}
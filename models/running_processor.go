@@ -25,6 +25,7 @@ func (rp RunningProcessors) Less(i, j int) bool { return rp[i].Config.Order < rp
 type ProcessorConfig struct {
 	Name   string
 	Alias  string
+	Hash   string // digest of the plugin settings, used to detect changes on reload
 	Filter Filter
 	Order  int64
 }
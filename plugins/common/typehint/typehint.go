@@ -0,0 +1,105 @@
+// Package typehint defines the annotations of the circonus metric type of a metric's
+// fields, they are set by the circonus_types processor (or an input's reserved tags)
+// and honored by the circonus output. The annotations are kept on the metric, outside
+// of its tags, so other outputs and aggregators don't see them.
+package typehint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+)
+
+const (
+	// Tag is the reserved tag setting the type of all the fields of a metric
+	Tag = "__circonus_type"
+	// FieldTagPrefix is the prefix of the reserved tags setting the type of a single
+	// field, e.g. __circonus_type_requests = "counter"
+	FieldTagPrefix = Tag + "_"
+)
+
+// Types a field can be annotated as.
+const (
+	Counter   = "counter"
+	Gauge     = "gauge"
+	Text      = "text"
+	Histogram = "histogram"
+)
+
+// IsReserved indicates whether a tag key is a type hint.
+func IsReserved(key string) bool {
+	return key == Tag || strings.HasPrefix(key, FieldTagPrefix)
+}
+
+// Validate returns an error if the type is not one of the supported types.
+func Validate(typ string) error {
+	switch typ {
+	case Counter, Gauge, Text, Histogram:
+		return nil
+	}
+	return fmt.Errorf("invalid circonus type %q (counter, gauge, text, histogram)", typ)
+}
+
+// Hints are the type annotations of a metric.
+type Hints struct {
+	metric string
+	fields map[string]string
+}
+
+// Extract moves the reserved tags of a metric (e.g. set with an input's tags) to its
+// type hints. Reserved tags with an invalid type are removed.
+func Extract(m cua.Metric) {
+	var keys []string
+	for _, t := range m.TagList() {
+		if IsReserved(t.Key) {
+			keys = append(keys, t.Key)
+		}
+	}
+	for _, key := range keys {
+		typ, _ := m.GetTag(key)
+		m.RemoveTag(key)
+		if Validate(typ) != nil {
+			continue
+		}
+		m.SetTypeHint(strings.TrimPrefix(strings.TrimPrefix(key, Tag), "_"), typ)
+	}
+}
+
+// FromMetric returns the type hints of a metric, nil if it has none. Invalid types are ignored.
+func FromMetric(m cua.Metric) *Hints {
+	var h *Hints
+	for field, typ := range m.TypeHints() {
+		if Validate(typ) != nil {
+			continue
+		}
+		if h == nil {
+			h = &Hints{fields: make(map[string]string)}
+		}
+		if field == "" {
+			h.metric = typ
+		} else {
+			h.fields[field] = typ
+		}
+	}
+	return h
+}
+
+// Metric returns the type of all the metric's fields, empty if not set.
+func (h *Hints) Metric() string {
+	if h == nil {
+		return ""
+	}
+	return h.metric
+}
+
+// Field returns the type of a field, falling back to the metric's type, empty if not set.
+func (h *Hints) Field(key string) string {
+	if h == nil {
+		return ""
+	}
+	if typ, ok := h.fields[key]; ok {
+		return typ
+	}
+	return h.metric
+}
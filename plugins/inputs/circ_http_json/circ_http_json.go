@@ -33,12 +33,13 @@ type CHJ struct {
 	TLSCAFile         string
 	Timeout           string
 	SubmissionTimeout string `toml:"submission_timeout"`
+	CirconusProfile   string `toml:"circonus_profile"`
 	to                time.Duration
 	Debug             bool
 }
 
-func (chj *CHJ) Init() error {
-
+// CheckConfig validates the settings without creating the check.
+func (chj *CHJ) CheckConfig() error {
 	if chj.URL == "" {
 		return fmt.Errorf("invalid URL (empty)")
 	}
@@ -61,12 +62,21 @@ func (chj *CHJ) Init() error {
 	}
 	chj.to = t
 
+	return nil
+}
+
+func (chj *CHJ) Init() error {
+	if err := chj.CheckConfig(); err != nil {
+		return err
+	}
+
 	opts := &circmgr.MetricDestConfig{
 		MetricMeta: circmgr.MetricMeta{
 			PluginID:   "circ_http_json",
 			InstanceID: chj.InstanceID,
 		},
 		SubmissionTimeout: chj.SubmissionTimeout,
+		Profile:           chj.CirconusProfile,
 	}
 	dest, err := circmgr.NewMetricDestination(opts, chj.Log)
 	if err != nil {
@@ -97,6 +107,9 @@ url = "" # required
 ## metric submission, to the broker, will output via regular agent debug setting.
 debug = false
 
+## optional, name of the agent.circonus_profiles account to send metrics to
+# circonus_profile = ""
+
 ## timeout for request
 # timeout = "5s"
 
@@ -76,8 +76,9 @@ const (
 
 var (
 	containerStates = []string{"created", "restarting", "running", "removing", "paused", "exited", "dead"}
-	// ensure *DockerLogs implements cua.ServiceInput
-	_ cua.ServiceInput = (*DockerLogs)(nil)
+	// ensure *DockerLogs implements cua.ServiceInput and cua.StatefulPlugin
+	_ cua.ServiceInput   = (*DockerLogs)(nil)
+	_ cua.StatefulPlugin = (*DockerLogs)(nil)
 )
 
 type DockerLogs struct {
@@ -103,8 +104,9 @@ type DockerLogs struct {
 	stateFilter     filter.Filter
 	opts            types.ContainerListOptions
 	wg              sync.WaitGroup
-	mu              sync.Mutex
+	mu              sync.Mutex // containerList and lastRecord
 	containerList   map[string]context.CancelFunc
+	lastRecord      map[string]time.Time // timestamp of the last line read from each container
 }
 
 func (d *DockerLogs) Description() string {
@@ -190,6 +192,67 @@ func (d *DockerLogs) cancelTails() {
 	}
 }
 
+func (d *DockerLogs) getLastRecord(containerID string) (time.Time, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ts, ok := d.lastRecord[containerID]
+	return ts, ok
+}
+
+func (d *DockerLogs) setLastRecord(containerID string, ts time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lastRecord == nil {
+		d.lastRecord = make(map[string]time.Time)
+	}
+	if ts.After(d.lastRecord[containerID]) {
+		d.lastRecord[containerID] = ts
+	}
+}
+
+// pruneLastRecords forgets the containers no longer listed, so the records
+// don't grow with every container ever seen.
+func (d *DockerLogs) pruneLastRecords(containers []types.Container) {
+	listed := make(map[string]bool, len(containers))
+	for _, container := range containers {
+		listed[container.ID] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id := range d.lastRecord {
+		if !listed[id] && d.containerList[id] == nil {
+			delete(d.lastRecord, id)
+		}
+	}
+}
+
+// GetState returns the timestamp of the last line read from each container,
+// see cua.StatefulPlugin.
+func (d *DockerLogs) GetState() interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state := make(map[string]time.Time, len(d.lastRecord))
+	for id, ts := range d.lastRecord {
+		state[id] = ts
+	}
+	return state
+}
+
+// SetState restores the timestamps returned by GetState, logs of these
+// containers are read from the line after.
+func (d *DockerLogs) SetState(state interface{}) error {
+	records, ok := state.(map[string]time.Time)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	d.mu.Lock()
+	d.lastRecord = records
+	d.mu.Unlock()
+	return nil
+}
+
 func (d *DockerLogs) matchedContainerName(names []string) string {
 	// Check if all container names are filtered; in practice I believe
 	// this array is always of length 1.
@@ -212,6 +275,7 @@ func (d *DockerLogs) Gather(ctx context.Context, acc cua.Accumulator) error {
 	if err != nil {
 		return fmt.Errorf("container list: %w", err)
 	}
+	d.pruneLastRecords(containers)
 
 	for _, container := range containers {
 		if d.containerInContainerList(container.ID) {
@@ -296,6 +360,13 @@ func (d *DockerLogs) tailContainerLogs(
 		Tail:       tail,
 	}
 
+	// resume after the last line read, e.g. before the agent was restarted
+	if ts, ok := d.getLastRecord(container.ID); ok {
+		ts = ts.Add(time.Nanosecond)
+		logOptions.Tail = "all"
+		logOptions.Since = fmt.Sprintf("%d.%09d", ts.Unix(), ts.Nanosecond())
+	}
+
 	logReader, err := d.client.ContainerLogs(ctx, container.ID, logOptions)
 	if err != nil {
 		return fmt.Errorf("container logs: %w", err)
@@ -308,9 +379,9 @@ func (d *DockerLogs) tailContainerLogs(
 	// If the container is *not* using a TTY, streams for stdout and stderr are
 	// multiplexed.
 	if hasTTY {
-		return tailStream(acc, tags, container.ID, logReader, "tty")
+		return d.tailStream(acc, tags, container.ID, logReader, "tty")
 	}
-	return tailMultiplexed(acc, tags, container.ID, logReader)
+	return d.tailMultiplexed(acc, tags, container.ID, logReader)
 }
 
 func parseLine(line []byte) (time.Time, string, error) {
@@ -335,7 +406,7 @@ func parseLine(line []byte) (time.Time, string, error) {
 	return ts, string(message), nil
 }
 
-func tailStream(
+func (d *DockerLogs) tailStream(
 	acc cua.Accumulator,
 	baseTags map[string]string,
 	containerID string,
@@ -364,6 +435,7 @@ func tailStream(
 					"container_id": containerID,
 					"message":      message,
 				}, tags, ts)
+				d.setLastRecord(containerID, ts)
 			}
 		}
 
@@ -376,7 +448,7 @@ func tailStream(
 	}
 }
 
-func tailMultiplexed(
+func (d *DockerLogs) tailMultiplexed(
 	acc cua.Accumulator,
 	tags map[string]string,
 	containerID string,
@@ -389,7 +461,7 @@ func tailMultiplexed(
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := tailStream(acc, tags, containerID, outReader, "stdout")
+		err := d.tailStream(acc, tags, containerID, outReader, "stdout")
 		if err != nil {
 			acc.AddError(err)
 		}
@@ -398,7 +470,7 @@ func tailMultiplexed(
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		err := tailStream(acc, tags, containerID, errReader, "stderr")
+		err := d.tailStream(acc, tags, containerID, errReader, "stderr")
 		if err != nil {
 			acc.AddError(err)
 		}
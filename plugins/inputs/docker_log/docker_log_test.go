@@ -187,3 +187,54 @@ func Test(t *testing.T) {
 		})
 	}
 }
+
+func TestState(t *testing.T) {
+	var since []string
+	client := &MockClient{
+		ContainerListF: func(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+			return []types.Container{
+				{
+					ID:    "deadbeef",
+					Names: []string{"/circonus-unified-agent"},
+					Image: "circonus-labs/circonus-unified-agent:1.11.0",
+				},
+			}, nil
+		},
+		ContainerInspectF: func(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+			return types.ContainerJSON{Config: &container.Config{Tty: true}}, nil
+		},
+		ContainerLogsF: func(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+			since = append(since, options.Since)
+			return &Response{Reader: bytes.NewBuffer([]byte("2020-04-28T18:43:16.432691200Z hello\n"))}, nil
+		},
+	}
+	newPlugin := func() *DockerLogs {
+		plugin := &DockerLogs{
+			Timeout:       internal.Duration{Duration: time.Second * 5},
+			newClient:     func(string, *tls.Config) (Client, error) { return client, nil },
+			containerList: make(map[string]context.CancelFunc),
+		}
+		require.NoError(t, plugin.Init())
+		return plugin
+	}
+
+	var acc testutil.Accumulator
+	plugin := newPlugin()
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	acc.Wait(1)
+	plugin.Stop()
+
+	state := plugin.GetState()
+	require.Equal(t, map[string]time.Time{
+		"deadbeef": MustParse(time.RFC3339Nano, "2020-04-28T18:43:16.432691200Z"),
+	}, state)
+
+	// a new instance resumes after the last line read
+	plugin = newPlugin()
+	require.NoError(t, plugin.SetState(state))
+	require.NoError(t, plugin.Gather(context.Background(), &acc))
+	acc.Wait(2)
+	plugin.Stop()
+
+	require.Equal(t, []string{"", "1588099396.432691201"}, since)
+}
@@ -133,9 +133,39 @@ type KafkaConsumer struct {
 	consumer        ConsumerGroup
 	config          *sarama.Config
 
-	parser parsers.Parser
-	wg     sync.WaitGroup
-	cancel context.CancelFunc
+	parser    parsers.Parser
+	wg        sync.WaitGroup
+	cancel    context.CancelFunc
+	delivered partitionOffsets
+}
+
+// partitionOffsets are the offsets, by topic and partition, following the last
+// message delivered to the outputs. Kafka only has the offsets committed, those
+// marked since the last commit are lost if the agent stops.
+type partitionOffsets struct {
+	mu      sync.Mutex
+	offsets map[string]map[int32]int64
+}
+
+func (po *partitionOffsets) mark(topic string, partition int32, offset int64) {
+	po.mu.Lock()
+	defer po.mu.Unlock()
+	if po.offsets == nil {
+		po.offsets = make(map[string]map[int32]int64)
+	}
+	if po.offsets[topic] == nil {
+		po.offsets[topic] = make(map[int32]int64)
+	}
+	if offset > po.offsets[topic][partition] {
+		po.offsets[topic][partition] = offset
+	}
+}
+
+func (po *partitionOffsets) get(topic string, partition int32) (int64, bool) {
+	po.mu.Lock()
+	defer po.mu.Unlock()
+	offset, ok := po.offsets[topic][partition]
+	return offset, ok
 }
 
 type ConsumerGroup interface {
@@ -233,6 +263,7 @@ func (k *KafkaConsumer) Start(ctx context.Context, acc cua.Accumulator) error {
 			handler := NewConsumerGroupHandler(acc, k.MaxUndeliveredMessages, k.parser)
 			handler.MaxMessageLen = k.MaxMessageLen
 			handler.TopicTag = k.TopicTag
+			handler.delivered = &k.delivered
 			err := k.consumer.Consume(kctx, k.Topics, handler)
 			if err != nil {
 				acc.AddError(err)
@@ -265,6 +296,36 @@ func (k *KafkaConsumer) Stop() {
 	k.wg.Wait()
 }
 
+// GetState returns the offset following the last message delivered of each
+// topic and partition, see cua.StatefulPlugin.
+func (k *KafkaConsumer) GetState() interface{} {
+	k.delivered.mu.Lock()
+	defer k.delivered.mu.Unlock()
+	state := make(map[string]map[int32]int64, len(k.delivered.offsets))
+	for topic, partitions := range k.delivered.offsets {
+		state[topic] = make(map[int32]int64, len(partitions))
+		for partition, offset := range partitions {
+			state[topic][partition] = offset
+		}
+	}
+	return state
+}
+
+// SetState restores the offsets returned by GetState, they are marked when a
+// partition is claimed so consuming resumes after the last message delivered
+// even if it wasn't committed.
+func (k *KafkaConsumer) SetState(state interface{}) error {
+	offsets, ok := state.(map[string]map[int32]int64)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	k.delivered.mu.Lock()
+	k.delivered.offsets = offsets
+	k.delivered.mu.Unlock()
+	return nil
+}
+
 // Message is an aggregate type binding the Kafka message and the session so
 // that offsets can be updated.
 type Message struct {
@@ -295,13 +356,27 @@ type ConsumerGroupHandler struct {
 
 	mu          sync.Mutex
 	undelivered map[cua.TrackingID]Message
+
+	delivered *partitionOffsets
 }
 
 // Setup is called once when a new session is opened.  It setups up the handler
 // and begins processing delivered messages.
-func (h *ConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error {
+func (h *ConsumerGroupHandler) Setup(session sarama.ConsumerGroupSession) error {
 	h.undelivered = make(map[cua.TrackingID]Message)
 
+	// resume after messages delivered but not yet committed, marking an
+	// offset behind the committed one is a noop
+	if h.delivered != nil {
+		for topic, partitions := range session.Claims() {
+			for _, partition := range partitions {
+				if offset, ok := h.delivered.get(topic, partition); ok {
+					session.MarkOffset(topic, partition, offset, "")
+				}
+			}
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	h.cancel = cancel
 
@@ -337,6 +412,9 @@ func (h *ConsumerGroupHandler) onDelivery(track cua.DeliveryInfo) {
 
 	if track.Delivered() {
 		msg.session.MarkMessage(msg.message, "")
+		if h.delivered != nil {
+			h.delivered.mark(msg.message.Topic, msg.message.Partition, msg.message.Offset+1)
+		}
 	}
 
 	delete(h.undelivered, track.ID())
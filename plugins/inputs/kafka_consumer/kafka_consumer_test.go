@@ -25,7 +25,7 @@ type FakeConsumerGroup struct {
 
 func (g *FakeConsumerGroup) Consume(ctx context.Context, topics []string, handler sarama.ConsumerGroupHandler) error {
 	g.handler = handler
-	_ = g.handler.Setup(nil)
+	_ = g.handler.Setup(&FakeConsumerGroupSession{ctx: ctx})
 	return nil
 }
 
@@ -199,11 +199,13 @@ func TestStartStop(t *testing.T) {
 }
 
 type FakeConsumerGroupSession struct {
-	ctx context.Context
+	ctx    context.Context
+	claims map[string][]int32
+	marked map[string]map[int32]int64
 }
 
 func (s *FakeConsumerGroupSession) Claims() map[string][]int32 {
-	panic("not implemented")
+	return s.claims
 }
 
 func (s *FakeConsumerGroupSession) MemberID() string {
@@ -215,7 +217,13 @@ func (s *FakeConsumerGroupSession) GenerationID() int32 {
 }
 
 func (s *FakeConsumerGroupSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
-	panic("not implemented")
+	if s.marked == nil {
+		s.marked = make(map[string]map[int32]int64)
+	}
+	if s.marked[topic] == nil {
+		s.marked[topic] = make(map[int32]int64)
+	}
+	s.marked[topic][partition] = offset
 }
 
 func (s *FakeConsumerGroupSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
@@ -409,3 +417,50 @@ func TestConsumerGroupHandler_Handle(t *testing.T) {
 		})
 	}
 }
+
+type deliveryInfo struct {
+	id        cua.TrackingID
+	delivered bool
+}
+
+func (d deliveryInfo) ID() cua.TrackingID { return d.id }
+func (d deliveryInfo) Delivered() bool    { return d.delivered }
+
+func TestConsumerGroupHandler_State(t *testing.T) {
+	plugin := &KafkaConsumer{}
+	acc := &testutil.Accumulator{}
+	parser := &value.Parser{MetricName: "cpu", DataType: "int"}
+	cg := NewConsumerGroupHandler(acc, 2, parser)
+	cg.delivered = &plugin.delivered
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &FakeConsumerGroupSession{ctx: ctx}
+
+	for _, msg := range []*sarama.ConsumerMessage{
+		{Topic: "circonus", Partition: 1, Offset: 41, Value: []byte("41")},
+		{Topic: "circonus", Partition: 1, Offset: 42, Value: []byte("42")},
+	} {
+		require.NoError(t, cg.Reserve(ctx))
+		require.NoError(t, cg.Handle(session, msg))
+	}
+	ids := make(map[int64]cua.TrackingID)
+	for id, msg := range cg.undelivered {
+		ids[msg.message.Offset] = id
+	}
+	cg.onDelivery(deliveryInfo{id: ids[42], delivered: true})
+	cg.onDelivery(deliveryInfo{id: ids[41], delivered: false})
+
+	state := plugin.GetState()
+	require.Equal(t, map[string]map[int32]int64{"circonus": {1: 43}}, state)
+
+	// a new instance marks the offsets of its claims when the session starts
+	plugin = &KafkaConsumer{}
+	require.NoError(t, plugin.SetState(state))
+	cg = NewConsumerGroupHandler(acc, 1, parser)
+	cg.delivered = &plugin.delivered
+	session = &FakeConsumerGroupSession{ctx: ctx, claims: map[string][]int32{"circonus": {0, 1}}}
+	require.NoError(t, cg.Setup(session))
+	require.NoError(t, cg.Cleanup(session))
+	require.Equal(t, map[string]map[int32]int64{"circonus": {1: 43}}, session.marked)
+}
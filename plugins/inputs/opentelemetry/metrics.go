@@ -0,0 +1,254 @@
+package opentelemetry
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+// defaultMeasurement is used for metrics without an instrumentation scope name
+const defaultMeasurement = "opentelemetry"
+
+// addMetrics converts the OTLP metrics to cua metrics:
+//   - gauges and sums are fields, named for the metric, of a measurement named
+//     for the instrumentation scope
+//   - histograms are cua histograms named for the metric, with count, sum, min
+//     and max fields added to the scope measurement
+//   - summaries are cua summaries with a field for each quantile
+func (o *OpenTelemetry) addMetrics(req *colmetrics.ExportMetricsServiceRequest) {
+	for _, rm := range req.GetResourceMetrics() {
+		resourceTags := make(map[string]string)
+		for _, kv := range rm.GetResource().GetAttributes() {
+			if !o.attrFilter.Match(kv.GetKey()) {
+				continue
+			}
+			if v, ok := attributeValue(kv.GetValue()); ok {
+				resourceTags[kv.GetKey()] = v
+			}
+		}
+
+		for _, sm := range rm.GetScopeMetrics() {
+			measurement := sm.GetScope().GetName()
+			if measurement == "" {
+				measurement = defaultMeasurement
+			}
+			for _, m := range sm.GetMetrics() {
+				o.addMetric(measurement, resourceTags, m)
+			}
+		}
+	}
+}
+
+func (o *OpenTelemetry) addMetric(measurement string, resourceTags map[string]string, m *metricspb.Metric) {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		for _, dp := range data.Gauge.GetDataPoints() {
+			o.acc.AddGauge(measurement,
+				map[string]interface{}{m.GetName(): numberValue(dp)},
+				tags(resourceTags, dp.GetAttributes()),
+				timestamp(dp.GetTimeUnixNano()))
+		}
+	case *metricspb.Metric_Sum:
+		// only delta sums are increments, cumulative sums are running totals
+		// and non-monotonic sums can go down, both are sent as gauges
+		counter := data.Sum.GetIsMonotonic() &&
+			data.Sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+		for _, dp := range data.Sum.GetDataPoints() {
+			fields := map[string]interface{}{m.GetName(): numberValue(dp)}
+			t := tags(resourceTags, dp.GetAttributes())
+			if counter {
+				o.acc.AddCounter(measurement, fields, t, timestamp(dp.GetTimeUnixNano()))
+			} else {
+				o.acc.AddGauge(measurement, fields, t, timestamp(dp.GetTimeUnixNano()))
+			}
+		}
+	case *metricspb.Metric_Histogram:
+		cumulative := data.Histogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		for _, dp := range data.Histogram.GetDataPoints() {
+			o.addHistogram(measurement, m.GetName(), cumulative,
+				tags(resourceTags, dp.GetAttributes()),
+				timestamp(dp.GetTimeUnixNano()),
+				explicitBuckets(dp),
+				dp.GetCount(), dp.Sum, dp.Min, dp.Max)
+		}
+	case *metricspb.Metric_ExponentialHistogram:
+		cumulative := data.ExponentialHistogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		for _, dp := range data.ExponentialHistogram.GetDataPoints() {
+			o.addHistogram(measurement, m.GetName(), cumulative,
+				tags(resourceTags, dp.GetAttributes()),
+				timestamp(dp.GetTimeUnixNano()),
+				exponentialBuckets(dp),
+				dp.GetCount(), dp.Sum, dp.Min, dp.Max)
+		}
+	case *metricspb.Metric_Summary:
+		for _, dp := range data.Summary.GetDataPoints() {
+			fields := map[string]interface{}{
+				m.GetName() + "_count": dp.GetCount(),
+				m.GetName() + "_sum":   dp.GetSum(),
+			}
+			for _, q := range dp.GetQuantileValues() {
+				fields[m.GetName()+"_"+strconv.FormatFloat(q.GetQuantile(), 'f', -1, 64)] = q.GetValue()
+			}
+			o.acc.AddSummary(measurement, fields,
+				tags(resourceTags, dp.GetAttributes()),
+				timestamp(dp.GetTimeUnixNano()))
+		}
+	default:
+		o.Log.Debugf("Unsupported data type for metric %q", m.GetName())
+	}
+}
+
+func (o *OpenTelemetry) addHistogram(measurement, name string, cumulative bool,
+	tags map[string]string, ts time.Time,
+	buckets map[string]interface{},
+	count uint64, sum, minv, maxv *float64) {
+
+	fields := map[string]interface{}{name + "_count": count}
+	if sum != nil {
+		fields[name+"_sum"] = *sum
+	}
+	if cumulative {
+		o.acc.AddGauge(measurement, fields, tags, ts)
+	} else {
+		o.acc.AddCounter(measurement, fields, tags, ts)
+	}
+	fields = make(map[string]interface{})
+	if minv != nil {
+		fields[name+"_min"] = *minv
+	}
+	if maxv != nil {
+		fields[name+"_max"] = *maxv
+	}
+	if len(fields) > 0 {
+		o.acc.AddGauge(measurement, fields, tags, ts)
+	}
+
+	if len(buckets) == 0 {
+		return
+	}
+
+	// unlike other metrics the "fields" of a histogram are the buckets, the
+	// scope is the metric group so the histogram goes to the same check as
+	// the other metrics from the scope
+	htags := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		htags[k] = v
+	}
+	htags["input_metric_group"] = measurement
+	if cumulative {
+		o.acc.AddCumulativeHistogram(name, buckets, htags, ts)
+	} else {
+		o.acc.AddHistogram(name, buckets, htags, ts)
+	}
+}
+
+// explicitBuckets returns the non-empty buckets keyed by their upper bound. The
+// overflow bucket has no upper bound, the max (or the last bound) is used.
+func explicitBuckets(dp *metricspb.HistogramDataPoint) map[string]interface{} {
+	bounds := dp.GetExplicitBounds()
+	buckets := make(map[string]interface{})
+	for i, count := range dp.GetBucketCounts() {
+		if count == 0 {
+			continue
+		}
+		var bound float64
+		switch {
+		case i < len(bounds):
+			bound = bounds[i]
+		case dp.Max != nil:
+			bound = *dp.Max
+		case len(bounds) > 0:
+			bound = bounds[len(bounds)-1]
+		}
+		addBucket(buckets, bound, count)
+	}
+	return buckets
+}
+
+// exponentialBuckets returns the non-empty buckets keyed by the bound furthest
+// from zero, bucket index i covers (base^i, base^(i+1)] where base is 2^(2^-scale).
+func exponentialBuckets(dp *metricspb.ExponentialHistogramDataPoint) map[string]interface{} {
+	factor := math.Exp2(-float64(dp.GetScale()))
+	bound := func(index int) float64 {
+		return math.Exp2(float64(index+1) * factor)
+	}
+
+	buckets := make(map[string]interface{})
+	if dp.GetZeroCount() > 0 {
+		addBucket(buckets, 0, dp.GetZeroCount())
+	}
+	for i, count := range dp.GetPositive().GetBucketCounts() {
+		if count > 0 {
+			addBucket(buckets, bound(int(dp.GetPositive().GetOffset())+i), count)
+		}
+	}
+	for i, count := range dp.GetNegative().GetBucketCounts() {
+		if count > 0 {
+			addBucket(buckets, -bound(int(dp.GetNegative().GetOffset())+i), count)
+		}
+	}
+	return buckets
+}
+
+func addBucket(buckets map[string]interface{}, bound float64, count uint64) {
+	key := fmt.Sprintf("%e", bound)
+	if c, ok := buckets[key].(int64); ok {
+		buckets[key] = c + int64(count)
+		return
+	}
+	buckets[key] = int64(count)
+}
+
+// tags merges the resource tags with the data point attributes
+func tags(resourceTags map[string]string, attrs []*commonpb.KeyValue) map[string]string {
+	t := make(map[string]string, len(resourceTags)+len(attrs))
+	for k, v := range resourceTags {
+		t[k] = v
+	}
+	for _, kv := range attrs {
+		if v, ok := attributeValue(kv.GetValue()); ok {
+			t[kv.GetKey()] = v
+		}
+	}
+	return t
+}
+
+// attributeValue returns the attribute as a tag value, array, map and
+// bytes values can't be represented as tags and are skipped
+func attributeValue(v *commonpb.AnyValue) (string, bool) {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue, val.StringValue != ""
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(val.BoolValue), true
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(val.IntValue, 10), true
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(val.DoubleValue, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+func numberValue(dp *metricspb.NumberDataPoint) interface{} {
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		return v.AsInt
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble
+	default:
+		return 0.0
+	}
+}
+
+func timestamp(unixNano uint64) time.Time {
+	if unixNano == 0 {
+		return time.Now()
+	}
+	return time.Unix(0, int64(unixNano))
+}
@@ -0,0 +1,299 @@
+package opentelemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/filter"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
+	tlsint "github.com/circonus-labs/circonus-unified-agent/plugins/common/tls"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/inputs"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"     // Register GRPC gzip decoder to support compressed requests
+	_ "google.golang.org/grpc/encoding/gzip" //nolint:golint
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// defaultMaxMsgSize is the default maximum size, in bytes, of a gRPC
+	// message or HTTP request body (after decompression), 4 MiB
+	defaultMaxMsgSize = 4 * 1024 * 1024
+
+	metricsPath = "/v1/metrics"
+
+	contentTypeProtobuf = "application/x-protobuf"
+	contentTypeJSON     = "application/json"
+)
+
+var sampleConfig = `
+  instance_id = "" # unique instance identifier (REQUIRED)
+
+  ## Address and port for the OTLP/gRPC receiver, set to "" to disable
+  service_address = ":4317"
+
+  ## Address and port for the OTLP/HTTP receiver (POST /v1/metrics with
+  ## protobuf or JSON encoded requests), set to "" to disable
+  http_service_address = ":4318"
+
+  ## Maximum size of a request, after decompression
+  # max_msg_size = "4MiB"
+
+  ## Maximum duration before timing out read of an HTTP request and the
+  ## write of its response
+  # read_timeout = "10s"
+  # write_timeout = "10s"
+
+  ## Resource attributes (e.g. service.name, host.name) added as tags,
+  ## by default all are added.
+  # resource_attributes = ["*"]
+  # exclude_resource_attributes = []
+
+  ## Set one or more allowed client CA certificate file names to
+  ## enable mutually authenticated TLS connections
+  # tls_allowed_cacerts = ["/opt/circonus/unified-agent/etc/clientca.pem"]
+
+  ## Add service certificate and key
+  # tls_cert = "/opt/circonus/unified-agent/etc/cert.pem"
+  # tls_key = "/opt/circonus/unified-agent/etc/key.pem"
+`
+
+// OpenTelemetry receives metrics from OpenTelemetry SDKs and collectors
+// using the OTLP protocol over gRPC and HTTP.
+type OpenTelemetry struct {
+	ServiceAddress            string            `toml:"service_address"`
+	HTTPServiceAddress        string            `toml:"http_service_address"`
+	MaxMsgSize                internal.Size     `toml:"max_msg_size"`
+	ReadTimeout               internal.Duration `toml:"read_timeout"`
+	WriteTimeout              internal.Duration `toml:"write_timeout"`
+	ResourceAttributes        []string          `toml:"resource_attributes"`
+	ExcludeResourceAttributes []string          `toml:"exclude_resource_attributes"`
+	tlsint.ServerConfig
+
+	Log cua.Logger
+
+	colmetrics.UnimplementedMetricsServiceServer
+
+	attrFilter filter.Filter
+	acc        cua.Accumulator
+	grpcServer *grpc.Server
+	httpServer *http.Server
+	grpcAddr   net.Addr
+	httpAddr   net.Addr
+	wg         sync.WaitGroup
+}
+
+func (o *OpenTelemetry) Description() string {
+	return "Receive OpenTelemetry metrics over OTLP gRPC and HTTP"
+}
+
+func (o *OpenTelemetry) SampleConfig() string {
+	return sampleConfig
+}
+
+func (o *OpenTelemetry) Init() error {
+	if o.ServiceAddress == "" && o.HTTPServiceAddress == "" {
+		return fmt.Errorf("service_address or http_service_address is required")
+	}
+	if o.MaxMsgSize.Size == 0 {
+		o.MaxMsgSize.Size = defaultMaxMsgSize
+	}
+	if o.ReadTimeout.Duration < time.Second {
+		o.ReadTimeout.Duration = time.Second * 10
+	}
+	if o.WriteTimeout.Duration < time.Second {
+		o.WriteTimeout.Duration = time.Second * 10
+	}
+
+	f, err := filter.NewIncludeExcludeFilter(o.ResourceAttributes, o.ExcludeResourceAttributes)
+	if err != nil {
+		return fmt.Errorf("resource attributes filter: %w", err)
+	}
+	o.attrFilter = f
+
+	return nil
+}
+
+func (o *OpenTelemetry) Gather(_ context.Context, _ cua.Accumulator) error {
+	return nil
+}
+
+// Start starts the gRPC and HTTP receivers.
+func (o *OpenTelemetry) Start(_ context.Context, acc cua.Accumulator) error {
+	o.acc = acc
+
+	tlsConfig, err := o.ServerConfig.TLSConfig()
+	if err != nil {
+		return fmt.Errorf("TLSConfig: %w", err)
+	}
+
+	if o.ServiceAddress != "" {
+		if err := o.startGRPC(tlsConfig); err != nil {
+			return err
+		}
+	}
+
+	if o.HTTPServiceAddress != "" {
+		if err := o.startHTTP(tlsConfig); err != nil {
+			o.Stop()
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (o *OpenTelemetry) startGRPC(tlsConfig *tls.Config) error {
+	listener, err := net.Listen("tcp", o.ServiceAddress)
+	if err != nil {
+		return fmt.Errorf("listen (%s): %w", o.ServiceAddress, err)
+	}
+
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(int(o.MaxMsgSize.Size))}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	o.grpcAddr = listener.Addr()
+	o.grpcServer = grpc.NewServer(opts...)
+	colmetrics.RegisterMetricsServiceServer(o.grpcServer, o)
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		if err := o.grpcServer.Serve(listener); err != nil {
+			o.Log.Error(err)
+		}
+	}()
+
+	o.Log.Infof("Listening for OTLP/gRPC on %s", o.grpcAddr.String())
+
+	return nil
+}
+
+func (o *OpenTelemetry) startHTTP(tlsConfig *tls.Config) error {
+	var listener net.Listener
+	var err error
+	if tlsConfig != nil {
+		listener, err = tls.Listen("tcp", o.HTTPServiceAddress, tlsConfig)
+	} else {
+		listener, err = net.Listen("tcp", o.HTTPServiceAddress)
+	}
+	if err != nil {
+		return fmt.Errorf("listen (%s): %w", o.HTTPServiceAddress, err)
+	}
+
+	o.httpAddr = listener.Addr()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(metricsPath, o.serveMetrics)
+	o.httpServer = &http.Server{
+		Handler:      mux,
+		ReadTimeout:  o.ReadTimeout.Duration,
+		WriteTimeout: o.WriteTimeout.Duration,
+		TLSConfig:    tlsConfig,
+	}
+
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		if err := o.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			o.Log.Error(err)
+		}
+	}()
+
+	o.Log.Infof("Listening for OTLP/HTTP on %s", o.httpAddr.String())
+
+	return nil
+}
+
+// Stop shuts down the receivers
+func (o *OpenTelemetry) Stop() {
+	if o.grpcServer != nil {
+		o.grpcServer.Stop()
+	}
+	if o.httpServer != nil {
+		_ = o.httpServer.Close()
+	}
+	o.wg.Wait()
+}
+
+// Export is the OTLP/gRPC metrics service method
+func (o *OpenTelemetry) Export(_ context.Context, req *colmetrics.ExportMetricsServiceRequest) (*colmetrics.ExportMetricsServiceResponse, error) {
+	o.addMetrics(req)
+	return &colmetrics.ExportMetricsServiceResponse{}, nil
+}
+
+// serveMetrics handles OTLP/HTTP requests, the response is encoded the same as the request
+func (o *OpenTelemetry) serveMetrics(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(res, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	var (
+		unmarshal func([]byte, proto.Message) error
+		marshal   func(proto.Message) ([]byte, error)
+	)
+	switch contentType {
+	case contentTypeProtobuf:
+		unmarshal, marshal = proto.Unmarshal, proto.Marshal
+	case contentTypeJSON:
+		unmarshal, marshal = protojson.Unmarshal, protojson.Marshal
+	default:
+		http.Error(res, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if req.ContentLength > o.MaxMsgSize.Size {
+		http.Error(res, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	body, err := internal.NewStreamContentDecoder(req.Header.Get("Content-Encoding"), req.Body)
+	if err != nil {
+		o.Log.Debugf("Content encoding: %s", err)
+		http.Error(res, "bad request", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(res, io.NopCloser(body), o.MaxMsgSize.Size))
+	if err != nil {
+		http.Error(res, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var exportReq colmetrics.ExportMetricsServiceRequest
+	if err := unmarshal(data, &exportReq); err != nil {
+		o.Log.Debugf("Parse error: %s", err)
+		http.Error(res, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	o.addMetrics(&exportReq)
+
+	resp, err := marshal(&colmetrics.ExportMetricsServiceResponse{})
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", contentType)
+	_, _ = res.Write(resp)
+}
+
+func init() {
+	inputs.Add("opentelemetry", func() cua.Input {
+		return &OpenTelemetry{
+			ServiceAddress:     ":4317",
+			HTTPServiceAddress: ":4318",
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package opentelemetry
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+	colmetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+func stringAttr(k, v string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: k, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: v}}}
+}
+
+func testRequest(ts time.Time) *colmetrics.ExportMetricsServiceRequest {
+	sum := 12.5
+	maxv := 30.0
+	return &colmetrics.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{
+				stringAttr("service.name", "checkout"),
+				stringAttr("process.command_line", "/usr/bin/checkout"),
+			}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope: &commonpb.InstrumentationScope{Name: "app"},
+				Metrics: []*metricspb.Metric{
+					{
+						Name: "requests",
+						Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+							AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+							IsMonotonic:            true,
+							DataPoints: []*metricspb.NumberDataPoint{{
+								Attributes:   []*commonpb.KeyValue{stringAttr("route", "/pay")},
+								TimeUnixNano: uint64(ts.UnixNano()),
+								Value:        &metricspb.NumberDataPoint_AsInt{AsInt: 3},
+							}},
+						}},
+					},
+					{
+						Name: "latency",
+						Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+							AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+							DataPoints: []*metricspb.HistogramDataPoint{{
+								TimeUnixNano:   uint64(ts.UnixNano()),
+								Count:          4,
+								Sum:            &sum,
+								Max:            &maxv,
+								ExplicitBounds: []float64{1, 5, 10},
+								BucketCounts:   []uint64{1, 0, 2, 1},
+							}},
+						}},
+					},
+					{
+						Name: "size",
+						Data: &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+							AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+							DataPoints: []*metricspb.ExponentialHistogramDataPoint{{
+								TimeUnixNano: uint64(ts.UnixNano()),
+								Count:        6,
+								Scale:        0,
+								ZeroCount:    1,
+								Positive:     &metricspb.ExponentialHistogramDataPoint_Buckets{Offset: 1, BucketCounts: []uint64{2, 3}},
+							}},
+						}},
+					},
+				},
+			}},
+		}},
+	}
+}
+
+func expectedMetrics(ts time.Time) []cua.Metric {
+	tags := map[string]string{"service.name": "checkout"}
+	histTags := map[string]string{"service.name": "checkout", "input_metric_group": "app"}
+	return []cua.Metric{
+		testutil.MustMetric("app",
+			map[string]string{"service.name": "checkout", "route": "/pay"},
+			map[string]interface{}{"requests": int64(3)},
+			ts, cua.Counter),
+		testutil.MustMetric("app", tags,
+			map[string]interface{}{"latency_count": uint64(4), "latency_sum": 12.5},
+			ts, cua.Counter),
+		testutil.MustMetric("app", tags,
+			map[string]interface{}{"latency_max": 30.0},
+			ts, cua.Gauge),
+		testutil.MustMetric("latency", histTags,
+			map[string]interface{}{"1.000000e+00": int64(1), "1.000000e+01": int64(2), "3.000000e+01": int64(1)},
+			ts, cua.Histogram),
+		testutil.MustMetric("app", tags,
+			map[string]interface{}{"size_count": uint64(6)},
+			ts, cua.Gauge),
+		testutil.MustMetric("size", histTags,
+			map[string]interface{}{"0.000000e+00": int64(1), "4.000000e+00": int64(2), "8.000000e+00": int64(3)},
+			ts, cua.CumulativeHistogram),
+	}
+}
+
+func newTestOpenTelemetry(t *testing.T) (*OpenTelemetry, *testutil.Accumulator) {
+	t.Helper()
+	o := &OpenTelemetry{
+		ServiceAddress:            "127.0.0.1:0",
+		HTTPServiceAddress:        "127.0.0.1:0",
+		ExcludeResourceAttributes: []string{"process.*"},
+		Log:                       testutil.Logger{},
+	}
+	require.NoError(t, o.Init())
+	acc := &testutil.Accumulator{}
+	require.NoError(t, o.Start(context.Background(), acc))
+	t.Cleanup(o.Stop)
+	return o, acc
+}
+
+func TestOpenTelemetryGRPC(t *testing.T) {
+	o, acc := newTestOpenTelemetry(t)
+	ts := time.Unix(1700000000, 0)
+
+	conn, err := grpc.Dial(o.grpcAddr.String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = colmetrics.NewMetricsServiceClient(conn).Export(context.Background(), testRequest(ts))
+	require.NoError(t, err)
+
+	testutil.RequireMetricsEqual(t, expectedMetrics(ts), acc.GetCUAMetrics(), testutil.SortMetrics())
+}
+
+func TestOpenTelemetryHTTP(t *testing.T) {
+	o, acc := newTestOpenTelemetry(t)
+	ts := time.Unix(1700000000, 0)
+	url := "http://" + o.httpAddr.String() + metricsPath
+
+	body, err := proto.Marshal(testRequest(ts))
+	require.NoError(t, err)
+	resp, err := http.Post(url, contentTypeProtobuf, bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, contentTypeProtobuf, resp.Header.Get("Content-Type"))
+
+	testutil.RequireMetricsEqual(t, expectedMetrics(ts), acc.GetCUAMetrics(), testutil.SortMetrics())
+
+	resp, err = http.Post(url, "text/plain", bytes.NewReader(body))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+
+	resp, err = http.Post(url, contentTypeProtobuf, bytes.NewReader([]byte("not protobuf")))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestOpenTelemetryInit(t *testing.T) {
+	require.Error(t, (&OpenTelemetry{}).Init())
+}
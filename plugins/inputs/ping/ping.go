@@ -87,6 +87,7 @@ type Ping struct {
 	Binary            string
 	SubmissionTimeout string `toml:"submission_timeout"`
 	Broker            string `toml:"broker"`
+	CirconusProfile   string `toml:"circonus_profile"`
 	sourceAddress     string
 	Arguments         []string
 	Urls              []string
@@ -393,8 +394,9 @@ func percentile(values durationSlice, perc int) time.Duration {
 	return lower + time.Duration(rankFraction*float64(upper-lower))
 }
 
-// Init ensures the plugin is configured correctly.
-func (p *Ping) Init() error {
+// CheckConfig ensures the plugin is configured correctly, without creating the
+// direct_metrics check.
+func (p *Ping) CheckConfig() error {
 	if p.Count < 1 {
 		return errors.New("bad number of packets to transmit")
 	}
@@ -430,6 +432,15 @@ func (p *Ping) Init() error {
 		}
 	}
 
+	return nil
+}
+
+// Init ensures the plugin is configured correctly.
+func (p *Ping) Init() error {
+	if err := p.CheckConfig(); err != nil {
+		return err
+	}
+
 	if p.DirectMetrics {
 		opts := &circmgr.MetricDestConfig{
 			MetricMeta: circmgr.MetricMeta{
@@ -437,6 +448,7 @@ func (p *Ping) Init() error {
 				InstanceID: p.InstanceID,
 			},
 			Broker:            p.Broker,
+			Profile:           p.CirconusProfile,
 			DebugAPI:          p.DebugAPI,
 			TraceMetrics:      p.TraceMetrics,
 			CheckTags:         p.CheckTags,
@@ -21,9 +21,10 @@ import (
 	"github.com/prometheus/common/expfmt"
 )
 
-// Parse returns a slice of Metrics from a text representation of a
-// metrics
-func ParseV2(buf []byte, header http.Header) ([]cua.Metric, error) {
+// ParseV2 returns a slice of Metrics from a text representation of a
+// metrics. When circonusHistograms is set, histograms are returned as
+// Circonus cumulative histograms rather than a gauge per bucket.
+func ParseV2(buf []byte, header http.Header, circonusHistograms bool) ([]cua.Metric, error) {
 	var metrics []cua.Metric
 	var parser expfmt.TextParser
 	// parse even if the buffer begins with a newline
@@ -71,7 +72,12 @@ func ParseV2(buf []byte, header http.Header) ([]cua.Metric, error) {
 				metrics = append(metrics, agentMetrics...)
 			case dto.MetricType_HISTOGRAM:
 				// histogram metric
-				agentMetrics := makeBucketsV2(m, tags, metricName, mf.GetType(), now)
+				var agentMetrics []cua.Metric
+				if circonusHistograms {
+					agentMetrics = makeCirconusHistogramV2(m, tags, metricName, now)
+				} else {
+					agentMetrics = makeBucketsV2(m, tags, metricName, mf.GetType(), now)
+				}
 				metrics = append(metrics, agentMetrics...)
 			default:
 				// standard metric
@@ -163,6 +169,63 @@ func makeBucketsV2(m *dto.Metric, tags map[string]string, metricName string, met
 	return metrics
 }
 
+// Get a circonus histogram from a histogram metric. Prometheus bucket counts are
+// cumulative across buckets, they are converted to a count per bucket keyed by the
+// bucket's upper bound. The counts are also cumulative over time (since the process
+// exposing them started) so a cumulative histogram is used. The +Inf bucket is
+// recorded at the same overflow bound used for stackdriver distributions.
+func makeCirconusHistogramV2(m *dto.Metric, tags map[string]string, metricName string, now time.Time) []cua.Metric {
+	var metrics []cua.Metric
+	var t time.Time
+	if m.TimestampMs != nil && *m.TimestampMs > 0 {
+		t = time.Unix(0, *m.TimestampMs*1000000)
+	} else {
+		t = now
+	}
+
+	fields := map[string]interface{}{
+		metricName + "_count": float64(m.GetHistogram().GetSampleCount()),
+		metricName + "_sum":   m.GetHistogram().GetSampleSum(),
+	}
+	met, err := metric.New("prometheus", tags, fields, t, cua.Gauge)
+	if err == nil {
+		metrics = append(metrics, met)
+	}
+
+	buckets := make(map[string]interface{})
+	prev := uint64(0)
+	for _, b := range m.GetHistogram().Bucket {
+		cumulative := b.GetCumulativeCount()
+		if cumulative < prev {
+			// malformed histogram, bucket counts must be non-decreasing
+			return metrics
+		}
+		count := cumulative - prev
+		prev = cumulative
+		if count == 0 {
+			continue
+		}
+		upperBound := b.GetUpperBound()
+		if math.IsInf(upperBound, 1) {
+			upperBound = 10e+127
+		}
+		buckets[fmt.Sprintf("%e", upperBound)] = int64(count)
+	}
+	// the +Inf bucket is implicit in the text format, it is the total sample count
+	if total := m.GetHistogram().GetSampleCount(); total > prev {
+		buckets[fmt.Sprintf("%e", 10e+127)] = int64(total - prev)
+	}
+
+	if len(buckets) > 0 {
+		hist, err := metric.New(metricName, tags, buckets, t, cua.CumulativeHistogram)
+		if err == nil {
+			metrics = append(metrics, hist)
+		}
+	}
+
+	return metrics
+}
+
 // Parse returns a slice of Metrics from a text representation of a
 // metrics
 func Parse(buf []byte, header http.Header) ([]cua.Metric, error) {
@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"testing"
 
+	"github.com/circonus-labs/circonus-unified-agent/cua"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // var exptime = time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
@@ -164,3 +166,33 @@ func TestParseValidPrometheus(t *testing.T) {
 		metrics[0].Tags())
 
 }
+
+func TestParseV2CirconusHistogram(t *testing.T) {
+	metrics, err := ParseV2([]byte(validUniqueHistogram), http.Header{}, true)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+
+	tags := map[string]string{"verb": "POST", "resource": "bindings"}
+
+	assert.Equal(t, "prometheus", metrics[0].Name())
+	assert.Equal(t, cua.Gauge, metrics[0].Type())
+	assert.Equal(t, map[string]interface{}{
+		"apiserver_request_latencies_count": 2025.0,
+		"apiserver_request_latencies_sum":   1.02726334e+08,
+	}, metrics[0].Fields())
+	assert.Equal(t, tags, metrics[0].Tags())
+
+	assert.Equal(t, "apiserver_request_latencies", metrics[1].Name())
+	assert.Equal(t, cua.CumulativeHistogram, metrics[1].Type())
+	assert.Equal(t, map[string]interface{}{
+		"1.250000e+05":  int64(1994),
+		"2.500000e+05":  int64(3),
+		"5.000000e+05":  int64(3),
+		"1.000000e+06":  int64(5),
+		"2.000000e+06":  int64(7),
+		"4.000000e+06":  int64(5),
+		"8.000000e+06":  int64(7),
+		"1.000000e+128": int64(1),
+	}, metrics[1].Fields())
+	assert.Equal(t, tags, metrics[1].Tags())
+}
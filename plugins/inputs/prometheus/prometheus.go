@@ -55,6 +55,9 @@ type Prometheus struct {
 
 	MetricVersion int `toml:"metric_version"`
 
+	// Emit histograms as circonus histograms instead of a gauge per bucket
+	CirconusHistograms bool `toml:"circonus_histograms"`
+
 	URLTag string `toml:"url_tag"`
 
 	tls.ClientConfig
@@ -100,6 +103,11 @@ var sampleConfig = `
   ## Url tag name (tag containing scrapped url. optional, default is "url")
   # url_tag = "url"
   
+  ## Emit histograms as circonus histograms, rather than a gauge for each
+  ## bucket (tagged with "le"), so that percentiles can be calculated.
+  ## Summaries are pre-computed quantiles and are always emitted as gauges.
+  # circonus_histograms = false
+
   ## Whether the timestamp of the scraped metrics will be ignored.
   ## If set to true, the gather time will be used.
   # ignore_timestamp = false
@@ -435,7 +443,7 @@ func (p *Prometheus) gatherURL(u URLAndAddress, acc cua.Accumulator) error {
 	// Circonus uses fields as metrics, making the fields be the metric type does not provide
 	// any value as types are not good metric names.
 	// if p.MetricVersion == 2 {
-	metrics, err = ParseV2(body, resp.Header)
+	metrics, err = ParseV2(body, resp.Header, p.CirconusHistograms)
 	// } else {
 	// metrics, err = Parse(body, resp.Header)
 	// }
@@ -467,6 +475,8 @@ func (p *Prometheus) gatherURL(u URLAndAddress, acc cua.Accumulator) error {
 			acc.AddSummary(metric.Name(), metric.Fields(), tags, metric.Time())
 		case cua.Histogram:
 			acc.AddHistogram(metric.Name(), metric.Fields(), tags, metric.Time())
+		case cua.CumulativeHistogram:
+			acc.AddCumulativeHistogram(metric.Name(), metric.Fields(), tags, metric.Time())
 		default:
 			acc.AddFields(metric.Name(), metric.Fields(), tags, metric.Time())
 		}
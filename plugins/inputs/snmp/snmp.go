@@ -116,10 +116,11 @@ func execCmd(arg0 string, args ...string) ([]byte, error) {
 type Snmp struct {
 	Log               cua.Logger
 	metricDestination *trapmetrics.TrapMetrics // direct metrics mode - send directly to circonus (bypassing output)
-	DebugAPI          *bool                    `toml:"debug_api"`     // direct metrics mode - send directly to circonus (bypassing output)
-	TraceMetrics      *string                  `toml:"trace_metrics"` // direct metrics mode - send directly to circonus (bypassing output)
-	FlushDelay        string                   `toml:"flush_delay"`   // direct metrics mode - send directly to circonus (bypassing output)
-	Broker            string                   `toml:"broker"`        // direct metrics mode - send directly to circonus (bypassing output)
+	DebugAPI          *bool                    `toml:"debug_api"`        // direct metrics mode - send directly to circonus (bypassing output)
+	TraceMetrics      *string                  `toml:"trace_metrics"`    // direct metrics mode - send directly to circonus (bypassing output)
+	FlushDelay        string                   `toml:"flush_delay"`      // direct metrics mode - send directly to circonus (bypassing output)
+	Broker            string                   `toml:"broker"`           // direct metrics mode - send directly to circonus (bypassing output)
+	CirconusProfile   string                   `toml:"circonus_profile"` // direct metrics mode - circonus account to send to
 	Name              string                   // Name & Fields are the elements of a Table.
 	AgentHostTag      string                   `toml:"agent_host_tag"` // The tag used to name the agent host
 	InstanceID        string                   `toml:"instance_id"`    // direct metrics mode - send directly to circonus (bypassing output)
@@ -163,6 +164,7 @@ func (s *Snmp) init() error {
 				InstanceID: s.InstanceID,
 			},
 			Broker:            s.Broker,
+			Profile:           s.CirconusProfile,
 			DebugAPI:          s.DebugAPI,
 			TraceMetrics:      s.TraceMetrics,
 			CheckTags:         s.CheckTags,
@@ -181,6 +181,7 @@ type Statsd struct {
 	CheckDisplayName       string `toml:"check_display_name"` // direct metrics - check display name
 	CheckTarget            string `toml:"check_target"`       // direct metrics - check target
 	Broker                 string `toml:"broker"`             // direct metrics
+	CirconusProfile        string `toml:"circonus_profile"`   // direct metrics - circonus account to send to
 	MetricSeparator        string
 	ServiceAddress         string
 	Protocol               string `toml:"protocol"`
@@ -364,6 +365,7 @@ func (s *Statsd) Start(ctx context.Context, ac cua.Accumulator) error {
 			InstanceID: s.InstanceID,
 		},
 		Broker:           s.Broker,
+		Profile:          s.CirconusProfile,
 		DebugAPI:         s.DebugAPI,
 		TraceMetrics:     s.TraceMetrics,
 		CheckTags:        s.CheckTags,
@@ -0,0 +1,16 @@
+//go:build !solaris && !windows
+// +build !solaris,!windows
+
+package tail
+
+import (
+	"os"
+	"syscall"
+)
+
+func inode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino) //nolint:unconvert // Ino is not uint64 on all platforms
+	}
+	return 0
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package tail
+
+import "os"
+
+// inode is not available from os.FileInfo on windows, offsets are only keyed by path.
+func inode(_ os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,231 @@
+//go:build !solaris
+// +build !solaris
+
+package tail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+)
+
+// fileOffset is the read position in a tailed file. The inode identifies the
+// file so rotation can be detected, it is always zero on windows.
+type fileOffset struct {
+	Inode  uint64 `json:"inode,omitempty"`
+	Offset int64  `json:"offset"`
+}
+
+// offsetStore holds the read offsets of the tailed files saved before the agent
+// restarted, either in offsets_directory or the agent's plugin state.
+type offsetStore struct {
+	offsets map[string]fileOffset // keyed by path
+	path    string
+}
+
+// newOffsetStore returns the store for a set of file patterns in dir, the
+// patterns name the file so instances tailing different files don't collide.
+func newOffsetStore(dir string, files []string) (*offsetStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("offsets directory: %w", err)
+	}
+
+	patterns := append([]string{}, files...)
+	sort.Strings(patterns)
+	sum := sha256.Sum256([]byte(strings.Join(patterns, "\n")))
+
+	s := &offsetStore{
+		path:    filepath.Join(dir, "tail-"+hex.EncodeToString(sum[:8])+".json"),
+		offsets: make(map[string]fileOffset),
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("reading offsets: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.offsets); err != nil {
+		return nil, fmt.Errorf("parsing offsets %s: %w", s.path, err)
+	}
+	return s, nil
+}
+
+// resume returns the offset to start reading file from, if one was saved.
+func (s *offsetStore) resume(file string) (int64, bool) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return 0, false
+	}
+	ino := inode(info)
+
+	if saved, ok := s.offsets[file]; ok && saved.Inode == ino {
+		if saved.Offset > info.Size() {
+			// truncated while the agent was stopped
+			return 0, true
+		}
+		return saved.Offset, true
+	}
+
+	if ino != 0 {
+		// rotated (renamed) while the agent was stopped
+		for path, saved := range s.offsets {
+			if path == file || saved.Inode != ino {
+				continue
+			}
+			if saved.Offset > info.Size() {
+				return 0, true
+			}
+			return saved.Offset, true
+		}
+	}
+
+	if _, ok := s.offsets[file]; ok {
+		// a new file replaced the one read before, none of it has been read
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// save replaces the saved offsets, they are only written to disk when the
+// store has a path.
+func (s *offsetStore) save(offsets map[string]fileOffset) error {
+	if s.path == "" {
+		s.offsets = offsets
+		return nil
+	}
+
+	data, err := json.Marshal(offsets)
+	if err != nil {
+		return fmt.Errorf("json marshal: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o640); err != nil {
+		return fmt.Errorf("writing offsets: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("writing offsets: %w", err)
+	}
+
+	s.offsets = offsets
+	return nil
+}
+
+// deliveryOffsets tracks the offset in each tailed file up to which the lines read
+// have been delivered, so the saved offsets don't skip the lines still queued in the
+// agent when it stops. Groups can be delivered out of order, a file's offset only
+// advances past a group once the groups read before it were delivered too.
+type deliveryOffsets struct {
+	files   map[string]*fileDeliveries
+	pending map[cua.TrackingID]string // undelivered group -> file
+	early   map[cua.TrackingID]bool   // delivered before being tracked (e.g. empty groups)
+	mu      sync.Mutex
+}
+
+// fileDeliveries are the undelivered groups of a file, in the order they were read.
+type fileDeliveries struct {
+	groups    []trackedGroup
+	delivered fileOffset
+}
+
+type trackedGroup struct {
+	offset fileOffset // after the last line of the group
+	id     cua.TrackingID
+	done   bool
+}
+
+func newDeliveryOffsets() *deliveryOffsets {
+	return &deliveryOffsets{
+		files:   make(map[string]*fileDeliveries),
+		pending: make(map[cua.TrackingID]string),
+		early:   make(map[cua.TrackingID]bool),
+	}
+}
+
+// start begins tracking a file, reading starts at offset.
+func (d *deliveryOffsets) start(file string, offset fileOffset) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if f, ok := d.files[file]; ok {
+		for _, g := range f.groups {
+			delete(d.pending, g.id)
+		}
+	}
+	d.files[file] = &fileDeliveries{delivered: offset}
+}
+
+// track records the offset after the lines of a group added to the accumulator.
+func (d *deliveryOffsets) track(file string, id cua.TrackingID, offset fileOffset) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, ok := d.files[file]
+	if !ok {
+		delete(d.early, id)
+		return
+	}
+	done := d.early[id]
+	if done {
+		delete(d.early, id)
+	} else {
+		d.pending[id] = file
+	}
+	f.groups = append(f.groups, trackedGroup{id: id, offset: offset, done: done})
+	f.advance()
+}
+
+// delivered marks a group as delivered, whether its metrics were accepted or not:
+// reading them again would not deliver them either.
+func (d *deliveryOffsets) delivered(id cua.TrackingID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	file, ok := d.pending[id]
+	if !ok {
+		d.early[id] = true
+		return
+	}
+	delete(d.pending, id)
+	f := d.files[file]
+	for i := range f.groups {
+		if f.groups[i].id == id {
+			f.groups[i].done = true
+			break
+		}
+	}
+	f.advance()
+}
+
+// offset returns the offset in file up to which the lines read were delivered.
+func (d *deliveryOffsets) offset(file string) (fileOffset, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, ok := d.files[file]
+	if !ok {
+		return fileOffset{}, false
+	}
+	return f.delivered, true
+}
+
+func (f *fileDeliveries) advance() {
+	n := 0
+	for n < len(f.groups) && f.groups[n].done {
+		f.delivered = f.groups[n].offset
+		n++
+	}
+	f.groups = f.groups[n:]
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -41,6 +42,7 @@ type semaphore chan empty
 
 type Tail struct {
 	wg                  sync.WaitGroup
+	mu                  sync.Mutex // tailers and lastOffsets, GetState is called concurrently
 	acc                 cua.TrackingAccumulator
 	Log                 cua.Logger `toml:"-"`
 	ctx                 context.Context
@@ -50,9 +52,13 @@ type Tail struct {
 	cancel              context.CancelFunc
 	tailers             map[string]*tail.Tail
 	offsets             map[string]int64
+	offsetStore         *offsetStore
+	deliveries          *deliveryOffsets
+	lastOffsets         map[string]fileOffset
 	parserFunc          parsers.ParserFunc
 	CharacterEncoding   string          `toml:"character_encoding"`
 	WatchMethod         string          `toml:"watch_method"`
+	OffsetsDirectory    string          `toml:"offsets_directory"`
 	Files               []string        `toml:"files"`
 	MultilineConfig     MultilineConfig `toml:"multiline"`
 	MaxUndeliveredLines int             `toml:"max_undelivered_lines"`
@@ -92,6 +98,11 @@ const sampleConfig = `
   ## Read file from beginning.
   # from_beginning = false
 
+  ## Directory to save the read offset of each file in, reading resumes from
+  ## the saved offsets when the agent restarts. Rotated and truncated files are
+  ## detected, from_beginning only applies to files without a saved offset.
+  # offsets_directory = ""
+
   ## Whether file is a named pipe
   # pipe = false
 
@@ -148,10 +159,21 @@ func (t *Tail) Description() string {
 	return "Parse the new lines appended to a file"
 }
 
-func (t *Tail) Init() error {
+// CheckConfig validates the settings without creating the offsets_directory.
+func (t *Tail) CheckConfig() error {
 	if t.MaxUndeliveredLines == 0 {
 		return errors.New("max_undelivered_lines must be positive")
 	}
+	if _, err := encoding.NewDecoder(t.CharacterEncoding); err != nil {
+		return fmt.Errorf("new decoder: %w", err)
+	}
+	return nil
+}
+
+func (t *Tail) Init() error {
+	if err := t.CheckConfig(); err != nil {
+		return err
+	}
 	t.sem = make(semaphore, t.MaxUndeliveredLines)
 
 	var err error
@@ -159,11 +181,23 @@ func (t *Tail) Init() error {
 	if err != nil {
 		return fmt.Errorf("new decoder: %w", err)
 	}
+
+	if !t.Pipe {
+		t.deliveries = newDeliveryOffsets()
+	}
+	if t.OffsetsDirectory != "" && !t.Pipe {
+		t.offsetStore, err = newOffsetStore(t.OffsetsDirectory, t.Files)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 func (t *Tail) Gather(ctx context.Context, acc cua.Accumulator) error {
-	return t.tailNewFiles(true)
+	err := t.tailNewFiles(true)
+	t.saveOffsets()
+	return err
 }
 
 func (t *Tail) Start(ctx context.Context, acc cua.Accumulator) error {
@@ -178,8 +212,9 @@ func (t *Tail) Start(ctx context.Context, acc cua.Accumulator) error {
 			select {
 			case <-t.ctx.Done():
 				return
-			case <-t.acc.Delivered():
+			case info := <-t.acc.Delivered():
 				<-t.sem
+				t.markDelivered(info)
 			}
 		}
 	}()
@@ -191,7 +226,9 @@ func (t *Tail) Start(ctx context.Context, acc cua.Accumulator) error {
 		return err
 	}
 
+	t.mu.Lock()
 	t.tailers = make(map[string]*tail.Tail)
+	t.mu.Unlock()
 
 	err = t.tailNewFiles(t.FromBeginning)
 
@@ -218,7 +255,10 @@ func (t *Tail) tailNewFiles(fromBeginning bool) error {
 			t.Log.Errorf("Glob %q failed to compile: %s", filepath, err.Error())
 		}
 		for _, file := range g.Match() {
-			if _, ok := t.tailers[file]; ok {
+			t.mu.Lock()
+			_, ok := t.tailers[file]
+			t.mu.Unlock()
+			if ok {
 				// we're already tailing this file
 				continue
 			}
@@ -231,13 +271,23 @@ func (t *Tail) tailNewFiles(fromBeginning bool) error {
 						Whence: 0,
 						Offset: offset,
 					}
-				} else {
+				}
+			}
+			if seek == nil && t.offsetStore != nil {
+				if offset, ok := t.offsetStore.resume(file); ok {
+					t.Log.Debugf("Resuming from saved offset %d for %q", offset, file)
 					seek = &tail.SeekInfo{
-						Whence: 2,
-						Offset: 0,
+						Whence: 0,
+						Offset: offset,
 					}
 				}
 			}
+			if seek == nil && !t.Pipe && !fromBeginning {
+				seek = &tail.SeekInfo{
+					Whence: 2,
+					Offset: 0,
+				}
+			}
 
 			tailer, err := tail.TailFile(file,
 				tail.Config{
@@ -267,12 +317,17 @@ func (t *Tail) tailNewFiles(fromBeginning bool) error {
 				continue
 			}
 
+			start := startOffset(file, seek)
+			if t.deliveries != nil {
+				t.deliveries.start(tailer.Filename, start)
+			}
+
 			// create a goroutine for each "tailer"
 			t.wg.Add(1)
 
 			go func() {
 				defer t.wg.Done()
-				t.receiver(parser, tailer)
+				t.receiver(parser, tailer, start)
 
 				t.Log.Debugf("Tail removed for %q", tailer.Filename)
 
@@ -281,7 +336,9 @@ func (t *Tail) tailNewFiles(fromBeginning bool) error {
 				}
 			}()
 
+			t.mu.Lock()
 			t.tailers[tailer.Filename] = tailer
+			t.mu.Unlock()
 		}
 	}
 	return nil
@@ -313,11 +370,58 @@ func parseLine(parser parsers.Parser, line string, firstLine bool) ([]cua.Metric
 	}
 }
 
+// startOffset returns where reading a file starts, the end of the file unless
+// seeking to an offset or reading from the beginning.
+func startOffset(file string, seek *tail.SeekInfo) fileOffset {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fileOffset{}
+	}
+	start := fileOffset{Inode: inode(info)}
+	switch {
+	case seek == nil:
+	case seek.Whence == io.SeekStart:
+		start.Offset = seek.Offset
+	default:
+		start.Offset = info.Size()
+	}
+	return start
+}
+
+// readOffset returns the offset after the line just received from the tailer, the
+// inode is looked up again when the offset went back (the file was reopened after
+// being truncated or rotated).
+func (t *Tail) readOffset(tailer *tail.Tail, last fileOffset) fileOffset {
+	pos, err := tailer.Tell()
+	if err != nil {
+		return last
+	}
+	if pos < last.Offset {
+		if info, err := os.Stat(tailer.Filename); err == nil {
+			last.Inode = inode(info)
+		}
+	}
+	last.Offset = pos
+	return last
+}
+
+// markDelivered advances the delivered offset of the file a group was read from.
+func (t *Tail) markDelivered(info cua.DeliveryInfo) {
+	if t.deliveries != nil {
+		t.deliveries.delivered(info.ID())
+	}
+}
+
 // Receiver is launched as a goroutine to continuously watch a tailed logfile
-// for changes, parse any incoming msgs, and add to the accumulator.
-func (t *Tail) receiver(parser parsers.Parser, tailer *tail.Tail) {
+// for changes, parse any incoming msgs, and add to the accumulator. The offset
+// after each group of lines is tracked until the group has been delivered.
+func (t *Tail) receiver(parser parsers.Parser, tailer *tail.Tail, start fileOffset) {
 	var firstLine = true
 
+	// offset after the last line received and the one before it, with
+	// multiline "previous" the current line is held until the next entry
+	offset, prevOffset := start, start
+
 	// holds the individual lines of multi-line log entries.
 	var buffer bytes.Buffer
 
@@ -354,7 +458,16 @@ func (t *Tail) receiver(parser parsers.Parser, tailer *tail.Tail) {
 
 		var text string
 
+		if line != nil && t.deliveries != nil {
+			prevOffset = offset
+			offset = t.readOffset(tailer, offset)
+		}
+		groupOffset := offset
+
 		if line != nil {
+			if t.multiline.IsEnabled() && t.MultilineConfig.MatchWhichLine == Previous {
+				groupOffset = prevOffset
+			}
 			// Fix up files with Windows line endings.
 			text = strings.TrimRight(line.Text, "\r")
 
@@ -394,7 +507,7 @@ func (t *Tail) receiver(parser parsers.Parser, tailer *tail.Tail) {
 		// try writing out metric first without blocking
 		select {
 		case t.sem <- empty{}:
-			t.acc.AddTrackingMetricGroup(metrics)
+			t.addGroup(tailer.Filename, metrics, groupOffset)
 			if t.ctx.Err() != nil {
 				return // exit!
 			}
@@ -408,11 +521,20 @@ func (t *Tail) receiver(parser parsers.Parser, tailer *tail.Tail) {
 		case <-t.ctx.Done():
 			return
 		case t.sem <- empty{}:
-			t.acc.AddTrackingMetricGroup(metrics)
+			t.addGroup(tailer.Filename, metrics, groupOffset)
 		}
 	}
 }
 
+// addGroup adds the metrics of a line (or multiline entry) for delivery, offset is
+// where reading would resume once they are delivered.
+func (t *Tail) addGroup(file string, metrics []cua.Metric, offset fileOffset) {
+	id := t.acc.AddTrackingMetricGroup(metrics)
+	if t.deliveries != nil {
+		t.deliveries.track(file, id, offset)
+	}
+}
+
 func (t *Tail) Stop() {
 	for _, tailer := range t.tailers {
 		if !t.Pipe && !t.FromBeginning {
@@ -420,6 +542,7 @@ func (t *Tail) Stop() {
 			offset, err := tailer.Tell()
 			if err == nil {
 				t.Log.Debugf("Recording offset %d for %q", offset, tailer.Filename)
+				t.offsets[tailer.Filename] = offset
 			} else {
 				t.Log.Errorf("Recording offset for %q: %s", tailer.Filename, err.Error())
 			}
@@ -433,6 +556,22 @@ func (t *Tail) Stop() {
 	t.cancel()
 	t.wg.Wait()
 
+	// the groups delivered since the delivery loop stopped
+	for delivered := true; delivered; {
+		select {
+		case info := <-t.acc.Delivered():
+			<-t.sem
+			t.markDelivered(info)
+		default:
+			delivered = false
+		}
+	}
+	t.saveOffsets()
+
+	t.mu.Lock()
+	t.tailers = nil
+	t.mu.Unlock()
+
 	// persist offsets
 	offsetsMutex.Lock()
 	for k, v := range t.offsets {
@@ -441,6 +580,68 @@ func (t *Tail) Stop() {
 	offsetsMutex.Unlock()
 }
 
+// GetState returns the offset of each tailed file, see cua.StatefulPlugin.
+func (t *Tail) GetState() interface{} {
+	return t.currentOffsets()
+}
+
+// SetState restores the offsets returned by GetState, when offsets_directory
+// is set the offsets saved there are used instead.
+func (t *Tail) SetState(state interface{}) error {
+	offsets, ok := state.(map[string]fileOffset)
+	if !ok {
+		return fmt.Errorf("invalid state type %T", state)
+	}
+
+	t.mu.Lock()
+	t.lastOffsets = offsets
+	t.mu.Unlock()
+
+	if t.offsetStore == nil && !t.Pipe {
+		t.offsetStore = &offsetStore{offsets: offsets}
+	}
+	return nil
+}
+
+// saveOffsets records, and when there is a store persists, the current offset
+// of each tailed file.
+func (t *Tail) saveOffsets() {
+	offsets := t.currentOffsets()
+	if t.offsetStore == nil {
+		return
+	}
+
+	if err := t.offsetStore.save(offsets); err != nil {
+		t.Log.Errorf("Saving offsets: %s", err.Error())
+	}
+}
+
+// currentOffsets returns the offset of each tailed file up to which the lines read
+// were delivered, or the last offsets known when no files are being tailed (e.g.
+// the plugin was stopped).
+func (t *Tail) currentOffsets() map[string]fileOffset {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.Pipe || len(t.tailers) == 0 {
+		return t.lastOffsets
+	}
+
+	offsets := make(map[string]fileOffset, len(t.tailers))
+	for file := range t.tailers {
+		offset, ok := t.deliveries.offset(file)
+		if !ok {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			continue // removed, there is nothing to resume
+		}
+		offsets[file] = offset
+	}
+	t.lastOffsets = offsets
+	return offsets
+}
+
 func (t *Tail) SetParserFunc(fn parsers.ParserFunc) {
 	t.parserFunc = fn
 }
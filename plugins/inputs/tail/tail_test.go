@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,6 +16,7 @@ import (
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
 	"github.com/circonus-labs/circonus-unified-agent/internal"
+	"github.com/circonus-labs/circonus-unified-agent/metric"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/parsers"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/parsers/csv"
 	"github.com/circonus-labs/circonus-unified-agent/plugins/parsers/influx"
@@ -565,6 +567,213 @@ func TestTailEOF(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestTailResumeFromSavedOffsets(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logfile, []byte("m1 value=1\n"), 0600))
+
+	newTail := func() *Tail {
+		tt := NewTail()
+		tt.Log = testutil.Logger{}
+		tt.FromBeginning = true
+		tt.OffsetsDirectory = filepath.Join(dir, "offsets")
+		tt.Files = []string{logfile + "*"}
+		tt.SetParserFunc(parsers.NewInfluxParser)
+		require.NoError(t, tt.Init())
+		return tt
+	}
+
+	tt := newTail()
+	acc := newDeliveringAccumulator()
+	require.NoError(t, tt.Start(context.Background(), acc))
+	acc.Wait(1)
+	tt.Stop()
+
+	// written while the agent was stopped, then rotated
+	f, err := os.OpenFile(logfile, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString("m2 value=2\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, os.Rename(logfile, logfile+".1"))
+	require.NoError(t, os.WriteFile(logfile, []byte("m3 value=3\n"), 0600))
+
+	tt = newTail()
+	acc = newDeliveringAccumulator()
+	require.NoError(t, tt.Start(context.Background(), acc))
+	acc.Wait(2)
+	tt.Stop()
+
+	require.False(t, acc.HasMeasurement("m1"))
+	require.True(t, acc.HasMeasurement("m2"))
+	require.True(t, acc.HasMeasurement("m3"))
+
+	// truncated below the saved offset
+	require.NoError(t, os.WriteFile(logfile, []byte{}, 0600))
+	store, err := newOffsetStore(tt.OffsetsDirectory, tt.Files)
+	require.NoError(t, err)
+	offset, ok := store.resume(logfile)
+	require.True(t, ok)
+	require.Equal(t, int64(0), offset)
+}
+
+func TestTailResumeFromState(t *testing.T) {
+	logfile := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(logfile, []byte("m1 value=1\n"), 0600))
+
+	newTail := func() *Tail {
+		tt := NewTail()
+		tt.Log = testutil.Logger{}
+		tt.FromBeginning = true
+		tt.Files = []string{logfile}
+		tt.SetParserFunc(parsers.NewInfluxParser)
+		require.NoError(t, tt.Init())
+		return tt
+	}
+
+	tt := newTail()
+	acc := newDeliveringAccumulator()
+	require.NoError(t, tt.Start(context.Background(), acc))
+	acc.Wait(1)
+	tt.Stop()
+	state := tt.GetState()
+
+	f, err := os.OpenFile(logfile, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString("m2 value=2\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	tt = newTail()
+	require.NoError(t, tt.SetState(state))
+	acc = newDeliveringAccumulator()
+	require.NoError(t, tt.Start(context.Background(), acc))
+	acc.Wait(1)
+	tt.Stop()
+
+	require.False(t, acc.HasMeasurement("m1"))
+	require.True(t, acc.HasMeasurement("m2"))
+}
+
+func TestTailResumeUndelivered(t *testing.T) {
+	dir := t.TempDir()
+	logfile := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(logfile, []byte("m1 value=1\n"), 0600))
+
+	newTail := func() *Tail {
+		tt := NewTail()
+		tt.Log = testutil.Logger{}
+		tt.FromBeginning = true
+		tt.OffsetsDirectory = filepath.Join(dir, "offsets")
+		tt.Files = []string{logfile}
+		tt.SetParserFunc(parsers.NewInfluxParser)
+		require.NoError(t, tt.Init())
+		return tt
+	}
+
+	tt := newTail()
+	acc := newDeliveringAccumulator()
+	require.NoError(t, tt.Start(context.Background(), acc))
+	acc.Wait(1)
+
+	// still queued in the agent when it stops
+	acc.holdDeliveries()
+	f, err := os.OpenFile(logfile, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = f.WriteString("m2 value=2\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	acc.Wait(2)
+	tt.Stop()
+
+	tt = newTail()
+	acc = newDeliveringAccumulator()
+	require.NoError(t, tt.Start(context.Background(), acc))
+	acc.Wait(1)
+	tt.Stop()
+
+	require.False(t, acc.HasMeasurement("m1"))
+	require.True(t, acc.HasMeasurement("m2"))
+}
+
+func TestDeliveryOffsets(t *testing.T) {
+	d := newDeliveryOffsets()
+	d.start("app.log", fileOffset{Inode: 1, Offset: 5})
+	d.track("app.log", 1, fileOffset{Inode: 1, Offset: 10})
+	d.track("app.log", 2, fileOffset{Inode: 1, Offset: 20})
+	d.track("app.log", 3, fileOffset{Inode: 1, Offset: 30})
+
+	// delivered out of order, the offset waits for the groups read before
+	d.delivered(2)
+	offset, ok := d.offset("app.log")
+	require.True(t, ok)
+	require.Equal(t, int64(5), offset.Offset)
+	d.delivered(1)
+	offset, _ = d.offset("app.log")
+	require.Equal(t, int64(20), offset.Offset)
+
+	// delivered before it was tracked (e.g. a line without metrics)
+	d.delivered(4)
+	d.delivered(3)
+	d.track("app.log", 4, fileOffset{Inode: 1, Offset: 40})
+	offset, _ = d.offset("app.log")
+	require.Equal(t, int64(40), offset.Offset)
+	require.Empty(t, d.pending)
+	require.Empty(t, d.early)
+
+	_, ok = d.offset("other.log")
+	require.False(t, ok)
+}
+
+// deliveringAccumulator delivers the tracked metric groups as they are added, like
+// the agent once the outputs wrote them, or holds them once holdDeliveries is called.
+type deliveringAccumulator struct {
+	testutil.Accumulator
+	delivered chan cua.DeliveryInfo
+	held      []cua.Metric
+	hold      bool
+	heldmu    sync.Mutex
+}
+
+func newDeliveringAccumulator() *deliveringAccumulator {
+	return &deliveringAccumulator{delivered: make(chan cua.DeliveryInfo, 100)}
+}
+
+func (a *deliveringAccumulator) WithTracking(int) cua.TrackingAccumulator {
+	return a
+}
+
+func (a *deliveringAccumulator) AddTrackingMetricGroup(group []cua.Metric) cua.TrackingID {
+	tracked, id := metric.WithGroupTracking(group, func(info cua.DeliveryInfo) {
+		a.delivered <- info
+	})
+
+	a.heldmu.Lock()
+	hold := a.hold
+	if hold {
+		a.held = append(a.held, tracked...)
+	}
+	a.heldmu.Unlock()
+
+	for _, m := range tracked {
+		a.AddMetric(m)
+		if !hold {
+			m.Accept()
+		}
+	}
+	return id
+}
+
+func (a *deliveringAccumulator) Delivered() <-chan cua.DeliveryInfo {
+	return a.delivered
+}
+
+func (a *deliveringAccumulator) holdDeliveries() {
+	a.heldmu.Lock()
+	defer a.heldmu.Unlock()
+	a.hold = true
+}
+
 func getTestdataDir() string {
 	dir, err := os.Getwd()
 	if err != nil {
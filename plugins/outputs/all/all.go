@@ -7,4 +7,7 @@ import (
 	_ "github.com/circonus-labs/circonus-unified-agent/plugins/outputs/elasticsearch"
 	_ "github.com/circonus-labs/circonus-unified-agent/plugins/outputs/file"
 	_ "github.com/circonus-labs/circonus-unified-agent/plugins/outputs/health"
+	_ "github.com/circonus-labs/circonus-unified-agent/plugins/outputs/http"
+	_ "github.com/circonus-labs/circonus-unified-agent/plugins/outputs/kafka"
+	_ "github.com/circonus-labs/circonus-unified-agent/plugins/outputs/prometheus_client"
 )
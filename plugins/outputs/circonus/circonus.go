@@ -3,7 +3,7 @@
 package circonus
 
 import (
-	"bytes"
+	"context"
 	"runtime/debug"
 	"sync"
 	"time"
@@ -40,19 +40,31 @@ type Circonus struct {
 	hostDestination      *metricDestination
 	agentDestination     *metricDestination
 	agentDestinationTags trapmetrics.Tags
-	APIApp               string   `toml:"api_app"`
-	APIURL               string   `toml:"api_url"`
-	Broker               string   `toml:"broker"`
-	APIToken             string   `toml:"api_token"`
-	AgentTarget          string   `toml:"agent_check_target"`
-	APITLSCA             string   `toml:"api_tls_ca"`
-	CacheDir             string   `toml:"cache_dir"`
-	CheckSearchTags      []string `toml:"check_search_tags"`
-	PoolSize             int      `toml:"pool_size"`
-	DebugMetrics         bool     `toml:"debug_metrics"`
-	SubOutput            bool     `toml:"sub_output"`
-	CacheConfigs         bool     `toml:"cache_configs"`
-	AllowSNMPTrapEvents  bool     `toml:"allow_snmp_trap_events"`
+	done                 chan struct{}
+	submitSem            chan struct{}
+	checks               sync.WaitGroup
+	APIApp               string          `toml:"api_app"`
+	APIURL               string          `toml:"api_url"`
+	Broker               string          `toml:"broker"`
+	Profile              string          `toml:"circonus_profile"`
+	SubmissionURL        string          `toml:"submission_url"`
+	BrokerCA             string          `toml:"broker_ca"`
+	APIToken             string          `toml:"api_token"`
+	AgentTarget          string          `toml:"agent_check_target"`
+	APITLSCA             string          `toml:"api_tls_ca"`
+	CacheDir             string          `toml:"cache_dir"`
+	CheckSearchTags      []string        `toml:"check_search_tags"`
+	RetryMinDelay        config.Duration `toml:"retry_min_delay"`
+	RetryMaxDelay        config.Duration `toml:"retry_max_delay"`
+	RetryBufferLimit     int             `toml:"retry_buffer_limit"`
+	FlushInterval        config.Duration `toml:"flush_interval"`
+	FlushThreshold       int             `toml:"flush_threshold"`
+	MaxSubmissions       int             `toml:"max_concurrent_submissions"`
+	PoolSize             int             `toml:"pool_size"`
+	DebugMetrics         bool            `toml:"debug_metrics"`
+	SubOutput            bool            `toml:"sub_output"`
+	CacheConfigs         bool            `toml:"cache_configs"`
+	AllowSNMPTrapEvents  bool            `toml:"allow_snmp_trap_events"`
 }
 
 // processors handle incoming batches
@@ -61,8 +73,9 @@ type processors struct {
 	metrics chan []cua.Metric
 }
 
-// Init performs initialization of a Circonus client.
-func (c *Circonus) Init() error {
+// CheckConfig initializes the circonus metric destination manager module, it
+// does not start the flusher or the metric processors.
+func (c *Circonus) CheckConfig() error {
 	if !circmgr.Ready() {
 		// initialize circonus metric destination manager module from config here
 		cfg := &config.CirconusConfig{
@@ -88,20 +101,36 @@ func (c *Circonus) Init() error {
 		}
 	}
 
+	return nil
+}
+
+// Init performs initialization of a Circonus client.
+func (c *Circonus) Init() error {
+	if err := c.CheckConfig(); err != nil {
+		return err
+	}
+
 	if c.PoolSize == 0 {
 		c.PoolSize = defaultWorkerPoolSize
 	}
+	c.done = make(chan struct{})
+	if c.MaxSubmissions <= 0 {
+		c.MaxSubmissions = defaultMaxConcurrentSubmissions
+	}
+	c.submitSem = make(chan struct{}, c.MaxSubmissions)
+	if c.FlushInterval > 0 {
+		c.checks.Add(1)
+		go c.runFlusher()
+	}
 	c.processors = processors{metrics: make(chan []cua.Metric)}
 	c.Log.Debugf("starting %d metric processors", c.PoolSize)
 	c.processors.wg.Add(c.PoolSize)
 	for i := 0; i < c.PoolSize; i++ {
 		i := i
 		go func(id int) {
-			var buf bytes.Buffer
 			for m := range c.processors.metrics {
-				buf.Reset()
 				start := time.Now()
-				nm := c.metricProcessor(id, m, buf)
+				nm := c.metricProcessor(id, m)
 				c.Log.Debugf("processor %d, processed %d metrics in %s", id, nm, time.Since(start).String())
 			}
 			c.processors.wg.Done()
@@ -121,6 +150,18 @@ func (p *processors) shutdown() {
 }
 
 var sampleConfig = `
+  ## Circonus profile - manage checks in one of the agent.circonus_profiles accounts
+  ## Optional: default is the agent.circonus account
+  # circonus_profile = ""
+
+  ## Static submission url - submit all metrics to an existing check's submission url,
+  ## the Circonus API is not used to find or create checks (e.g. only the broker is reachable)
+  ## Optional
+  # submission_url = ""
+  ## Broker CA - CA certificate file to verify the broker with when using a static https submission url
+  ## Optional: default is the system CAs
+  # broker_ca = ""
+
   ## Pool size - controls the number of batch processors
   ## Optional: mostly applicable to large number of inputs or inputs producing lots (100K+) of metrics
   # pool_size = 2
@@ -129,6 +170,27 @@ var sampleConfig = `
   ## Optional - if multiple outputs think they are the main, there can be duplicate metric submissions
   # sub_output = false
 
+  ## Retry buffer limit - maximum number of metrics, per check, held for resubmission when the broker is unreachable
+  ## Optional: when the limit is reached the oldest metrics are dropped
+  # retry_buffer_limit = 10000
+
+  ## Retry delay - failed submissions, and failed check lookup/creation, are retried with an
+  ## exponential backoff between these delays
+  ## Optional
+  # retry_min_delay = "1s"
+  # retry_max_delay = "5m"
+
+  ## Flush interval - metrics for each destination (check) accumulate across batches and are
+  ## submitted once the interval has elapsed, or flush_threshold metrics are queued, reducing
+  ## the number of submissions with many plugin instances (e.g. snmp, statsd)
+  ## Optional: default is to submit every batch
+  # flush_interval = "0s"
+  # flush_threshold = 0
+
+  ## Max concurrent submissions - limit on the number of destinations submitting at the same time
+  ## Optional
+  # max_concurrent_submissions = 10
+
   ## Debug metrics - this will output the metrics as they are being parsed - to verify parsing of names/tags/values
   ## Optional
   # debug_metrics = false
@@ -136,7 +198,8 @@ var sampleConfig = `
 
 var description = "Configuration for Circonus output plugin."
 
-// Conenct creates the initial check the plugin will use
+// Connect creates the agent (and host) metric destinations, their checks are found or
+// created in the background so an unreachable API does not prevent the agent starting.
 func (c *Circonus) Connect() error {
 
 	// checkmu.Lock()
@@ -148,6 +211,11 @@ func (c *Circonus) Connect() error {
 		c.Unlock()
 	}
 
+	if ttl := circmgr.CacheTTL(c.Profile); ttl > 0 && c.SubmissionURL == "" {
+		c.checks.Add(1)
+		go c.revalidateChecks(ttl)
+	}
+
 	if !c.SubOutput {
 		if c.agentDestination == nil {
 			meta := circmgr.MetricMeta{
@@ -155,14 +223,7 @@ func (c *Circonus) Connect() error {
 				InstanceID: config.DefaultInstanceID(),
 			}
 
-			if err := c.initMetricDestination(meta, map[string]string{}, c.AgentTarget, ""); err != nil {
-				c.Log.Errorf("unable to initialize circonus metric destination (%s)", err)
-				return err
-			}
-			destKey := meta.Key()
-			if d, ok := c.metricDestinations[destKey]; ok {
-				c.agentDestination = d
-			}
+			c.agentDestination = c.initMetricDestination(meta, map[string]string{}, c.AgentTarget, "")
 			c.agentDestinationTags = make(trapmetrics.Tags, 0)
 			for _, tag := range circmgr.GetGlobalTags() {
 				if tag.Category != "__rollup" {
@@ -176,40 +237,45 @@ func (c *Circonus) Connect() error {
 					PluginID:   "host",
 					InstanceID: config.DefaultInstanceID(),
 				}
-				if err := c.initMetricDestination(meta, map[string]string{}, "", ""); err != nil {
-					c.Log.Errorf("unable to initialize circonus metric destination (%s)", err)
-					return err
-				}
-				destKey := meta.Key()
-				if d, ok := c.metricDestinations[destKey]; ok {
-					c.hostDestination = d
-				}
+				c.hostDestination = c.initMetricDestination(meta, map[string]string{}, "", "")
 			}
 		}
 		c.emitAgentVersion()
-		go func() {
-			for range time.NewTicker(5 * time.Minute).C {
-				c.emitAgentVersion()
-				debug.FreeOSMemory()
-			}
-		}()
-		go func() {
-			for range time.NewTicker(1 * time.Minute).C {
-				c.emitRuntime()
-				// runtime.GC()
-			}
-		}()
+		c.checks.Add(1)
+		go c.runAgentMetrics()
 	}
 
 	return nil
 }
 
+// runAgentMetrics periodically emits the agent version and runtime metrics until
+// the output is closed.
+func (c *Circonus) runAgentMetrics() {
+	defer c.checks.Done()
+
+	versionTicker := time.NewTicker(5 * time.Minute)
+	defer versionTicker.Stop()
+	runtimeTicker := time.NewTicker(1 * time.Minute)
+	defer runtimeTicker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-versionTicker.C:
+			c.emitAgentVersion()
+			debug.FreeOSMemory()
+		case <-runtimeTicker.C:
+			c.emitRuntime()
+		}
+	}
+}
+
 func (c *Circonus) emitAgentVersion() {
 	agentVersion := inter.Version()
 	if c.agentDestination != nil {
 		ts := time.Now()
 		_ = c.agentDestination.metrics.TextSet("cua_version", c.agentDestinationTags, agentVersion, &ts)
-		c.agentDestination.queuedMetrics++
+		c.agentDestination.queuedMetrics.Add(1)
 	}
 }
 
@@ -220,8 +286,47 @@ func (c *Circonus) emitRuntime() {
 		tags = append(tags, c.agentDestinationTags...)
 		tags = append(tags, trapmetrics.Tag{Category: "units", Value: "seconds"})
 		_ = c.agentDestination.metrics.GaugeSet("cua_runtime", tags, time.Since(c.startTime).Seconds(), &ts)
-		c.agentDestination.queuedMetrics++
+		c.agentDestination.queuedMetrics.Add(1)
+	}
+}
+
+// emitPending records the number of metric destinations whose check is not ready,
+// the agent is degraded while any are pending.
+func (c *Circonus) emitPending() {
+	if c.agentDestination == nil {
+		return
+	}
+
+	pending := 0
+	c.RLock()
+	for _, d := range c.metricDestinations {
+		if d.isPending() {
+			pending++
+		}
 	}
+	c.RUnlock()
+
+	ts := time.Now()
+	_ = c.agentDestination.metrics.GaugeSet("cua_destinations_pending", c.agentDestinationTags, pending, &ts)
+	c.agentDestination.queuedMetrics.Add(1)
+}
+
+// emitCheckError counts failed attempts to find or create a check
+func (c *Circonus) emitCheckError() {
+	if c.agentDestination == nil {
+		return
+	}
+	_ = c.agentDestination.metrics.CounterIncrement("cua_check_errors", c.agentDestinationTags)
+	c.agentDestination.queuedMetrics.Add(1)
+}
+
+// emitDropped counts metrics dropped because a destination's retry buffer was full
+func (c *Circonus) emitDropped(dropped int64) {
+	if c.agentDestination == nil {
+		return
+	}
+	_ = c.agentDestination.metrics.CounterIncrementByValue("cua_metrics_dropped", c.agentDestinationTags, uint64(dropped))
+	c.agentDestination.queuedMetrics.Add(1)
 }
 
 // Write is used to write metric data to Circonus checks.
@@ -244,6 +349,30 @@ func (c *Circonus) Description() string {
 // Close will close the Circonus client connection.
 func (c *Circonus) Close() error {
 	c.processors.shutdown()
+
+	if c.FlushInterval > 0 {
+		// submit the metrics accumulated since the last flush
+		c.flushDestinations(context.Background(), true)
+	}
+
+	if c.done != nil {
+		close(c.done)
+	}
+	c.checks.Wait()
+
+	c.RLock()
+	for key, dest := range c.metricDestinations {
+		dest.flushmu.Lock()
+		if dest.pending {
+			c.Log.Warnf("closing with check pending for %s: %v", key, dest.checkErr)
+		}
+		if dest.retry != nil && dest.retry.numMetrics > 0 {
+			c.Log.Warnf("closing with %d unsent metrics for %s", dest.retry.numMetrics, key)
+		}
+		dest.flushmu.Unlock()
+	}
+	c.RUnlock()
+
 	return nil
 }
 
@@ -8,8 +8,10 @@ import (
 	"net/http/httptest"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCirconus(t *testing.T) {
@@ -71,3 +73,21 @@ func TestCirconus(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestRunAgentMetricsStops(t *testing.T) {
+	c := &Circonus{done: make(chan struct{})}
+	c.checks.Add(1)
+	go c.runAgentMetrics()
+	close(c.done)
+
+	stopped := make(chan struct{})
+	go func() {
+		c.checks.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "agent metrics still running after close")
+	}
+}
@@ -0,0 +1,113 @@
+package circonus
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/go-trapmetrics"
+)
+
+const defaultMaxConcurrentSubmissions = 10
+
+// flushDue indicates whether a destination's queued metrics should be submitted: with
+// no flush_interval every batch is submitted, otherwise metrics accumulate until the
+// interval has elapsed since the last flush or flush_threshold metrics are queued. It
+// does not take flushmu, so checking is not blocked by a destination being submitted.
+func (c *Circonus) flushDue(d *metricDestination, now time.Time, force bool) bool {
+	if d.queuedMetrics.Load() == 0 {
+		return false
+	}
+	if force || c.FlushInterval <= 0 {
+		return true
+	}
+	if c.FlushThreshold > 0 && d.queuedMetrics.Load() >= int64(c.FlushThreshold) {
+		return true
+	}
+	return now.Sub(time.Unix(0, d.lastFlush.Load())) >= time.Duration(c.FlushInterval)
+}
+
+// flushDestinations submits the queued metrics of the destinations which are due, at
+// most max_concurrent_submissions at a time. With force every destination with queued
+// metrics is flushed (e.g. closing).
+func (c *Circonus) flushDestinations(ctx context.Context, force bool) {
+	now := time.Now()
+
+	c.RLock()
+	dests := make([]*metricDestination, 0, len(c.metricDestinations))
+	for _, dest := range c.metricDestinations {
+		dests = append(dests, dest)
+	}
+	c.RUnlock()
+
+	due := make([]*metricDestination, 0, len(dests))
+	for _, dest := range dests {
+		c.Log.Debugf("checking %s %s for queued metrics", dest.key, dest.id)
+		if c.flushDue(dest, now, force) {
+			due = append(due, dest)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, dest := range due {
+		c.submitSem <- struct{}{}
+		wg.Add(1)
+		go func(d *metricDestination) {
+			defer func() {
+				<-c.submitSem
+				wg.Done()
+			}()
+			c.submitDestination(ctx, d)
+		}(dest)
+	}
+	wg.Wait()
+}
+
+// submitDestination flushes a destination and records the submission on the agent check.
+func (c *Circonus) submitDestination(ctx context.Context, d *metricDestination) {
+	subStart := time.Now()
+	result, err := c.flushDestination(ctx, d)
+	if err != nil {
+		c.Log.Warnf("submitting metrics (%s): %s", d.id, err)
+		return
+	}
+	if result.Stats == 0 && result.BytesSent == 0 {
+		return // nothing submitted, waiting for retry backoff
+	}
+	if c.agentDestination != nil {
+		if err := c.agentDestination.metrics.HistogramRecordValue("cua_bytes_sent_gz", c.agentDestinationTags, float64(result.BytesSentGzip)); err != nil {
+			c.Log.Warnf("adding histogram sample (cua_bytes_sent_gz): %s", err)
+		}
+		if err := c.agentDestination.metrics.HistogramRecordValue("cua_bytes_sent", c.agentDestinationTags, float64(result.BytesSent)); err != nil {
+			c.Log.Warnf("adding histogram sample (cua_bytes_sent): %s", err)
+		}
+		if err := c.agentDestination.metrics.HistogramRecordValue("cua_metrics_submitted", c.agentDestinationTags, float64(result.Stats)); err != nil {
+			c.Log.Warnf("adding histogram sample (cua_metrics_submitted): %s", err)
+		}
+		c.agentDestination.queuedMetrics.Add(1)
+		tags := make(trapmetrics.Tags, 0)
+		tags = append(tags, c.agentDestinationTags...)
+		tags = append(tags, trapmetrics.Tag{Category: "units", Value: "milliseconds"})
+		if err := c.agentDestination.metrics.HistogramRecordValue("cua_submit_latency", tags, float64(time.Since(subStart).Milliseconds())); err != nil {
+			c.Log.Warnf("adding histogram sample (cua_submit_latency): %s", err)
+		}
+		c.agentDestination.queuedMetrics.Add(1)
+	}
+}
+
+// runFlusher flushes destinations whose flush_interval has elapsed when no batches
+// are arriving to trigger it, until the output is closed.
+func (c *Circonus) runFlusher() {
+	defer c.checks.Done()
+
+	ticker := time.NewTicker(time.Duration(c.FlushInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.flushDestinations(context.Background(), false)
+		}
+	}
+}
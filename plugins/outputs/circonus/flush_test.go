@@ -0,0 +1,75 @@
+package circonus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/circonus-labs/go-trapmetrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlushDue(t *testing.T) {
+	now := time.Now()
+	d := &metricDestination{}
+	d.lastFlush.Store(now.UnixNano())
+	c := &Circonus{}
+
+	require.False(t, c.flushDue(d, now, true), "nothing queued")
+
+	// every batch
+	d.queuedMetrics.Store(1)
+	require.True(t, c.flushDue(d, now, false))
+
+	c.FlushInterval = config.Duration(time.Minute)
+	c.FlushThreshold = 10
+	require.False(t, c.flushDue(d, now.Add(time.Second), false))
+	require.True(t, c.flushDue(d, now.Add(time.Second), true))
+	require.True(t, c.flushDue(d, now.Add(time.Minute), false))
+	d.queuedMetrics.Store(10)
+	require.True(t, c.flushDue(d, now.Add(time.Second), false))
+
+	// not blocked by a submission in progress
+	d.flushmu.Lock()
+	defer d.flushmu.Unlock()
+	require.True(t, c.flushDue(d, now.Add(time.Second), false))
+}
+
+func TestFlushDestinations(t *testing.T) {
+	c := &Circonus{
+		Log:                testutil.Logger{},
+		FlushInterval:      config.Duration(time.Hour),
+		metricDestinations: make(map[string]*metricDestination),
+		submitSem:          make(chan struct{}, 1),
+	}
+
+	traps := make([]*testTrap, 3)
+	for i := range traps {
+		tm, err := trapmetrics.New(&trapmetrics.Config{})
+		require.NoError(t, err)
+		ts := time.Now()
+		require.NoError(t, tm.GaugeSet("gauge", nil, i, &ts))
+		traps[i] = &testTrap{}
+		d := &metricDestination{
+			metrics: tm,
+			trap:    traps[i],
+			retry:   newRetryQueue(100, time.Millisecond, time.Millisecond),
+		}
+		d.lastFlush.Store(time.Now().UnixNano())
+		d.queuedMetrics.Store(1)
+		c.metricDestinations[string(rune('a'+i))] = d
+	}
+
+	// accumulating, the interval has not elapsed
+	c.flushDestinations(context.Background(), false)
+	for _, trap := range traps {
+		require.Empty(t, trap.received)
+	}
+
+	c.flushDestinations(context.Background(), true)
+	for _, trap := range traps {
+		require.Len(t, trap.received, 1)
+	}
+}
@@ -1,8 +1,13 @@
 package circonus
 
 import (
-	"os"
+	"bytes"
+	"context"
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/config"
 	"github.com/circonus-labs/circonus-unified-agent/cua"
@@ -10,10 +15,63 @@ import (
 	"github.com/circonus-labs/go-trapmetrics"
 )
 
+// maxCacheRevalidateInterval is the longest time between checking for stale cached checks
+const maxCacheRevalidateInterval = time.Hour
+
+// metricDestination holds the metrics for a check. The check is found or created in
+// the background, until it is ready (pending) metrics are serialized into the retry
+// queue, which is bounded, and submitted once the check is available.
 type metricDestination struct {
-	metrics       *trapmetrics.TrapMetrics
-	id            string
-	queuedMetrics int64
+	nextCheckAttempt time.Time
+	metrics          *trapmetrics.TrapMetrics
+	trap             trapmetrics.Trap
+	checkErr         error
+	retry            *retryQueue
+	checkOpts        *circmgr.MetricDestConfig
+	stats            *destinationStats
+	id               string
+	key              string
+	queuedMetrics    atomic.Int64 // incremented by the metric processors without flushmu
+	lastFlush        atomic.Int64 // unix nanoseconds, checked for flush_interval without flushmu
+	checkAttempts    int
+	flushmu          sync.Mutex
+	settingsmu       sync.Mutex
+	settings         checkSettings
+	pending          bool
+}
+
+// checkSettings are the check settings of the plugin instance a destination's check
+// was found or created with, guarded by settingsmu (not flushmu, which is held while
+// submitting) since they are compared for every metric.
+type checkSettings struct {
+	tags        map[string]string
+	target      string
+	displayName string
+}
+
+// changed indicates whether the metric's check settings differ, e.g. a reload changed
+// the check_display_name of its plugin instance.
+func (s checkSettings) changed(m cua.Metric) bool {
+	if s.target != m.OriginCheckTarget() || s.displayName != m.OriginCheckDisplayName() {
+		return true
+	}
+	tags := m.OriginCheckTags()
+	if len(s.tags) != len(tags) {
+		return true
+	}
+	for k, v := range tags {
+		if sv, ok := s.tags[k]; !ok || sv != v {
+			return true
+		}
+	}
+	return false
+}
+
+// isPending indicates whether the destination's check has not been created yet
+func (d *metricDestination) isPending() bool {
+	d.flushmu.Lock()
+	defer d.flushmu.Unlock()
+	return d.pending
 }
 
 // getMetricDestination returns a destination for the plugin identified by a plugin and plugin instance id
@@ -69,32 +127,53 @@ func (c *Circonus) getMetricDestination(m cua.Metric) *metricDestination {
 	d, found := c.metricDestinations[destKey]
 	c.RUnlock()
 	if found {
+		c.updateCheckSettings(d, m)
 		return d
 	}
 
-	if err := c.initMetricDestination(metricMeta, m.OriginCheckTags(), m.OriginCheckTarget(), m.OriginCheckDisplayName()); err != nil {
-		c.Log.Errorf("error initializing metric destination: %s", err)
-		os.Exit(1) //nolint:gocritic
-	}
-
-	c.RLock()
-	d, found = c.metricDestinations[destKey]
-	c.RUnlock()
-	if found {
-		return d
-	}
-
-	return nil
+	return c.initMetricDestination(metricMeta, m.OriginCheckTags(), m.OriginCheckTarget(), m.OriginCheckDisplayName())
 }
 
-func (c *Circonus) initMetricDestination(metricMeta circmgr.MetricMeta, checkTags map[string]string, checkTarget, checkDisplayName string) error {
+// initMetricDestination returns the destination for the metric meta, a new destination is
+// pending until its check has been found or created in the background.
+func (c *Circonus) initMetricDestination(metricMeta circmgr.MetricMeta, checkTags map[string]string, checkTarget, checkDisplayName string) *metricDestination {
 	c.Lock()
 	defer c.Unlock()
 
-	opts := circmgr.MetricDestConfig{
+	destKey := metricMeta.Key()
+	if d, found := c.metricDestinations[destKey]; found {
+		return d // initialized by another processor
+	}
+
+	// trap metrics without a trap is only a container, the destination submits the metrics
+	metrics, err := trapmetrics.New(&trapmetrics.Config{})
+	if err != nil {
+		c.Log.Errorf("creating metric container (%s): %s", destKey, err)
+		return nil
+	}
+
+	d := &metricDestination{
+		metrics: metrics,
+		retry:   newRetryQueue(int64(c.RetryBufferLimit), time.Duration(c.RetryMinDelay), time.Duration(c.RetryMaxDelay)),
+		id:      metricMeta.PluginID,
+		key:     destKey,
+		pending: true,
+		stats:   newDestinationStats(destKey, metricMeta.PluginID, c.Profile),
+		settings: checkSettings{
+			tags:        checkTags,
+			target:      checkTarget,
+			displayName: checkDisplayName,
+		},
+	}
+	c.metricDestinations[destKey] = d
+
+	d.checkOpts = &circmgr.MetricDestConfig{
 		MetricMeta:       metricMeta,
 		APIToken:         c.APIToken,
 		Broker:           c.Broker,
+		Profile:          c.Profile,
+		SubmissionURL:    c.SubmissionURL,
+		BrokerCAFile:     c.BrokerCA,
 		DebugAPI:         c.DebugAPI,
 		TraceMetrics:     c.TraceMetrics,
 		CheckTarget:      checkTarget,
@@ -102,17 +181,263 @@ func (c *Circonus) initMetricDestination(metricMeta circmgr.MetricMeta, checkTag
 		CheckDisplayName: checkDisplayName,
 	}
 
-	dest, err := circmgr.NewMetricDestination(&opts, c.Log)
-	if err != nil {
-		return err
+	c.checks.Add(1)
+	go c.createCheck(d, destKey)
+
+	return d
+}
+
+// updateCheckSettings looks up the destination's check again when the check settings
+// of its plugin instance changed (the destination key does not include them), so the
+// check is reconciled with the new settings as it is on startup. Only applies when the
+// profile reconciles checks, otherwise settings only apply to new checks.
+func (c *Circonus) updateCheckSettings(d *metricDestination, m cua.Metric) {
+	d.settingsmu.Lock()
+	if !d.settings.changed(m) {
+		d.settingsmu.Unlock()
+		return
 	}
+	d.settings = checkSettings{
+		tags:        m.OriginCheckTags(),
+		target:      m.OriginCheckTarget(),
+		displayName: m.OriginCheckDisplayName(),
+	}
+	settings := d.settings
+	d.settingsmu.Unlock()
 
-	destKey := metricMeta.Key()
+	if !circmgr.ReconcileEnabled(c.Profile) {
+		return
+	}
 
-	c.metricDestinations[destKey] = &metricDestination{
-		metrics: dest,
-		id:      metricMeta.PluginID,
+	d.flushmu.Lock()
+	defer d.flushmu.Unlock()
+
+	if d.checkOpts == nil || d.checkOpts.SubmissionURL != "" {
+		return
 	}
+	opts := *d.checkOpts
+	opts.CheckTags = settings.tags
+	opts.CheckTarget = settings.target
+	opts.CheckDisplayName = settings.displayName
+	d.checkOpts = &opts
+
+	if d.pending {
+		return // the check is being looked up, the new settings apply to the next attempt
+	}
+	select {
+	case <-c.done:
+		return // closing
+	default:
+	}
+
+	c.Log.Infof("check settings for %s changed, reconciling its check", d.key)
+	c.lookupCheck(d)
+}
+
+// relookupCheck makes the destination pending again and finds, or creates, its check in
+// the background - the check was deleted, moved to another account, etc. The cached copy
+// of the check is removed. Must be called with the destination's flushmu held.
+func (c *Circonus) relookupCheck(d *metricDestination) {
+	if d.pending || d.checkOpts == nil || d.checkOpts.SubmissionURL != "" {
+		return
+	}
+	select {
+	case <-c.done:
+		return // closing
+	default:
+	}
+
+	c.Log.Warnf("check for %s no longer available, looking it up again", d.key)
+	if err := circmgr.PurgeCachedCheck(c.Profile, d.key); err != nil {
+		c.Log.Warnf("purging cached check %s: %s", d.key, err)
+	}
+
+	c.lookupCheck(d)
+}
+
+// lookupCheck makes the destination pending and finds, or creates, its check in the
+// background. Must be called with the destination's flushmu held.
+func (c *Circonus) lookupCheck(d *metricDestination) {
+	d.pending = true
+	d.trap = nil
+	d.checkAttempts = 0
+	c.checks.Add(1)
+	go c.createCheck(d, d.key)
+}
+
+// revalidateChecks periodically refreshes the cached copies of the destinations' checks
+// which are older than the cache ttl, destinations whose check no longer exists are
+// looked up again.
+func (c *Circonus) revalidateChecks(ttl time.Duration) {
+	defer c.checks.Done()
+
+	interval := ttl
+	if interval > maxCacheRevalidateInterval {
+		interval = maxCacheRevalidateInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		c.RLock()
+		dests := make([]*metricDestination, 0, len(c.metricDestinations))
+		for _, d := range c.metricDestinations {
+			dests = append(dests, d)
+		}
+		c.RUnlock()
+
+		for _, d := range dests {
+			c.revalidateCheck(d)
+		}
+	}
+}
+
+// revalidateCheck refreshes the cached copy of a destination's check, the destination's
+// flushmu is held so the check is not refreshed while metrics are submitted to it.
+func (c *Circonus) revalidateCheck(d *metricDestination) {
+	d.flushmu.Lock()
+	defer d.flushmu.Unlock()
+
+	if d.pending || d.trap == nil {
+		return
+	}
+	if err := circmgr.RevalidateCachedCheck(c.Profile, d.key, d.trap); err != nil {
+		c.Log.Warnf("%s: %s", d.key, err)
+		if circmgr.IsCheckGone(err) {
+			c.relookupCheck(d)
+		}
+	}
+}
+
+// createCheck finds or creates the check for a pending destination, failed attempts
+// (e.g. the API is unreachable) are retried with an exponential backoff until the
+// check is ready or the output is closed.
+func (c *Circonus) createCheck(d *metricDestination, destKey string) {
+	defer c.checks.Done()
+
+	minDelay := time.Duration(c.RetryMinDelay)
+	if minDelay <= 0 {
+		minDelay = defaultRetryMinDelay
+	}
+	maxDelay := time.Duration(c.RetryMaxDelay)
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	delay := time.Duration(0)
+	start := time.Now()
+
+	for {
+		d.flushmu.Lock()
+		opts := d.checkOpts
+		d.flushmu.Unlock()
+		_, trap, err := circmgr.NewMetricDestinationWithTrap(opts, c.Log)
+		d.flushmu.Lock()
+		d.checkAttempts++
+		if err == nil {
+			d.trap = trap
+			d.pending = false
+			d.checkErr = nil
+			d.nextCheckAttempt = time.Time{}
+			attempts := d.checkAttempts
+			d.flushmu.Unlock()
+			c.recordCheckCreated(d, time.Since(start))
+			if attempts > 1 {
+				c.Log.Infof("metric destination %s ready after %d attempts", destKey, attempts)
+			}
+			return
+		}
+
+		switch {
+		case delay == 0:
+			delay = minDelay
+		case delay < maxDelay:
+			delay *= 2
+			if delay > maxDelay {
+				delay = maxDelay
+			}
+		}
+		d.checkErr = err
+		d.nextCheckAttempt = time.Now().Add(delay)
+		d.flushmu.Unlock()
+
+		c.Log.Errorf("initializing metric destination %s, next attempt in %s: %s", destKey, delay, err)
+		c.emitCheckError()
+
+		select {
+		case <-c.done:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// flushDestination serializes the metrics currently queued in the destination, adds them to
+// the destination's retry queue and submits queued payloads, oldest first. Submission stops at
+// the first failure and the remaining payloads are held until the retry backoff has elapsed.
+// The returned result is the aggregate of all successful submissions.
+func (c *Circonus) flushDestination(ctx context.Context, d *metricDestination) (*trapmetrics.Result, error) {
+	d.flushmu.Lock()
+	defer d.flushmu.Unlock()
+
+	numMetrics := d.queuedMetrics.Swap(0)
+	d.lastFlush.Store(time.Now().UnixNano())
+
+	var buf bytes.Buffer
+	if err := d.metrics.WriteJSONMetrics(&buf); err != nil {
+		return nil, fmt.Errorf("packaging metrics for submission: %w", err)
+	}
+	if dropped := d.retry.add(buf.Bytes(), numMetrics); dropped > 0 {
+		c.Log.Warnf("retry buffer full (%s), dropped %d metrics", d.id, dropped)
+		c.emitDropped(dropped)
+	}
+	defer c.recordQueued(d)
+
+	result := &trapmetrics.Result{}
+	if d.pending {
+		c.Log.Debugf("%s: check pending, %d payloads held", d.id, d.retry.len())
+		return result, nil
+	}
+
+	now := time.Now()
+	if !d.retry.ready(now) {
+		c.Log.Debugf("%s: %d payloads waiting for retry", d.id, d.retry.len())
+		return result, nil
+	}
+
+	for {
+		payload, ok := d.retry.peek()
+		if !ok {
+			break
+		}
+		tr, err := d.trap.SendMetrics(ctx, *bytes.NewBuffer(payload.data))
+		if err != nil {
+			c.recordSubmitError(d, err, payload.attempts > 0)
+			delay := d.retry.failed(time.Now())
+			if circmgr.IsCheckGone(err) {
+				c.relookupCheck(d)
+			}
+			return result, fmt.Errorf("submitting metrics to broker, %d payloads queued, next attempt in %s: %w", d.retry.len(), delay.String(), err)
+		}
+		d.retry.pop()
+		d.retry.succeeded()
+		c.recordSubmit(d, tr, payload.attempts > 0)
+		if tr != nil {
+			result.CheckUUID = tr.CheckUUID
+			result.Stats += tr.Stats
+			result.Filtered += tr.Filtered
+			result.BytesSent += tr.BytesSent
+			result.BytesSentGzip += tr.BytesSentGzip
+			result.SubmitDuration += tr.SubmitDuration
+		}
+	}
+
+	result.FlushDuration = time.Since(now)
 
-	return nil
+	return result, nil
 }
@@ -0,0 +1,144 @@
+package circonus
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/config"
+	circmgr "github.com/circonus-labs/circonus-unified-agent/internal/circonus"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/circonus-labs/go-trapmetrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingDestination(t *testing.T) {
+	if circmgr.Ready() {
+		t.Skip("metric destination manager initialized, checks would be created")
+	}
+
+	c := &Circonus{
+		Log:                testutil.Logger{},
+		RetryMinDelay:      config.Duration(time.Millisecond),
+		RetryMaxDelay:      config.Duration(5 * time.Millisecond),
+		RetryBufferLimit:   2,
+		metricDestinations: make(map[string]*metricDestination),
+		done:               make(chan struct{}),
+	}
+
+	// the manager is not initialized so every attempt to create the check fails
+	dest := c.initMetricDestination(circmgr.MetricMeta{PluginID: "test", InstanceID: "test"}, nil, "", "")
+	require.NotNil(t, dest)
+	require.True(t, dest.isPending())
+	require.Same(t, dest, c.initMetricDestination(circmgr.MetricMeta{PluginID: "test", InstanceID: "test"}, nil, "", ""))
+
+	require.Eventually(t, func() bool {
+		return dest.status().CheckAttempts > 1
+	}, 5*time.Second, time.Millisecond)
+
+	status := dest.status()
+	require.True(t, status.Pending)
+	require.Contains(t, status.CheckError, "not initialized")
+	require.NotNil(t, status.NextCheckAttempt)
+
+	// metrics are held, up to the retry buffer limit, until the check is ready
+	ts := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, dest.metrics.GaugeSet("gauge", nil, i, &ts))
+		dest.queuedMetrics.Add(1)
+		result, err := c.flushDestination(context.Background(), dest)
+		require.NoError(t, err)
+		require.Zero(t, result.Stats)
+	}
+	require.Equal(t, 2, dest.retry.len())
+
+	close(c.done)
+	c.checks.Wait()
+}
+
+func TestRelookupCheck(t *testing.T) {
+	if circmgr.Ready() {
+		t.Skip("metric destination manager initialized, checks would be created")
+	}
+
+	tm, err := trapmetrics.New(&trapmetrics.Config{})
+	require.NoError(t, err)
+
+	trap := &testTrap{err: fmt.Errorf("404 Not Found - https://broker/module/httptrap/uuid/secret")}
+	dest := &metricDestination{
+		metrics:   tm,
+		trap:      trap,
+		retry:     newRetryQueue(100, time.Millisecond, time.Millisecond),
+		id:        "test",
+		key:       "test:test",
+		checkOpts: &circmgr.MetricDestConfig{},
+	}
+	c := &Circonus{
+		Log:           testutil.Logger{},
+		RetryMinDelay: config.Duration(time.Millisecond),
+		RetryMaxDelay: config.Duration(5 * time.Millisecond),
+		done:          make(chan struct{}),
+	}
+
+	ts := time.Now()
+	require.NoError(t, tm.GaugeSet("gauge", nil, 1, &ts))
+	dest.queuedMetrics.Add(1)
+
+	// the check is gone, the destination is pending until it is found or created again
+	_, err = c.flushDestination(context.Background(), dest)
+	require.Error(t, err)
+	require.True(t, dest.isPending())
+	require.Equal(t, 1, dest.retry.len())
+
+	close(c.done)
+	c.checks.Wait()
+}
+
+func TestCheckSettingsChanged(t *testing.T) {
+	m := testutil.MustMetric("cpu", nil, map[string]interface{}{"usage": 1.0}, time.Now())
+	m.SetOriginCheckTags(map[string]string{"team": "ops"})
+	m.SetOriginCheckTarget("host_a")
+	m.SetOriginCheckDisplayName("cpu")
+
+	settings := checkSettings{tags: map[string]string{"team": "ops"}, target: "host_a", displayName: "cpu"}
+	require.False(t, settings.changed(m))
+
+	m.SetOriginCheckDisplayName("cpu (reloaded)")
+	require.True(t, settings.changed(m))
+	m.SetOriginCheckDisplayName("cpu")
+
+	m.SetOriginCheckTags(map[string]string{"team": "dev"})
+	require.True(t, settings.changed(m))
+	m.SetOriginCheckTags(map[string]string{"team": "ops", "env": "prod"})
+	require.True(t, settings.changed(m))
+
+	if circmgr.Ready() {
+		t.Skip("metric destination manager initialized, checks would be reconciled")
+	}
+
+	// without reconcile_checks the new settings are recorded, the check is left as is
+	c := &Circonus{Log: testutil.Logger{}, done: make(chan struct{})}
+	dest := &metricDestination{key: "cpu:host_a", settings: settings, checkOpts: &circmgr.MetricDestConfig{}}
+	c.updateCheckSettings(dest, m)
+	require.False(t, dest.isPending())
+	require.False(t, dest.settings.changed(m))
+}
+
+func TestStaticSubmissionTags(t *testing.T) {
+	c := &Circonus{Log: testutil.Logger{}}
+	m := testutil.MustMetric("cpu", map[string]string{"cpu": "cpu0"}, map[string]interface{}{"usage": 1.0}, time.Now())
+	m.SetOrigin("cpu")
+	m.SetOriginInstance("host_a")
+
+	tags := trapmetrics.Tags{
+		{Category: "cpu", Value: "cpu0"},
+		{Category: "input_plugin", Value: "cpu"},
+	}
+	require.Equal(t, tags, c.convertTags(m))
+
+	// with a static submission url every instance submits to the same check
+	c.SubmissionURL = "https://broker.example.com/module/httptrap/uuid/secret"
+	tags = append(tags, trapmetrics.Tag{Category: "input_instance", Value: "host_a"})
+	require.Equal(t, tags, c.convertTags(m))
+}
@@ -1,54 +1,31 @@
 package circonus
 
 import (
-	"bytes"
 	"context"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/typehint"
 	"github.com/circonus-labs/go-trapmetrics"
 )
 
-func (c *Circonus) metricProcessor(id int, metrics []cua.Metric, buf bytes.Buffer) int64 {
+func (c *Circonus) metricProcessor(id int, metrics []cua.Metric) int64 {
 
 	c.Log.Debugf("processor %d, received %d batches", id, len(metrics))
 
 	start := time.Now()
 	numMetrics := int64(0)
 	for _, m := range metrics {
-		switch m.Type() {
-		case cua.Counter:
-			numMetrics += c.buildCounters(m)
-		case cua.Gauge, cua.Summary:
-			numMetrics += c.buildNumerics(m)
-		case cua.Untyped:
-			fields := m.FieldList()
-			if s, ok := fields[0].Value.(string); ok {
-				if strings.Contains(s, "H[") && strings.Contains(s, "]=") {
-					numMetrics += c.buildHistogram(m)
-				} else {
-					numMetrics += c.buildTexts(m)
-				}
-			} else {
-				numMetrics += c.buildNumerics(m)
-			}
-		case cua.Histogram:
-			numMetrics += c.buildHistogram(m)
-		case cua.CumulativeHistogram:
-			numMetrics += c.buildCumulativeHistogram(m)
-		default:
-			c.Log.Warnf("processor %d, unknown type %T, ignoring", id, m)
-		}
+		numMetrics += c.buildMetric(id, m)
 	}
 
 	if c.agentDestination != nil {
 		if err := c.agentDestination.metrics.GaugeAdd(metricVolume+"_batch", c.agentDestinationTags, numMetrics, &start); err != nil {
 			c.Log.Warnf("adding gauge (%s): %s", metricVolume+"_batch", err)
 		}
-		c.agentDestination.queuedMetrics++
+		c.agentDestination.queuedMetrics.Add(1)
 		tags := make(trapmetrics.Tags, 0)
 		tags = append(tags, c.agentDestinationTags...)
 		tags = append(tags, trapmetrics.Tag{Category: "units", Value: "microseconds"})
@@ -58,54 +35,15 @@ func (c *Circonus) metricProcessor(id int, metrics []cua.Metric, buf bytes.Buffe
 			float64(time.Since(start).Nanoseconds()/int64(time.Microsecond))); err != nil {
 			c.Log.Warnf("adding histogram sample (cua_batch_queue_latency): %s", err)
 		}
-		c.agentDestination.queuedMetrics++
+		c.agentDestination.queuedMetrics.Add(1)
 	}
 
 	c.Log.Debugf("processor %d, queued %d metrics for submission in %s", id, numMetrics, time.Since(start).String())
 
 	sendStart := time.Now()
-	var wg sync.WaitGroup
-	c.RLock()
-	ctx := context.Background()
-	for key, dest := range c.metricDestinations {
-		c.Log.Debugf("checking %s %s for queued metrics", key, dest.id)
-		if dest.queuedMetrics == 0 {
-			continue
-		}
-		wg.Add(1)
-		go func(d *metricDestination) {
-			defer wg.Done()
-			subStart := time.Now()
-			d.queuedMetrics = int64(0)
-			result, err := d.metrics.FlushWithBuffer(ctx, buf)
-			if err != nil {
-				c.Log.Warnf("submitting metrics (%s): %s", d.id, err)
-				return
-			}
-			if c.agentDestination != nil {
-				if err := c.agentDestination.metrics.HistogramRecordValue("cua_bytes_sent_gz", c.agentDestinationTags, float64(result.BytesSentGzip)); err != nil {
-					c.Log.Warnf("adding histogram sample (cua_bytes_sent_gz): %s", err)
-				}
-				if err := c.agentDestination.metrics.HistogramRecordValue("cua_bytes_sent", c.agentDestinationTags, float64(result.BytesSent)); err != nil {
-					c.Log.Warnf("adding histogram sample (cua_bytes_sent): %s", err)
-				}
-				if err := c.agentDestination.metrics.HistogramRecordValue("cua_metrics_submitted", c.agentDestinationTags, float64(result.Stats)); err != nil {
-					c.Log.Warnf("adding histogram sample (cua_metrics_submitted): %s", err)
-				}
-				c.agentDestination.queuedMetrics++
-				tags := make(trapmetrics.Tags, 0)
-				tags = append(tags, c.agentDestinationTags...)
-				tags = append(tags, trapmetrics.Tag{Category: "units", Value: "milliseconds"})
-				if err := c.agentDestination.metrics.HistogramRecordValue("cua_submit_latency", tags, float64(time.Since(subStart).Milliseconds())); err != nil {
-					c.Log.Warnf("adding histogram sample (cua_submit_latency): %s", err)
-				}
-				c.agentDestination.queuedMetrics++
-			}
-		}(dest)
-	}
+	c.flushDestinations(context.Background(), false)
 
-	wg.Wait()
-	c.RUnlock()
+	c.emitPending()
 
 	if c.agentDestination != nil {
 		tags := make(trapmetrics.Tags, 0)
@@ -114,7 +52,7 @@ func (c *Circonus) metricProcessor(id int, metrics []cua.Metric, buf bytes.Buffe
 		if err := c.agentDestination.metrics.HistogramRecordValue("cua_processor_latency", tags, float64(time.Since(start).Milliseconds())); err != nil {
 			c.Log.Warnf("addindg histogram sample (cua_process_latency): %s", err)
 		}
-		c.agentDestination.queuedMetrics++
+		c.agentDestination.queuedMetrics.Add(1)
 	}
 
 	c.Log.Debugf("processor %d, submit sent metrics in %s", id, time.Since(sendStart))
@@ -122,6 +60,44 @@ func (c *Circonus) metricProcessor(id int, metrics []cua.Metric, buf bytes.Buffe
 	return numMetrics
 }
 
+// buildMetric constructs circonus metrics from a cua metric, a type hint on the metric
+// (e.g. set by the circonus_types processor) takes precedence over its value type.
+func (c *Circonus) buildMetric(id int, m cua.Metric) int64 {
+	switch typehint.FromMetric(m).Metric() {
+	case typehint.Counter:
+		return c.buildCounters(m)
+	case typehint.Gauge:
+		return c.buildNumerics(m)
+	case typehint.Text:
+		return c.buildTexts(m)
+	case typehint.Histogram:
+		return c.buildHistogram(m)
+	}
+
+	switch m.Type() {
+	case cua.Counter:
+		return c.buildCounters(m)
+	case cua.Gauge, cua.Summary:
+		return c.buildNumerics(m)
+	case cua.Untyped:
+		fields := m.FieldList()
+		if s, ok := fields[0].Value.(string); ok {
+			if typehint.FromMetric(m).Field(fields[0].Key) == "" && isHistogramString(s) {
+				return c.buildHistogram(m)
+			}
+			return c.buildTexts(m)
+		}
+		return c.buildNumerics(m)
+	case cua.Histogram:
+		return c.buildHistogram(m)
+	case cua.CumulativeHistogram:
+		return c.buildCumulativeHistogram(m)
+	default:
+		c.Log.Warnf("processor %d, unknown type %T, ignoring", id, m)
+	}
+	return 0
+}
+
 // handleGeneric constructs text and numeric metrics from a cua metric
 // Note: for certain cua metric types the actual fields may be either text OR numeric...
 //
@@ -135,12 +111,19 @@ func (c *Circonus) handleGeneric(m cua.Metric) int64 {
 	numMetrics := int64(0)
 	tags := c.convertTags(m)
 	batchTS := m.Time()
+	hints := typehint.FromMetric(m)
 
 	for _, field := range m.FieldList() {
 		mn := strings.TrimSuffix(field.Key, "__value")
 		if c.DebugMetrics {
 			c.Log.Infof("%s %v %v %T\n", mn, tags.String(), field.Value, field.Value)
 		}
+		if typ := hints.Field(field.Key); typ != "" {
+			if c.setTyped(dest, typ, mn, tags, field.Value, &batchTS) {
+				numMetrics++
+			}
+			continue
+		}
 		switch v := field.Value.(type) {
 		case string:
 			if !c.AllowSNMPTrapEvents && m.Origin() == "snmp_trap" {
@@ -171,7 +154,7 @@ func (c *Circonus) handleGeneric(m cua.Metric) int64 {
 		}
 	}
 
-	dest.queuedMetrics += numMetrics
+	dest.queuedMetrics.Add(numMetrics)
 
 	return numMetrics
 }
@@ -196,25 +179,24 @@ func (c *Circonus) buildCounters(m cua.Metric) int64 {
 
 	numMetrics := int64(0)
 	tags := c.convertTags(m)
+	batchTS := m.Time()
+	hints := typehint.FromMetric(m)
 
 	for _, field := range m.FieldList() {
 		mn := strings.TrimSuffix(field.Key, "__value")
 		if c.DebugMetrics {
 			c.Log.Infof("%s %v %v %T\n", mn, tags.String(), field.Value, field.Value)
 		}
-		val, ok := toUint64(field.Value)
-		if ok {
-			if err := dest.metrics.CounterIncrementByValue(mn, tags, val); err != nil {
-				c.Log.Warnf("incrementing counter (%s) (%s) (%#v): %s", mn, tags.String(), val, err)
-				continue
-			}
+		typ := hints.Field(field.Key)
+		if typ == "" {
+			typ = typehint.Counter
+		}
+		if c.setTyped(dest, typ, mn, tags, field.Value, &batchTS) {
 			numMetrics++
-		} else {
-			c.Log.Warnf("handling counter (%s) (%s) (%#v): unable to convert to uint64", mn, tags.String(), field.Value)
 		}
 	}
 
-	dest.queuedMetrics += numMetrics
+	dest.queuedMetrics.Add(numMetrics)
 
 	return numMetrics
 }
@@ -230,25 +212,54 @@ func (c *Circonus) buildHistogram(m cua.Metric) int64 {
 	numMetrics := int64(0)
 	mn := strings.TrimSuffix(m.Name(), "__value")
 	tags := c.convertTags(m)
+	batchTS := m.Time()
+	hints := typehint.FromMetric(m)
 
 	for _, field := range m.FieldList() {
+		fn := strings.TrimSuffix(field.Key, "__value")
+		if typ := hints.Field(field.Key); typ != "" && typ != typehint.Histogram {
+			if c.setTyped(dest, typ, fn, tags, field.Value, &batchTS) {
+				numMetrics++
+			}
+			continue
+		}
+		if _, ok := field.Value.(string); ok {
+			// serialized histogram, H[bucket]=count,...
+			if c.setTyped(dest, typehint.Histogram, fn, tags, field.Value, &batchTS) {
+				numMetrics++
+			}
+			continue
+		}
+
 		v, err := strconv.ParseFloat(field.Key, 64)
+		count, isCount := field.Value.(int64)
+		if (err != nil || !isCount) && hints != nil {
+			// a field annotated as a histogram, the value is a sample
+			if c.setTyped(dest, typehint.Histogram, fn, tags, field.Value, &batchTS) {
+				numMetrics++
+			}
+			continue
+		}
 		if err != nil {
 			c.Log.Errorf("cannot parse histogram (%s) field.key (%s) as float: %s\n", mn, field.Key, err)
 			continue
 		}
+		if !isCount {
+			c.Log.Errorf("cannot record histogram (%s) bucket (%s) count (%#v): not an int64\n", mn, field.Key, field.Value)
+			continue
+		}
 		if c.DebugMetrics {
 			c.Log.Infof("%s %v v:%v vt%T n:%v nT:%T\n", mn, tags, v, v, field.Value, field.Value)
 		}
 
-		if err := dest.metrics.HistogramRecordCountForValue(mn, tags, field.Value.(int64), v); err != nil {
+		if err := dest.metrics.HistogramRecordCountForValue(mn, tags, count, v); err != nil {
 			c.Log.Warnf("recording histogram (%s %s): %s", mn, tags.String(), err)
 			continue
 		}
 		numMetrics++
 	}
 
-	dest.queuedMetrics += numMetrics
+	dest.queuedMetrics.Add(numMetrics)
 
 	return numMetrics
 }
@@ -283,7 +294,7 @@ func (c *Circonus) buildCumulativeHistogram(m cua.Metric) int64 {
 		numMetrics++
 	}
 
-	dest.queuedMetrics += numMetrics
+	dest.queuedMetrics.Add(numMetrics)
 
 	return numMetrics
 }
@@ -304,6 +315,9 @@ func (c *Circonus) convertTags(m cua.Metric) trapmetrics.Tags { //nolint:unparam
 
 	if len(tags) > 0 {
 		for _, t := range tags {
+			if typehint.IsReserved(t.Key) {
+				continue
+			}
 			if t.Key == "input_metric_group" {
 				haveInputMetricGroup = true
 			}
@@ -314,6 +328,11 @@ func (c *Circonus) convertTags(m cua.Metric) trapmetrics.Tags { //nolint:unparam
 	if m.Origin() != "" {
 		// from config file `inputs.*`, the part after period
 		ctags = append(ctags, trapmetrics.Tag{Category: "input_plugin", Value: m.Origin()})
+		if c.SubmissionURL != "" && m.OriginInstance() != "" {
+			// the static check receives the metrics of every plugin instance,
+			// the instance keeps same named metrics of each apart
+			ctags = append(ctags, trapmetrics.Tag{Category: "input_instance", Value: m.OriginInstance()})
+		}
 	}
 	if !haveInputMetricGroup {
 		if m.Name() != "" && m.Name() != m.Origin() {
@@ -0,0 +1,124 @@
+package circonus
+
+import (
+	"time"
+)
+
+const (
+	defaultRetryBufferLimit = 10000
+	defaultRetryMinDelay    = 1 * time.Second
+	defaultRetryMaxDelay    = 5 * time.Minute
+)
+
+// retryPayload is a serialized (httptrap json) set of metrics which could not be submitted
+type retryPayload struct {
+	data       []byte
+	numMetrics int64
+	attempts   int // failed submission attempts
+}
+
+// retryQueue holds payloads for a metric destination which failed submission, they are
+// resubmitted, oldest first, with an exponential backoff between failed attempts. The
+// queue is bounded by the number of metrics it holds, when the limit is exceeded the
+// oldest payloads are dropped.
+type retryQueue struct {
+	nextAttempt time.Time
+	payloads    []retryPayload
+	numMetrics  int64
+	limit       int64
+	minDelay    time.Duration
+	maxDelay    time.Duration
+	delay       time.Duration
+}
+
+func newRetryQueue(limit int64, minDelay, maxDelay time.Duration) *retryQueue {
+	if limit <= 0 {
+		limit = defaultRetryBufferLimit
+	}
+	if minDelay <= 0 {
+		minDelay = defaultRetryMinDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	if maxDelay < minDelay {
+		maxDelay = minDelay
+	}
+	return &retryQueue{
+		payloads: make([]retryPayload, 0),
+		limit:    limit,
+		minDelay: minDelay,
+		maxDelay: maxDelay,
+	}
+}
+
+// add appends a payload to the queue, returns the number of metrics dropped
+// to keep the queue within its limit.
+func (q *retryQueue) add(data []byte, numMetrics int64) int64 {
+	if len(data) == 0 {
+		return 0
+	}
+	q.payloads = append(q.payloads, retryPayload{data: data, numMetrics: numMetrics})
+	q.numMetrics += numMetrics
+
+	dropped := int64(0)
+	// always keep the newest payload, even if it alone exceeds the limit
+	for q.numMetrics > q.limit && len(q.payloads) > 1 {
+		dropped += q.payloads[0].numMetrics
+		q.numMetrics -= q.payloads[0].numMetrics
+		q.payloads[0] = retryPayload{}
+		q.payloads = q.payloads[1:]
+	}
+
+	return dropped
+}
+
+// peek returns the oldest payload in the queue
+func (q *retryQueue) peek() (retryPayload, bool) {
+	if len(q.payloads) == 0 {
+		return retryPayload{}, false
+	}
+	return q.payloads[0], true
+}
+
+// pop removes the oldest payload from the queue
+func (q *retryQueue) pop() {
+	if len(q.payloads) == 0 {
+		return
+	}
+	q.numMetrics -= q.payloads[0].numMetrics
+	q.payloads[0] = retryPayload{}
+	q.payloads = q.payloads[1:]
+}
+
+func (q *retryQueue) len() int {
+	return len(q.payloads)
+}
+
+// ready indicates whether the backoff period, if any, has elapsed
+func (q *retryQueue) ready(now time.Time) bool {
+	return !now.Before(q.nextAttempt)
+}
+
+// failed records a failed submission attempt of the oldest payload and calculates the next attempt time
+func (q *retryQueue) failed(now time.Time) time.Duration {
+	if len(q.payloads) > 0 {
+		q.payloads[0].attempts++
+	}
+	if q.delay == 0 {
+		q.delay = q.minDelay
+	} else {
+		q.delay *= 2
+		if q.delay > q.maxDelay {
+			q.delay = q.maxDelay
+		}
+	}
+	q.nextAttempt = now.Add(q.delay)
+	return q.delay
+}
+
+// succeeded resets the backoff after a successful submission
+func (q *retryQueue) succeeded() {
+	q.delay = 0
+	q.nextAttempt = time.Time{}
+}
@@ -0,0 +1,108 @@
+package circonus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/circonus-labs/go-apiclient"
+	"github.com/circonus-labs/go-trapcheck"
+	"github.com/circonus-labs/go-trapmetrics"
+	"github.com/stretchr/testify/require"
+)
+
+type testTrap struct {
+	err      error
+	received []string
+}
+
+func (t *testTrap) SendMetrics(_ context.Context, metrics bytes.Buffer) (*trapcheck.TrapResult, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	t.received = append(t.received, metrics.String())
+	return &trapcheck.TrapResult{Stats: 1, BytesSent: metrics.Len()}, nil
+}
+
+func (t *testTrap) UpdateCheckTags(_ context.Context, _ []string) (*apiclient.CheckBundle, error) {
+	return nil, nil
+}
+
+func TestRetryQueueLimit(t *testing.T) {
+	q := newRetryQueue(10, time.Second, time.Minute)
+
+	require.Equal(t, int64(0), q.add([]byte("a"), 4))
+	require.Equal(t, int64(0), q.add([]byte("b"), 4))
+	require.Equal(t, int64(4), q.add([]byte("c"), 4))
+	require.Equal(t, 2, q.len())
+	require.Equal(t, int64(8), q.numMetrics)
+
+	p, ok := q.peek()
+	require.True(t, ok)
+	require.Equal(t, "b", string(p.data))
+
+	// a single payload larger than the limit is kept
+	require.Equal(t, int64(8), q.add([]byte("d"), 20))
+	require.Equal(t, 1, q.len())
+
+	q.pop()
+	require.Equal(t, 0, q.len())
+	require.Equal(t, int64(0), q.numMetrics)
+}
+
+func TestRetryQueueBackoff(t *testing.T) {
+	q := newRetryQueue(10, time.Second, 3*time.Second)
+	now := time.Now()
+
+	require.True(t, q.ready(now))
+	require.Equal(t, time.Second, q.failed(now))
+	require.False(t, q.ready(now))
+	require.True(t, q.ready(now.Add(time.Second)))
+	require.Equal(t, 2*time.Second, q.failed(now))
+	require.Equal(t, 3*time.Second, q.failed(now))
+	require.Equal(t, 3*time.Second, q.failed(now))
+
+	q.succeeded()
+	require.True(t, q.ready(now))
+	require.Equal(t, time.Second, q.failed(now))
+}
+
+func TestFlushDestinationRetry(t *testing.T) {
+	tm, err := trapmetrics.New(&trapmetrics.Config{})
+	require.NoError(t, err)
+
+	trap := &testTrap{err: fmt.Errorf("broker unavailable")}
+	dest := &metricDestination{
+		metrics: tm,
+		trap:    trap,
+		retry:   newRetryQueue(100, time.Millisecond, time.Millisecond),
+		id:      "test",
+	}
+	c := &Circonus{Log: testutil.Logger{}}
+
+	ts := time.Now()
+	require.NoError(t, tm.GaugeSet("first", nil, 1, &ts))
+	dest.queuedMetrics.Add(1)
+
+	_, err = c.flushDestination(context.Background(), dest)
+	require.Error(t, err)
+	require.Equal(t, 1, dest.retry.len())
+	require.Equal(t, int64(1), dest.retry.numMetrics)
+
+	// broker is back, both the failed payload and the new one are sent, oldest first
+	trap.err = nil
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, tm.GaugeSet("second", nil, 2, &ts))
+	dest.queuedMetrics.Add(1)
+
+	result, err := c.flushDestination(context.Background(), dest)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), result.Stats)
+	require.Len(t, trap.received, 2)
+	require.Contains(t, trap.received[0], "first")
+	require.Contains(t, trap.received[1], "second")
+	require.Equal(t, 0, dest.retry.len())
+}
@@ -0,0 +1,165 @@
+package circonus
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	circmgr "github.com/circonus-labs/circonus-unified-agent/internal/circonus"
+	"github.com/circonus-labs/circonus-unified-agent/selfstat"
+	"github.com/circonus-labs/go-trapcheck"
+	"github.com/circonus-labs/go-trapmetrics"
+)
+
+// destinationStats are the submission health counters of a metric destination, they
+// are registered with selfstat (internal_circonus_destination in inputs.internal) and
+// emitted on the agent check.
+type destinationStats struct {
+	submissions  selfstat.Stat
+	errors       selfstat.Stat
+	retries      selfstat.Stat
+	bytesSent    selfstat.Stat
+	metricsSent  selfstat.Stat
+	queued       selfstat.Stat
+	checkLatency selfstat.Stat
+	statusErrors map[string]selfstat.Stat
+	tags         map[string]string
+	mu           sync.Mutex
+}
+
+func newDestinationStats(destKey, pluginID, profile string) *destinationStats {
+	tags := map[string]string{
+		"destination": destKey,
+		"plugin":      pluginID,
+	}
+	if profile != "" {
+		tags["circonus_profile"] = profile
+	}
+	return &destinationStats{
+		submissions:  selfstat.Register("circonus_destination", "submissions", tags),
+		errors:       selfstat.Register("circonus_destination", "submit_errors", tags),
+		retries:      selfstat.Register("circonus_destination", "submit_retries", tags),
+		bytesSent:    selfstat.Register("circonus_destination", "bytes_sent", tags),
+		metricsSent:  selfstat.Register("circonus_destination", "metrics_sent", tags),
+		queued:       selfstat.Register("circonus_destination", "queued_metrics", tags),
+		checkLatency: selfstat.Register("circonus_destination", "check_create_ms", tags),
+		statusErrors: make(map[string]selfstat.Stat),
+		tags:         tags,
+	}
+}
+
+// statusError returns the counter of failed submissions for an http status
+func (s *destinationStats) statusError(status string) selfstat.Stat {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stat, ok := s.statusErrors[status]
+	if !ok {
+		tags := make(map[string]string, len(s.tags)+1)
+		for k, v := range s.tags {
+			tags[k] = v
+		}
+		tags["status"] = status
+		stat = selfstat.Register("circonus_destination_errors", "errors", tags)
+		s.statusErrors[status] = stat
+	}
+	return stat
+}
+
+// submitStatus returns the http status of a failed submission, "none" when the
+// request did not get a response (e.g. connection refused, timeout).
+func submitStatus(err error) string {
+	if status := circmgr.SubmitStatus(err); status != 0 {
+		return strconv.Itoa(status)
+	}
+	return "none"
+}
+
+// destinationTags are the agent check tags for a destination's metrics
+func (c *Circonus) destinationTags(d *metricDestination, extra ...trapmetrics.Tag) trapmetrics.Tags {
+	tags := make(trapmetrics.Tags, 0, len(c.agentDestinationTags)+1+len(extra))
+	tags = append(tags, c.agentDestinationTags...)
+	tags = append(tags, trapmetrics.Tag{Category: "destination", Value: d.key})
+	tags = append(tags, extra...)
+	return tags
+}
+
+// recordSubmit records a successful submission, retry when the payload failed before.
+func (c *Circonus) recordSubmit(d *metricDestination, tr *trapcheck.TrapResult, retry bool) {
+	if d.stats == nil {
+		return
+	}
+	d.stats.submissions.Incr(1)
+	if retry {
+		d.stats.retries.Incr(1)
+	}
+	if tr != nil {
+		d.stats.bytesSent.Incr(int64(tr.BytesSent))
+		d.stats.metricsSent.Incr(int64(tr.Stats))
+	}
+
+	if c.agentDestination == nil {
+		return
+	}
+	tags := c.destinationTags(d)
+	_ = c.agentDestination.metrics.CounterIncrement("cua_destination_submissions", tags)
+	if retry {
+		_ = c.agentDestination.metrics.CounterIncrement("cua_destination_submit_retries", tags)
+	}
+	if tr != nil {
+		_ = c.agentDestination.metrics.CounterIncrementByValue("cua_destination_bytes_sent", tags, uint64(tr.BytesSent))
+	}
+	c.agentDestination.queuedMetrics.Add(1)
+}
+
+// recordSubmitError records a failed submission, by http status.
+func (c *Circonus) recordSubmitError(d *metricDestination, err error, retry bool) {
+	if d.stats == nil {
+		return
+	}
+	status := submitStatus(err)
+	d.stats.errors.Incr(1)
+	d.stats.statusError(status).Incr(1)
+	if retry {
+		d.stats.retries.Incr(1)
+	}
+
+	if c.agentDestination == nil {
+		return
+	}
+	_ = c.agentDestination.metrics.CounterIncrement("cua_destination_submit_errors",
+		c.destinationTags(d, trapmetrics.Tag{Category: "status", Value: status}))
+	if retry {
+		_ = c.agentDestination.metrics.CounterIncrement("cua_destination_submit_retries", c.destinationTags(d))
+	}
+	c.agentDestination.queuedMetrics.Add(1)
+}
+
+// recordQueued records the metrics serialized but not yet submitted (retry buffer).
+func (c *Circonus) recordQueued(d *metricDestination) {
+	if d.stats == nil || d.retry == nil {
+		return
+	}
+	d.stats.queued.Set(d.retry.numMetrics)
+
+	if c.agentDestination == nil || c.agentDestination == d {
+		return // the agent destination's own gauge would always be stale
+	}
+	ts := time.Now()
+	_ = c.agentDestination.metrics.GaugeSet("cua_destination_queued_metrics", c.destinationTags(d), d.retry.numMetrics, &ts)
+	c.agentDestination.queuedMetrics.Add(1)
+}
+
+// recordCheckCreated records how long finding, or creating, the destination's check took.
+func (c *Circonus) recordCheckCreated(d *metricDestination, elapsed time.Duration) {
+	if d.stats == nil {
+		return
+	}
+	d.stats.checkLatency.Set(elapsed.Milliseconds())
+
+	if c.agentDestination == nil {
+		return
+	}
+	_ = c.agentDestination.metrics.HistogramRecordValue("cua_check_create_latency",
+		c.destinationTags(d, trapmetrics.Tag{Category: "units", Value: "milliseconds"}), float64(elapsed.Milliseconds()))
+	c.agentDestination.queuedMetrics.Add(1)
+}
@@ -0,0 +1,53 @@
+package circonus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/circonus-labs/go-trapmetrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubmitStatus(t *testing.T) {
+	require.Equal(t, "404", submitStatus(errors.New("unable to refresh: 404 Not Found - https://broker:43191/module/httptrap/uuid/secret")))
+	require.Equal(t, "none", submitStatus(errors.New("making request: dial tcp 10.0.0.1:43191: connect: connection refused")))
+}
+
+func TestDestinationStats(t *testing.T) {
+	tm, err := trapmetrics.New(&trapmetrics.Config{})
+	require.NoError(t, err)
+
+	trap := &testTrap{err: errors.New("503 Service Unavailable - https://broker/module/httptrap/uuid/secret")}
+	dest := &metricDestination{
+		metrics: tm,
+		trap:    trap,
+		retry:   newRetryQueue(100, time.Millisecond, time.Millisecond),
+		id:      "test",
+		key:     "test:stats::",
+		stats:   newDestinationStats("test:stats::", "test", ""),
+	}
+	c := &Circonus{Log: testutil.Logger{}}
+
+	ts := time.Now()
+	require.NoError(t, tm.GaugeSet("gauge", nil, 1, &ts))
+	dest.queuedMetrics.Add(1)
+	_, err = c.flushDestination(context.Background(), dest)
+	require.Error(t, err)
+	require.Equal(t, int64(1), dest.stats.errors.Get())
+	require.Equal(t, int64(1), dest.stats.statusError("503").Get())
+	require.Equal(t, int64(0), dest.stats.retries.Get())
+	require.Equal(t, int64(1), dest.stats.queued.Get())
+
+	trap.err = nil
+	time.Sleep(2 * time.Millisecond)
+	_, err = c.flushDestination(context.Background(), dest)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), dest.stats.submissions.Get())
+	require.Equal(t, int64(1), dest.stats.retries.Get())
+	require.Equal(t, int64(1), dest.stats.metricsSent.Get())
+	require.NotZero(t, dest.stats.bytesSent.Get())
+	require.Equal(t, int64(0), dest.stats.queued.Get())
+}
@@ -0,0 +1,95 @@
+package circonus
+
+import (
+	"time"
+
+	circmgr "github.com/circonus-labs/circonus-unified-agent/internal/circonus"
+)
+
+// destinationStatus describes a metric destination and the check it submits to
+type destinationStatus struct {
+	NextRetry        *time.Time `json:"next_retry,omitempty"`
+	NextCheckAttempt *time.Time `json:"next_check_attempt,omitempty"`
+	Plugin           string     `json:"plugin"`
+	CheckBundleCID   string     `json:"check_bundle_cid,omitempty"`
+	CheckDisplayName string     `json:"check_display_name,omitempty"`
+	CheckTarget      string     `json:"check_target,omitempty"`
+	CheckError       string     `json:"check_error,omitempty"`
+	CheckUUIDs       []string   `json:"check_uuids,omitempty"`
+	Brokers          []string   `json:"brokers,omitempty"`
+	QueuedMetrics    int64      `json:"queued_metrics"`
+	RetryPayloads    int        `json:"retry_payloads"`
+	RetryMetrics     int64      `json:"retry_metrics"`
+	CheckAttempts    int        `json:"check_attempts"`
+	Pending          bool       `json:"pending"`
+	Static           bool       `json:"static_submission_url,omitempty"`
+}
+
+// Status returns the metric destinations, keyed by destination key, for the agent's admin endpoint
+func (c *Circonus) Status() interface{} {
+	c.RLock()
+	dests := make(map[string]*metricDestination, len(c.metricDestinations))
+	for k, d := range c.metricDestinations {
+		dests[k] = d
+	}
+	c.RUnlock()
+
+	status := make(map[string]destinationStatus, len(dests))
+	for k, d := range dests {
+		status[k] = d.status()
+	}
+
+	return map[string]interface{}{
+		"metric_destinations": status,
+	}
+}
+
+func (d *metricDestination) status() destinationStatus {
+	d.flushmu.Lock()
+	ds := destinationStatus{
+		Plugin:        d.id,
+		QueuedMetrics: d.queuedMetrics.Load(),
+		CheckAttempts: d.checkAttempts,
+		Pending:       d.pending,
+	}
+	if d.pending {
+		if d.checkErr != nil {
+			ds.CheckError = d.checkErr.Error()
+		}
+		if !d.nextCheckAttempt.IsZero() {
+			next := d.nextCheckAttempt
+			ds.NextCheckAttempt = &next
+		}
+	}
+	if d.retry != nil {
+		ds.RetryPayloads = d.retry.len()
+		ds.RetryMetrics = d.retry.numMetrics
+		if !d.retry.nextAttempt.IsZero() {
+			next := d.retry.nextAttempt
+			ds.NextRetry = &next
+		}
+	}
+	trap := d.trap
+	d.flushmu.Unlock()
+
+	if !ds.Pending && trap != nil {
+		_, isCheck := circmgr.TrapCheck(trap)
+		ds.Static = !isCheck
+	}
+
+	// the submission url is intentionally omitted, it contains the check secret
+	if tc, ok := circmgr.TrapCheck(trap); ok {
+		bundle, err := tc.GetCheckBundle()
+		if err != nil {
+			ds.CheckError = err.Error()
+			return ds
+		}
+		ds.CheckBundleCID = bundle.CID
+		ds.CheckDisplayName = bundle.DisplayName
+		ds.CheckTarget = bundle.Target
+		ds.CheckUUIDs = bundle.CheckUUIDs
+		ds.Brokers = bundle.Brokers
+	}
+
+	return ds
+}
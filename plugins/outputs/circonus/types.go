@@ -0,0 +1,146 @@
+package circonus
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/typehint"
+	"github.com/circonus-labs/go-trapmetrics"
+)
+
+// histogramBucketRx matches the buckets of a serialized histogram, H[bucket]=count
+var histogramBucketRx = regexp.MustCompile(`H\[([^\]]+)\]=([0-9]+)`)
+
+// isHistogramString indicates whether an untyped string value looks like a serialized
+// histogram, a text field can be annotated (typehint.Text) to bypass the guess.
+func isHistogramString(s string) bool {
+	return strings.Contains(s, "H[") && strings.Contains(s, "]=")
+}
+
+// setTyped records a field value as the circonus type it is annotated with (see the
+// circonus_types processor), returns false if the value could not be converted.
+func (c *Circonus) setTyped(dest *metricDestination, typ, mn string, tags trapmetrics.Tags, value interface{}, ts *time.Time) bool {
+	switch typ {
+	case typehint.Counter:
+		val, ok := toUint64(value)
+		if !ok {
+			if s, isStr := value.(string); isStr {
+				if v, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64); err == nil {
+					val, ok = v, true
+				}
+			}
+		}
+		if !ok {
+			c.Log.Warnf("handling counter (%s) (%s) (%#v): unable to convert to uint64", mn, tags.String(), value)
+			return false
+		}
+		if err := dest.metrics.CounterIncrementByValue(mn, tags, val); err != nil {
+			c.Log.Warnf("incrementing counter (%s) (%s) (%#v): %s", mn, tags.String(), val, err)
+			return false
+		}
+	case typehint.Gauge:
+		val := value
+		switch v := value.(type) {
+		case bool:
+			val = 0
+			if v {
+				val = 1
+			}
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				c.Log.Warnf("handling gauge (%s) (%s) (%#v): unable to convert to float64", mn, tags.String(), value)
+				return false
+			}
+			val = f
+		}
+		if err := dest.metrics.GaugeSet(mn, tags, val, ts); err != nil {
+			c.Log.Warnf("setting gauge (%s) (%s) (%#v): %s", mn, tags.String(), value, err)
+			return false
+		}
+	case typehint.Text:
+		val, ok := value.(string)
+		if !ok {
+			val = fmt.Sprintf("%v", value)
+		}
+		if err := dest.metrics.TextSet(mn, tags, val, ts); err != nil {
+			c.Log.Warnf("setting text (%s) (%s) (%#v): %s", mn, tags.String(), value, err)
+			return false
+		}
+	case typehint.Histogram:
+		return c.recordHistogram(dest, mn, tags, value)
+	default:
+		c.Log.Warnf("unknown circonus type %q for (%s) (%s), ignoring", typ, mn, tags.String())
+		return false
+	}
+	return true
+}
+
+// recordHistogram records a serialized histogram (H[bucket]=count,...), or a single
+// numeric value as a sample.
+func (c *Circonus) recordHistogram(dest *metricDestination, mn string, tags trapmetrics.Tags, value interface{}) bool {
+	s, isStr := value.(string)
+	if !isStr {
+		f, ok := toFloat64(value)
+		if !ok {
+			c.Log.Warnf("handling histogram (%s) (%s) (%#v): unable to convert to float64", mn, tags.String(), value)
+			return false
+		}
+		if err := dest.metrics.HistogramRecordValue(mn, tags, f); err != nil {
+			c.Log.Warnf("recording histogram (%s %s): %s", mn, tags.String(), err)
+			return false
+		}
+		return true
+	}
+
+	buckets := histogramBucketRx.FindAllStringSubmatch(s, -1)
+	if len(buckets) == 0 {
+		c.Log.Warnf("handling histogram (%s) (%s) (%q): no H[bucket]=count buckets found", mn, tags.String(), s)
+		return false
+	}
+	recorded := false
+	for _, b := range buckets {
+		v, err := strconv.ParseFloat(b[1], 64)
+		if err != nil {
+			c.Log.Warnf("handling histogram (%s) (%s) bucket (%s): %s", mn, tags.String(), b[1], err)
+			continue
+		}
+		n, err := strconv.ParseInt(b[2], 10, 64)
+		if err != nil {
+			c.Log.Warnf("handling histogram (%s) (%s) bucket (%s) count (%s): %s", mn, tags.String(), b[1], b[2], err)
+			continue
+		}
+		if err := dest.metrics.HistogramRecordCountForValue(mn, tags, n, v); err != nil {
+			c.Log.Warnf("recording histogram (%s %s): %s", mn, tags.String(), err)
+			continue
+		}
+		recorded = true
+	}
+	return recorded
+}
+
+func toFloat64(unk interface{}) (float64, bool) {
+	switch v := unk.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
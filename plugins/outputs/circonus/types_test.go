@@ -0,0 +1,74 @@
+package circonus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	circmgr "github.com/circonus-labs/circonus-unified-agent/internal/circonus"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/typehint"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/circonus-labs/go-trapmetrics"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildMetricTypeHints(t *testing.T) {
+	tm, err := trapmetrics.New(&trapmetrics.Config{})
+	require.NoError(t, err)
+	c := &Circonus{
+		Log: testutil.Logger{},
+		metricDestinations: map[string]*metricDestination{
+			circmgr.MetricMeta{}.Key(): {metrics: tm},
+		},
+	}
+	tags := trapmetrics.Tags{{Category: "host", Value: "a"}, {Category: "input_metric_group", Value: "app"}}
+
+	m := testutil.MustMetric(
+		"app",
+		map[string]string{
+			"host":                     "a",
+			"__circonus_type_requests": "counter",
+			"__circonus_type_banner":   "text",
+			"__circonus_type_latency":  "histogram",
+			"__circonus_type_up":       "gauge",
+		},
+		map[string]interface{}{
+			"requests": "12",
+			"banner":   "H[ello]=world",
+			"latency":  0.25,
+			"up":       true,
+			"other":    "text",
+		},
+		time.Now(),
+	)
+	typehint.Extract(m)
+	require.Len(t, m.TagList(), 1, "reserved tags are moved to the type hints")
+	require.Equal(t, int64(5), c.buildMetric(0, m))
+
+	_, err = tm.CounterFetch("requests", tags)
+	require.NoError(t, err)
+	_, err = tm.TextFetch("banner", tags)
+	require.NoError(t, err, "annotated text is not parsed as a histogram")
+	_, err = tm.HistogramFetch("latency", tags)
+	require.NoError(t, err)
+	_, err = tm.GaugeFetch("up", tags)
+	require.NoError(t, err)
+	_, err = tm.TextFetch("other", tags)
+	require.NoError(t, err)
+
+	// metric type, a counter metric's field sent as a serialized histogram
+	m = testutil.MustMetric(
+		"app",
+		map[string]string{"host": "a", "__circonus_type": "histogram"},
+		map[string]interface{}{"duration": "H[0.1]=3,H[0.2]=1"},
+		time.Now(),
+		cua.Counter,
+	)
+	typehint.Extract(m)
+	require.Equal(t, int64(1), c.buildMetric(0, m))
+	_, err = tm.HistogramFetch("duration", tags)
+	require.NoError(t, err)
+
+	// type hints are not stream tags
+	require.Equal(t, tags, c.convertTags(m))
+}
@@ -0,0 +1,238 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/proxy"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/tls"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/outputs"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/serializers"
+)
+
+const (
+	defaultURL         = "http://127.0.0.1:8080/metrics"
+	defaultMethod      = http.MethodPost
+	defaultContentType = "text/plain; charset=utf-8"
+	defaultTimeout     = 5 * time.Second
+
+	// maxErrorBody is how much of an error response is included in the error
+	maxErrorBody = 1024
+)
+
+var sampleConfig = `
+  ## URL is the address to send metrics to
+  url = "http://127.0.0.1:8080/metrics"
+
+  ## HTTP method, one of: "POST", "PUT" or "PATCH"
+  # method = "POST"
+
+  ## Timeout for the HTTP request
+  # timeout = "5s"
+
+  ## Optional HTTP Basic Auth Credentials
+  # username = "username"
+  # password = "pa$$word"
+
+  ## Additional HTTP headers, Content-Type defaults to "text/plain; charset=utf-8"
+  # [outputs.http.headers]
+  #   Content-Type = "application/json"
+  #   Authorization = "Bearer @{files:http_token}"
+
+  ## HTTP Content-Encoding for the request body, can be set to "gzip" to
+  ## compress the body or "identity" to apply no encoding.
+  # content_encoding = "identity"
+
+  ## Status codes treated as success, other statuses fail the write and the
+  ## metrics are retried on the next flush (kept in the output's buffer)
+  # success_status_codes = [200, 201, 202, 204]
+
+  ## HTTP Proxy support
+  # http_proxy_url = ""
+
+  ## Optional TLS Config
+  # tls_ca = "/opt/circonus/unified-agent/etc/ca.pem"
+  # tls_cert = "/opt/circonus/unified-agent/etc/cert.pem"
+  # tls_key = "/opt/circonus/unified-agent/etc/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## Data format to output.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/circonus-labs/circonus-unified-agent/blob/master/docs/DATA_FORMATS_OUTPUT.md
+  # data_format = "circonus"
+`
+
+// HTTP sends each batch of metrics, serialized with the data_format, to an http endpoint.
+type HTTP struct {
+	Headers            map[string]string `toml:"headers"`
+	URL                string            `toml:"url"`
+	Method             string            `toml:"method"`
+	Username           string            `toml:"username"`
+	Password           string            `toml:"password"`
+	ContentEncoding    string            `toml:"content_encoding"`
+	SuccessStatusCodes []int             `toml:"success_status_codes"`
+	Timeout            internal.Duration `toml:"timeout"`
+	Log                cua.Logger        `toml:"-"`
+	proxy.HTTPProxy
+	tls.ClientConfig
+
+	client     *http.Client
+	encoder    internal.ContentEncoder
+	serializer serializers.Serializer
+}
+
+func (h *HTTP) SetSerializer(serializer serializers.Serializer) {
+	h.serializer = serializer
+}
+
+func (h *HTTP) Init() error {
+	if h.URL == "" {
+		h.URL = defaultURL
+	}
+	if h.Method == "" {
+		h.Method = defaultMethod
+	}
+	h.Method = strings.ToUpper(h.Method)
+	switch h.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("invalid method %q (POST, PUT or PATCH)", h.Method)
+	}
+	if h.Timeout.Duration == 0 {
+		h.Timeout.Duration = defaultTimeout
+	}
+	if len(h.SuccessStatusCodes) == 0 {
+		h.SuccessStatusCodes = []int{http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent}
+	}
+
+	encoder, err := internal.NewContentEncoder(h.ContentEncoding)
+	if err != nil {
+		return fmt.Errorf("content_encoding: %w", err)
+	}
+	h.encoder = encoder
+
+	return nil
+}
+
+func (h *HTTP) Connect() error {
+	tlsCfg, err := h.ClientConfig.TLSConfig()
+	if err != nil {
+		return fmt.Errorf("TLSConfig: %w", err)
+	}
+
+	proxy, err := h.HTTPProxy.Proxy()
+	if err != nil {
+		return fmt.Errorf("proxy: %w", err)
+	}
+
+	h.client = &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: tlsCfg,
+			Proxy:           proxy,
+		},
+		Timeout: h.Timeout.Duration,
+	}
+
+	return nil
+}
+
+func (h *HTTP) Close() error {
+	if h.client != nil {
+		h.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+func (h *HTTP) Description() string {
+	return "Send metrics to an HTTP endpoint"
+}
+
+func (h *HTTP) SampleConfig() string {
+	return sampleConfig
+}
+
+// Write sends the metrics as a single request, an error is returned if the request
+// fails so the metrics are kept in the buffer and written again on the next flush.
+func (h *HTTP) Write(metrics []cua.Metric) (int, error) {
+	if len(metrics) == 0 {
+		return 0, nil
+	}
+
+	body, err := h.serializer.SerializeBatch(metrics)
+	if err != nil {
+		// the metrics can't be serialized, retrying will not help
+		h.Log.Errorf("Could not serialize metrics: %v", err)
+		return 0, nil
+	}
+
+	if err := h.write(body); err != nil {
+		return 0, err
+	}
+
+	return len(metrics), nil
+}
+
+func (h *HTTP) write(body []byte) error {
+	body, err := h.encoder.Encode(body)
+	if err != nil {
+		return fmt.Errorf("encoding body: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), h.Timeout.Duration)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, h.Method, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("http new req (%s): %w", h.URL, err)
+	}
+
+	if h.Username != "" || h.Password != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+	req.Header.Set("User-Agent", internal.ProductToken())
+	req.Header.Set("Content-Type", defaultContentType)
+	if h.ContentEncoding == "gzip" {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range h.Headers {
+		if strings.EqualFold(k, "host") {
+			req.Host = v
+			continue
+		}
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("http do (%s): %w", h.URL, err)
+	}
+	defer resp.Body.Close()
+
+	for _, code := range h.SuccessStatusCodes {
+		if resp.StatusCode == code {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			return nil
+		}
+	}
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	if len(msg) > 0 {
+		return fmt.Errorf("when writing to [%s] received status code: %d: %s", h.URL, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return fmt.Errorf("when writing to [%s] received status code: %d", h.URL, resp.StatusCode)
+}
+
+func init() {
+	outputs.Add("http", func() cua.Output {
+		return &HTTP{}
+	})
+}
@@ -0,0 +1,143 @@
+package http
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/plugins/serializers"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPWrite(t *testing.T) {
+	var (
+		status = http.StatusOK
+		req    *http.Request
+		body   []byte
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		var rd io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			rd = gz
+		}
+		var err error
+		body, err = io.ReadAll(rd)
+		require.NoError(t, err)
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+
+	s, err := serializers.NewJSONSerializer(time.Second)
+	require.NoError(t, err)
+	expected, err := s.SerializeBatch(testutil.MockMetrics())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		plugin *HTTP
+		status int
+		errStr string
+	}{
+		{
+			name:   "post",
+			plugin: &HTTP{URL: ts.URL},
+			status: http.StatusOK,
+		},
+		{
+			name: "put gzip with headers",
+			plugin: &HTTP{
+				URL:             ts.URL,
+				Method:          "put",
+				ContentEncoding: "gzip",
+				Username:        "user",
+				Password:        "pass",
+				Headers:         map[string]string{"Content-Type": "application/json", "X-Test": "yes"},
+			},
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "server error is returned for retry",
+			plugin: &HTTP{URL: ts.URL},
+			status: http.StatusServiceUnavailable,
+			errStr: "received status code: 503",
+		},
+		{
+			name:   "custom success status",
+			plugin: &HTTP{URL: ts.URL, SuccessStatusCodes: []int{http.StatusTeapot}},
+			status: http.StatusOK,
+			errStr: "received status code: 200",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status = tt.status
+			tt.plugin.Log = testutil.Logger{}
+			tt.plugin.SetSerializer(s)
+			require.NoError(t, tt.plugin.Init())
+			require.NoError(t, tt.plugin.Connect())
+			defer tt.plugin.Close()
+
+			n, err := tt.plugin.Write(testutil.MockMetrics())
+			if tt.errStr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.errStr)
+				require.Equal(t, 0, n)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, 1, n)
+			require.Equal(t, expected, body)
+			require.Equal(t, tt.plugin.Method, req.Method)
+			if tt.plugin.Username != "" {
+				user, pass, ok := req.BasicAuth()
+				require.True(t, ok)
+				require.Equal(t, "user", user)
+				require.Equal(t, "pass", pass)
+			}
+			for k, v := range tt.plugin.Headers {
+				require.Equal(t, v, req.Header.Get(k))
+			}
+			if tt.plugin.Headers["Content-Type"] == "" {
+				require.Equal(t, defaultContentType, req.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestHTTPInit(t *testing.T) {
+	h := &HTTP{Method: "GET"}
+	require.Error(t, h.Init())
+
+	h = &HTTP{ContentEncoding: "br"}
+	require.Error(t, h.Init())
+
+	h = &HTTP{}
+	require.NoError(t, h.Init())
+	require.Equal(t, defaultURL, h.URL)
+	require.Equal(t, http.MethodPost, h.Method)
+	require.Equal(t, defaultTimeout, h.Timeout.Duration)
+}
+
+func TestHTTPConnectionRefused(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	url := ts.URL
+	ts.Close()
+
+	s, err := serializers.NewJSONSerializer(time.Second)
+	require.NoError(t, err)
+	h := &HTTP{URL: url, Log: testutil.Logger{}}
+	h.SetSerializer(s)
+	require.NoError(t, h.Init())
+	require.NoError(t, h.Connect())
+
+	_, err = h.Write(testutil.MockMetrics())
+	require.Error(t, err)
+}
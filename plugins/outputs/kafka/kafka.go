@@ -0,0 +1,324 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Shopify/sarama"
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/kafka"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/outputs"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/serializers"
+)
+
+var sampleConfig = `
+  ## URLs of kafka brokers
+  brokers = ["localhost:9092"]
+
+  ## Kafka topic for producer messages
+  topic = "circonus"
+
+  ## The value of this tag will be used as the topic.  If not set the 'topic'
+  ## option is used.
+  # topic_tag = ""
+
+  ## If true, the 'topic_tag' will be removed from the metric.
+  # exclude_topic_tag = false
+
+  ## Suffix added to the topic, from the measurement or tags of the metric:
+  ##   method = "measurement" - topic = <topic><separator><measurement>
+  ##   method = "tags"        - topic = <topic><separator><tag value>... for each of keys
+  ## metrics missing a tag use the topic without the suffix.
+  # [outputs.kafka.topic_suffix]
+  #   method = "measurement"
+  #   # keys = ["host"]
+  #   separator = "_"
+
+  ## The partition key, messages with the same key go to the same partition:
+  ##   routing_tag - the value of this tag, if present, is the key
+  ##   routing_key - a constant key, used when routing_tag is not set or missing
+  ## Without a key messages are spread across the partitions.
+  # routing_tag = "host"
+  # routing_key = ""
+
+  ## Optional Client id
+  # client_id = "Circonus"
+
+  ## Set the minimal supported Kafka version.  Setting this enables the use of new
+  ## Kafka features and APIs.  Of particular interest, lz4 compression
+  ## requires at least version 0.10.0.0.
+  ##   ex: version = "1.1.0"
+  # version = ""
+
+  ## Compression codec represents the various compression codecs recognized by
+  ## Kafka in messages.
+  ##  0 : None
+  ##  1 : Gzip
+  ##  2 : Snappy
+  ##  3 : LZ4
+  ##  4 : ZSTD
+  # compression_codec = 0
+
+  ## Idempotent Writes
+  ## If enabled, exactly one copy of each message is written.
+  # idempotent_writes = false
+
+  ## RequiredAcks is used in Produce Requests to tell the broker how many
+  ## replica acknowledgements it must see before responding
+  ##  0 : the producer never waits for an acknowledgement from the broker.
+  ##  1 : the producer gets an acknowledgement after the leader replica has
+  ##      received the data.
+  ## -1 : the producer gets an acknowledgement after all in-sync replicas have
+  ##      received the data.
+  # required_acks = -1
+
+  ## The maximum number of times to retry sending a metric before failing
+  ## until the next flush.
+  # max_retry = 3
+
+  ## The maximum permitted size of a message. Should be set equal to or
+  ## smaller than the broker's 'message.max.bytes'.
+  # max_message_bytes = 1000000
+
+  ## Optional TLS Config
+  # tls_ca = "/opt/circonus/unified-agent/etc/ca.pem"
+  # tls_cert = "/opt/circonus/unified-agent/etc/cert.pem"
+  # tls_key = "/opt/circonus/unified-agent/etc/key.pem"
+  ## Use TLS but skip chain & host verification
+  # insecure_skip_verify = false
+
+  ## SASL authentication credentials.  These settings should typically be used
+  ## with TLS encryption enabled
+  # sasl_username = "kafka"
+  # sasl_password = "secret"
+
+  ## Optional SASL:
+  ## one of: OAUTHBEARER, PLAIN, SCRAM-SHA-256, SCRAM-SHA-512, GSSAPI
+  ## (defaults to PLAIN)
+  # sasl_mechanism = ""
+
+  ## SASL protocol version.  When connecting to Azure EventHub set to 0.
+  # sasl_version = 1
+
+  ## Data format to output.
+  ## Each data format has its own unique set of configuration options, read
+  ## more about them here:
+  ## https://github.com/circonus-labs/circonus-unified-agent/blob/master/docs/DATA_FORMATS_OUTPUT.md
+  # data_format = "circonus"
+`
+
+const (
+	defaultRequiredAcks = -1
+	defaultMaxRetry     = 3
+
+	topicSuffixMeasurement = "measurement"
+	topicSuffixTags        = "tags"
+)
+
+// TopicSuffix adds the measurement or tag values of a metric to the topic
+type TopicSuffix struct {
+	Method    string   `toml:"method"`
+	Keys      []string `toml:"keys"`
+	Separator string   `toml:"separator"`
+}
+
+// ProducerCreator creates the sarama producer, replaced in tests
+type ProducerCreator func(brokers []string, config *sarama.Config) (sarama.SyncProducer, error)
+
+// Kafka writes each metric, serialized with the data_format, as a message to a kafka topic
+type Kafka struct {
+	Brokers         []string    `toml:"brokers"`
+	Topic           string      `toml:"topic"`
+	TopicTag        string      `toml:"topic_tag"`
+	ExcludeTopicTag bool        `toml:"exclude_topic_tag"`
+	TopicSuffix     TopicSuffix `toml:"topic_suffix"`
+	RoutingTag      string      `toml:"routing_tag"`
+	RoutingKey      string      `toml:"routing_key"`
+	kafka.WriteConfig
+
+	Log cua.Logger `toml:"-"`
+
+	ProducerCreator ProducerCreator `toml:"-"`
+	saramaConfig    *sarama.Config
+	producer        sarama.SyncProducer
+	serializer      serializers.Serializer
+}
+
+func (k *Kafka) SetSerializer(serializer serializers.Serializer) {
+	k.serializer = serializer
+}
+
+func (k *Kafka) Init() error {
+	if len(k.Brokers) == 0 {
+		k.Brokers = []string{"localhost:9092"}
+	}
+	if k.Topic == "" {
+		return fmt.Errorf("topic is required")
+	}
+
+	switch k.TopicSuffix.Method {
+	case "", topicSuffixMeasurement:
+	case topicSuffixTags:
+		if len(k.TopicSuffix.Keys) == 0 {
+			return fmt.Errorf("topic_suffix: keys are required with method %q", topicSuffixTags)
+		}
+	default:
+		return fmt.Errorf("topic_suffix: unknown method %q (measurement, tags)", k.TopicSuffix.Method)
+	}
+
+	config := sarama.NewConfig()
+	if err := k.WriteConfig.SetConfig(config); err != nil {
+		return fmt.Errorf("kafka config: %w", err)
+	}
+	if k.IdempotentWrites {
+		// required by sarama for idempotent producers
+		config.Net.MaxOpenRequests = 1
+	}
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("kafka config: %w", err)
+	}
+	k.saramaConfig = config
+
+	if k.ProducerCreator == nil {
+		k.ProducerCreator = sarama.NewSyncProducer
+	}
+
+	return nil
+}
+
+func (k *Kafka) Connect() error {
+	producer, err := k.ProducerCreator(k.Brokers, k.saramaConfig)
+	if err != nil {
+		return fmt.Errorf("new producer: %w", err)
+	}
+	k.producer = producer
+	return nil
+}
+
+func (k *Kafka) Close() error {
+	if k.producer == nil {
+		return nil
+	}
+	if err := k.producer.Close(); err != nil {
+		return fmt.Errorf("producer close: %w", err)
+	}
+	return nil
+}
+
+func (k *Kafka) Description() string {
+	return "Send metrics to a Kafka topic"
+}
+
+func (k *Kafka) SampleConfig() string {
+	return sampleConfig
+}
+
+// topic returns the metric's topic, and the metric to serialize (without the
+// topic tag when it is excluded).
+func (k *Kafka) topic(m cua.Metric) (string, cua.Metric) {
+	topic := k.Topic
+	if k.TopicTag != "" {
+		if t, ok := m.GetTag(k.TopicTag); ok && t != "" {
+			topic = t
+			if k.ExcludeTopicTag {
+				m = m.Copy()
+				m.RemoveTag(k.TopicTag)
+			}
+		}
+	}
+
+	switch k.TopicSuffix.Method {
+	case topicSuffixMeasurement:
+		topic += k.TopicSuffix.Separator + m.Name()
+	case topicSuffixTags:
+		var suffix strings.Builder
+		for _, key := range k.TopicSuffix.Keys {
+			v, ok := m.GetTag(key)
+			if !ok || v == "" {
+				return topic, m
+			}
+			suffix.WriteString(k.TopicSuffix.Separator)
+			suffix.WriteString(v)
+		}
+		topic += suffix.String()
+	}
+
+	return topic, m
+}
+
+// routingKey returns the metric's partition key, nil spreads messages across partitions
+func (k *Kafka) routingKey(m cua.Metric) sarama.Encoder {
+	if k.RoutingTag != "" {
+		if key, ok := m.GetTag(k.RoutingTag); ok && key != "" {
+			return sarama.StringEncoder(key)
+		}
+	}
+	if k.RoutingKey != "" {
+		return sarama.StringEncoder(k.RoutingKey)
+	}
+	return nil
+}
+
+// Write sends a message for each metric, an error is returned if the messages
+// could not be delivered so the metrics are written again on the next flush.
+func (k *Kafka) Write(metrics []cua.Metric) (int, error) {
+	msgs := make([]*sarama.ProducerMessage, 0, len(metrics))
+	for _, metric := range metrics {
+		topic, m := k.topic(metric)
+
+		buf, err := k.serializer.Serialize(m)
+		if err != nil {
+			k.Log.Debugf("Could not serialize metric: %v", err)
+			continue
+		}
+
+		msg := &sarama.ProducerMessage{
+			Topic: topic,
+			Key:   k.routingKey(metric),
+			Value: sarama.ByteEncoder(buf),
+		}
+		// message timestamps require kafka 0.10.0.0
+		if k.saramaConfig.Version.IsAtLeast(sarama.V0_10_0_0) {
+			msg.Timestamp = m.Time()
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return 0, nil
+	}
+
+	err := k.producer.SendMessages(msgs)
+	if err == nil {
+		return len(metrics), nil
+	}
+
+	var errs sarama.ProducerErrors
+	if errors.As(err, &errs) {
+		for _, prodErr := range errs {
+			// retrying will not help, the message is dropped
+			if errors.Is(prodErr.Err, sarama.ErrMessageSizeTooLarge) {
+				k.Log.Errorf("Message too large, consider increasing `max_message_bytes`; dropping batch")
+				return 0, nil
+			}
+			if errors.Is(prodErr.Err, sarama.ErrInvalidTimestamp) {
+				k.Log.Errorf("The timestamp of the message is out of acceptable range, consider increasing broker `message.timestamp.difference.max.ms`; dropping batch")
+				return 0, nil
+			}
+		}
+		return 0, fmt.Errorf("sending messages: %w", errs[0].Err)
+	}
+
+	return 0, fmt.Errorf("sending messages: %w", err)
+}
+
+func init() {
+	outputs.Add("kafka", func() cua.Output {
+		return &Kafka{
+			WriteConfig: kafka.WriteConfig{
+				RequiredAcks: defaultRequiredAcks,
+				MaxRetry:     defaultMaxRetry,
+			},
+		}
+	})
+}
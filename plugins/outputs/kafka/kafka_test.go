@@ -0,0 +1,141 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/serializers"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProducer struct {
+	sarama.SyncProducer
+	msgs []*sarama.ProducerMessage
+	err  error
+}
+
+func (p *fakeProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func (p *fakeProducer) Close() error {
+	return nil
+}
+
+func newTestKafka(t *testing.T, k *Kafka) (*Kafka, *fakeProducer) {
+	t.Helper()
+	producer := &fakeProducer{}
+	k.Log = testutil.Logger{}
+	k.ProducerCreator = func([]string, *sarama.Config) (sarama.SyncProducer, error) {
+		return producer, nil
+	}
+	s, err := serializers.NewJSONSerializer(time.Second)
+	require.NoError(t, err)
+	k.SetSerializer(s)
+	require.NoError(t, k.Init())
+	require.NoError(t, k.Connect())
+	return k, producer
+}
+
+func testMetrics() []cua.Metric {
+	return []cua.Metric{
+		testutil.MustMetric("cpu",
+			map[string]string{"host": "web01", "team": "ops"},
+			map[string]interface{}{"usage": 42.0},
+			time.Unix(0, 0)),
+		testutil.MustMetric("mem",
+			map[string]string{"host": "web02"},
+			map[string]interface{}{"used": 1024},
+			time.Unix(0, 0)),
+	}
+}
+
+func TestKafkaTopicRouting(t *testing.T) {
+	tests := []struct {
+		name   string
+		plugin *Kafka
+		topics []string
+		keys   []sarama.Encoder
+	}{
+		{
+			name:   "topic",
+			plugin: &Kafka{Topic: "metrics"},
+			topics: []string{"metrics", "metrics"},
+			keys:   []sarama.Encoder{nil, nil},
+		},
+		{
+			name:   "topic tag",
+			plugin: &Kafka{Topic: "metrics", TopicTag: "team", ExcludeTopicTag: true},
+			topics: []string{"ops", "metrics"},
+			keys:   []sarama.Encoder{nil, nil},
+		},
+		{
+			name:   "measurement suffix and routing tag",
+			plugin: &Kafka{Topic: "metrics", TopicSuffix: TopicSuffix{Method: "measurement", Separator: "_"}, RoutingTag: "host"},
+			topics: []string{"metrics_cpu", "metrics_mem"},
+			keys:   []sarama.Encoder{sarama.StringEncoder("web01"), sarama.StringEncoder("web02")},
+		},
+		{
+			name:   "tags suffix and routing key",
+			plugin: &Kafka{Topic: "metrics", TopicSuffix: TopicSuffix{Method: "tags", Keys: []string{"team", "host"}, Separator: "."}, RoutingTag: "team", RoutingKey: "default"},
+			topics: []string{"metrics.ops.web01", "metrics"},
+			keys:   []sarama.Encoder{sarama.StringEncoder("ops"), sarama.StringEncoder("default")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, producer := newTestKafka(t, tt.plugin)
+			n, err := k.Write(testMetrics())
+			require.NoError(t, err)
+			require.Equal(t, 2, n)
+			require.Len(t, producer.msgs, 2)
+			for i, msg := range producer.msgs {
+				require.Equal(t, tt.topics[i], msg.Topic)
+				require.Equal(t, tt.keys[i], msg.Key)
+			}
+		})
+	}
+}
+
+func TestKafkaExcludeTopicTag(t *testing.T) {
+	k, producer := newTestKafka(t, &Kafka{Topic: "metrics", TopicTag: "team", ExcludeTopicTag: true})
+	metrics := testMetrics()
+	_, err := k.Write(metrics)
+	require.NoError(t, err)
+
+	value, err := producer.msgs[0].Value.Encode()
+	require.NoError(t, err)
+	require.NotContains(t, string(value), `"team"`)
+	// the metric passed to the output is not modified
+	require.True(t, metrics[0].HasTag("team"))
+}
+
+func TestKafkaWriteErrors(t *testing.T) {
+	k, producer := newTestKafka(t, &Kafka{Topic: "metrics"})
+
+	// delivery failures are returned so the batch is retried
+	producer.err = sarama.ProducerErrors{&sarama.ProducerError{Err: sarama.ErrOutOfBrokers}}
+	_, err := k.Write(testMetrics())
+	require.Error(t, err)
+	require.True(t, errors.Is(err, sarama.ErrOutOfBrokers))
+
+	// messages the broker will never accept are dropped
+	producer.err = sarama.ProducerErrors{&sarama.ProducerError{Err: sarama.ErrMessageSizeTooLarge}}
+	_, err = k.Write(testMetrics())
+	require.NoError(t, err)
+}
+
+func TestKafkaInit(t *testing.T) {
+	require.Error(t, (&Kafka{}).Init())
+	require.Error(t, (&Kafka{Topic: "metrics", TopicSuffix: TopicSuffix{Method: "tags"}}).Init())
+	require.Error(t, (&Kafka{Topic: "metrics", TopicSuffix: TopicSuffix{Method: "field"}}).Init())
+}
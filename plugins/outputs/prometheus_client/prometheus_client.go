@@ -0,0 +1,429 @@
+package prometheusclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
+	tlsint "github.com/circonus-labs/circonus-unified-agent/plugins/common/tls"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/outputs"
+	serializer "github.com/circonus-labs/circonus-unified-agent/plugins/serializers/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+const (
+	defaultListen             = ":9273"
+	defaultPath               = "/metrics"
+	defaultExpirationInterval = 60 * time.Second
+	defaultReadTimeout        = 10 * time.Second
+	defaultWriteTimeout       = 10 * time.Second
+
+	// overflowBound is the bucket value the prometheus input uses for +Inf
+	overflowBound = 10e+127
+)
+
+var sampleConfig = `
+  ## Address to listen on.
+  # listen = ":9273"
+
+  ## Path to publish the metrics on.
+  # path = "/metrics"
+
+  ## Expiration interval for each metric. Metrics not updated within the
+  ## interval are no longer published, 0 == no expiration.
+  # expiration_interval = "60s"
+
+  ## The maximum duration for reading the entire request.
+  # read_timeout = "10s"
+  ## The maximum duration for writing the entire response.
+  # write_timeout = "10s"
+
+  ## Username and password to accept for HTTP basic authentication.
+  # basic_username = "user1"
+  # basic_password = "secret"
+
+  ## Allowed CA certificates for client certificates.
+  # tls_allowed_cacerts = ["/opt/circonus/unified-agent/etc/clientca.pem"]
+
+  ## TLS server certificate and private key, when set the metrics are
+  ## served over https.
+  # tls_cert = "/opt/circonus/unified-agent/etc/cert.pem"
+  # tls_key = "/opt/circonus/unified-agent/etc/key.pem"
+
+  ## Send string fields as labels, by default string fields are discarded.
+  # string_as_label = false
+
+  ## Export the metric timestamps, by default the scrape time is used.
+  # export_timestamp = false
+
+  ## Sort the metric families and metrics, useful for debugging.
+  # sort_metrics = false
+`
+
+type PrometheusClient struct {
+	Listen             string            `toml:"listen"`
+	Path               string            `toml:"path"`
+	ExpirationInterval internal.Duration `toml:"expiration_interval"`
+	ReadTimeout        internal.Duration `toml:"read_timeout"`
+	WriteTimeout       internal.Duration `toml:"write_timeout"`
+	BasicUsername      string            `toml:"basic_username"`
+	BasicPassword      string            `toml:"basic_password"`
+	StringAsLabel      bool              `toml:"string_as_label"`
+	ExportTimestamp    bool              `toml:"export_timestamp"`
+	SortMetrics        bool              `toml:"sort_metrics"`
+	tlsint.ServerConfig
+
+	Log cua.Logger
+
+	wg      sync.WaitGroup
+	server  *http.Server
+	tlsConf *tls.Config
+	origin  string
+
+	mu         sync.Mutex
+	coll       *serializer.Collection
+	histograms map[uint64]*histogram
+}
+
+// histogram holds the bucket counts of a circonus histogram series, the
+// counts of cua.Histogram metrics are for an interval so they are summed
+// to get the cumulative counts prometheus expects.
+type histogram struct {
+	counts  map[float64]uint64 // keyed by bucket upper bound
+	addTime time.Time
+}
+
+func (p *PrometheusClient) SampleConfig() string {
+	return sampleConfig
+}
+
+func (p *PrometheusClient) Description() string {
+	return "Configuration for the Prometheus client to spawn"
+}
+
+func (p *PrometheusClient) Init() error {
+	if p.Path == "" {
+		p.Path = defaultPath
+	}
+
+	var err error
+	p.tlsConf, err = p.ServerConfig.TLSConfig()
+	if err != nil {
+		return fmt.Errorf("TLSConfig: %w", err)
+	}
+
+	config := serializer.FormatConfig{}
+	if p.StringAsLabel {
+		config.StringHandling = serializer.StringAsLabel
+	}
+	if p.ExportTimestamp {
+		config.TimestampExport = serializer.ExportTimestamp
+	}
+	if p.SortMetrics {
+		config.MetricSortOrder = serializer.SortMetrics
+	}
+
+	p.coll = serializer.NewCollection(config)
+	p.histograms = make(map[uint64]*histogram)
+
+	return nil
+}
+
+// Connect starts the HTTP server.
+func (p *PrometheusClient) Connect() error {
+	authHandler := internal.AuthHandler(p.BasicUsername, p.BasicPassword, "prometheus", onAuthError)
+
+	mux := http.NewServeMux()
+	mux.Handle(p.Path, authHandler(p))
+
+	p.server = &http.Server{
+		Addr:         p.Listen,
+		Handler:      mux,
+		ReadTimeout:  p.ReadTimeout.Duration,
+		WriteTimeout: p.WriteTimeout.Duration,
+		TLSConfig:    p.tlsConf,
+	}
+
+	listener, err := p.listen()
+	if err != nil {
+		return err
+	}
+
+	origin := p.getOrigin(listener)
+	p.origin = origin
+
+	p.Log.Infof("Listening on %s%s", origin, p.Path)
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		err := p.server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			p.Log.Errorf("Serve error on %s: %v", origin, err)
+		}
+	}()
+
+	return nil
+}
+
+func onAuthError(_ http.ResponseWriter) {
+}
+
+func (p *PrometheusClient) listen() (net.Listener, error) {
+	if p.tlsConf != nil {
+		return tls.Listen("tcp", p.Listen, p.tlsConf) //nolint:wrapcheck
+	}
+	return net.Listen("tcp", p.Listen) //nolint:wrapcheck
+}
+
+func (p *PrometheusClient) getOrigin(listener net.Listener) string {
+	scheme := "http"
+	if p.tlsConf != nil {
+		scheme = "https"
+	}
+	origin := &url.URL{
+		Scheme: scheme,
+		Host:   listener.Addr().String(),
+	}
+	return origin.String()
+}
+
+// URL returns the address of the metrics endpoint.
+func (p *PrometheusClient) URL() string {
+	return p.origin + p.Path
+}
+
+func (p *PrometheusClient) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	p.mu.Lock()
+	p.expire(time.Now())
+	families := p.coll.GetProto()
+	p.mu.Unlock()
+
+	format := expfmt.Negotiate(req.Header)
+	rw.Header().Set("Content-Type", string(format))
+	enc := expfmt.NewEncoder(rw, format)
+	for _, mf := range families {
+		if err := enc.Encode(mf); err != nil {
+			p.Log.Errorf("encoding %s: %s", mf.GetName(), err)
+			return
+		}
+	}
+}
+
+// Write updates the published metrics with the last value of each series.
+func (p *PrometheusClient) Write(metrics []cua.Metric) (int, error) {
+	now := time.Now()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire(now)
+
+	for _, m := range metrics {
+		switch m.Type() {
+		case cua.Histogram:
+			if isPrometheusHistogram(m) {
+				p.coll.Add(m, now)
+				continue
+			}
+			p.addHistogram(m, now, false)
+		case cua.CumulativeHistogram:
+			p.addHistogram(m, now, true)
+		case cua.Counter, cua.Gauge, cua.Untyped, cua.Summary:
+			p.coll.Add(m, now)
+		}
+	}
+
+	return len(metrics), nil
+}
+
+// isPrometheusHistogram reports whether the metric holds prometheus style
+// histogram fields, the buckets are separate metrics with an le tag.
+func isPrometheusHistogram(m cua.Metric) bool {
+	if _, ok := m.GetTag("le"); ok {
+		return true
+	}
+	for _, field := range m.FieldList() {
+		if strings.HasSuffix(field.Key, "_sum") || strings.HasSuffix(field.Key, "_count") {
+			return true
+		}
+	}
+	return false
+}
+
+// addHistogram converts a circonus histogram, fields keyed by bucket value
+// with the count of samples in the bucket, to a prometheus histogram.
+//
+// The fields of cua.Histogram metrics are circonus log linear bins, the
+// bucket upper bound is the bin value plus the bin width. The fields of
+// cua.CumulativeHistogram metrics are already keyed by the upper bound and
+// the counts are cumulative over time, they replace the previous counts.
+func (p *PrometheusClient) addHistogram(m cua.Metric, now time.Time, cumulative bool) {
+	counts := make(map[float64]uint64)
+	for _, field := range m.FieldList() {
+		v, err := strconv.ParseFloat(field.Key, 64)
+		if err != nil {
+			p.Log.Debugf("cannot parse histogram (%s) field.key (%s) as float: %s", m.Name(), field.Key, err)
+			continue
+		}
+		count, ok := serializer.SampleCount(field.Value)
+		if !ok {
+			continue
+		}
+		bound := v
+		if !cumulative {
+			bound = binUpperBound(v)
+		}
+		if v >= overflowBound {
+			bound = math.Inf(1)
+		}
+		counts[bound] += count
+	}
+	if len(counts) == 0 {
+		return
+	}
+
+	key := m.HashID()
+	h, ok := p.histograms[key]
+	if !ok || cumulative {
+		h = &histogram{counts: make(map[float64]uint64)}
+		p.histograms[key] = h
+	}
+	for bound, count := range counts {
+		h.counts[bound] += count
+	}
+	h.addTime = now
+
+	p.coll.AddHistogram(m, h.prometheus(cumulative), now)
+}
+
+// prometheus returns the histogram with cumulative bucket counts.
+func (h *histogram) prometheus(cumulative bool) *serializer.Histogram {
+	bounds := make([]float64, 0, len(h.counts))
+	for bound := range h.counts {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+
+	ph := &serializer.Histogram{
+		Buckets: make([]serializer.Bucket, 0, len(bounds)),
+	}
+	for i, bound := range bounds {
+		count := h.counts[bound]
+		ph.Count += count
+		ph.Buckets = append(ph.Buckets, serializer.Bucket{Bound: bound, Count: ph.Count})
+
+		// the sum is estimated from the bucket each sample is in
+		if math.IsInf(bound, 1) {
+			continue
+		}
+		if cumulative {
+			lower := 0.0
+			if i > 0 {
+				lower = bounds[i-1]
+			}
+			ph.Sum += float64(count) * (lower + bound) / 2
+			continue
+		}
+		ph.Sum += float64(count) * binMidpoint(bound)
+	}
+	return ph
+}
+
+// binExponent returns the exponent of the width of the circonus log linear
+// bin containing v, bins hold two significant digits.
+func binExponent(v float64) float64 {
+	return math.Floor(math.Log10(math.Abs(v))) - 1
+}
+
+// scale returns n * 10^e, dividing for negative exponents so bounds such as
+// 1.3 are exact.
+func scale(n, e float64) float64 {
+	if e < 0 {
+		return n / math.Pow(10, -e)
+	}
+	return n * math.Pow(10, e)
+}
+
+// binUpperBound returns the upper bound of the circonus bin with value v,
+// positive bins extend away from zero, negative bins toward it.
+func binUpperBound(v float64) float64 {
+	if v <= 0 {
+		return v
+	}
+	e := binExponent(v)
+	return scale(math.Round(scale(v, -e))+1, e)
+}
+
+// binMidpoint returns the midpoint of the bin with the given upper bound.
+func binMidpoint(bound float64) float64 {
+	switch {
+	case bound == 0:
+		return 0
+	case bound < 0:
+		e := binExponent(bound)
+		return scale(math.Round(scale(bound, -e))-0.5, e)
+	default:
+		// the bin below the bound, 20 is the bound of the bin 19
+		e := binExponent(math.Nextafter(bound, 0))
+		return scale(math.Round(scale(bound, -e))-0.5, e)
+	}
+}
+
+// expire removes the metrics not updated within the expiration interval.
+func (p *PrometheusClient) expire(now time.Time) {
+	age := p.ExpirationInterval.Duration
+	if age <= 0 {
+		return
+	}
+	p.coll.Expire(now, age)
+	expireTime := now.Add(-age)
+	for key, h := range p.histograms {
+		if h.addTime.Before(expireTime) {
+			delete(p.histograms, key)
+		}
+	}
+}
+
+// Close shuts down the HTTP server.
+func (p *PrometheusClient) Close() error {
+	if p.server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_ = p.server.Shutdown(ctx)
+	p.wg.Wait()
+	p.origin = ""
+	return nil
+}
+
+func NewPrometheusClient() *PrometheusClient {
+	return &PrometheusClient{
+		Listen:             defaultListen,
+		Path:               defaultPath,
+		ExpirationInterval: internal.Duration{Duration: defaultExpirationInterval},
+		ReadTimeout:        internal.Duration{Duration: defaultReadTimeout},
+		WriteTimeout:       internal.Duration{Duration: defaultWriteTimeout},
+	}
+}
+
+func init() {
+	outputs.Add("prometheus_client", func() cua.Output {
+		return NewPrometheusClient()
+	})
+}
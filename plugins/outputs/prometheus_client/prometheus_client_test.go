@@ -0,0 +1,138 @@
+package prometheusclient
+
+import (
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/internal"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) *PrometheusClient {
+	t.Helper()
+
+	p := NewPrometheusClient()
+	p.Listen = "127.0.0.1:0"
+	p.Log = testutil.Logger{}
+	require.NoError(t, p.Init())
+	require.NoError(t, p.Connect())
+	t.Cleanup(func() {
+		require.NoError(t, p.Close())
+	})
+	return p
+}
+
+func scrape(t *testing.T, p *PrometheusClient, user, pass string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, p.URL(), nil)
+	require.NoError(t, err)
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestPrometheusClient(t *testing.T) {
+	p := newTestClient(t)
+	now := time.Now()
+
+	_, err := p.Write([]cua.Metric{
+		testutil.MustMetric("cpu", map[string]string{"host": "a"},
+			map[string]interface{}{"time_idle": 42.0}, now, cua.Gauge),
+		testutil.MustMetric("cpu", map[string]string{"host": "a"},
+			map[string]interface{}{"time_idle": 43.0}, now.Add(time.Second), cua.Gauge),
+	})
+	require.NoError(t, err)
+
+	code, body := scrape(t, p, "", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "# TYPE cpu_time_idle gauge\n")
+	require.Contains(t, body, `cpu_time_idle{host="a"} 43`+"\n")
+}
+
+func TestPrometheusClientHistogram(t *testing.T) {
+	p := newTestClient(t)
+	now := time.Now()
+
+	// circonus bins: 1.2e+00 is [1.2,1.3), 1.5e+01 is [15,16)
+	hist := testutil.MustMetric("latency", map[string]string{"host": "a"},
+		map[string]interface{}{
+			"1.200000e+00": int64(2),
+			"1.500000e+01": int64(1),
+		}, now, cua.Histogram)
+	_, err := p.Write([]cua.Metric{hist})
+	require.NoError(t, err)
+
+	// interval counts accumulate
+	_, err = p.Write([]cua.Metric{hist})
+	require.NoError(t, err)
+
+	// prometheus bounds from the prometheus input, counts per bucket
+	cumulative := testutil.MustMetric("requests", nil,
+		map[string]interface{}{
+			"5.000000e-01":  int64(3),
+			"1.000000e+00":  int64(1),
+			"1.000000e+128": int64(1),
+		}, now, cua.CumulativeHistogram)
+	_, err = p.Write([]cua.Metric{cumulative, cumulative})
+	require.NoError(t, err)
+
+	_, body := scrape(t, p, "", "")
+	require.Contains(t, body, "# TYPE latency histogram\n")
+	require.Contains(t, body, `latency_bucket{host="a",le="1.3"} 4`+"\n")
+	require.Contains(t, body, `latency_bucket{host="a",le="16"} 6`+"\n")
+	require.Contains(t, body, `latency_bucket{host="a",le="+Inf"} 6`+"\n")
+	require.Contains(t, body, `latency_sum{host="a"} 36`+"\n")
+	require.Contains(t, body, `latency_count{host="a"} 6`+"\n")
+
+	require.Contains(t, body, "# TYPE requests histogram\n")
+	require.Contains(t, body, `requests_bucket{le="0.5"} 3`+"\n")
+	require.Contains(t, body, `requests_bucket{le="1"} 4`+"\n")
+	require.Contains(t, body, `requests_bucket{le="+Inf"} 5`+"\n")
+	require.Contains(t, body, `requests_count 5`+"\n")
+}
+
+func TestPrometheusClientExpiration(t *testing.T) {
+	p := newTestClient(t)
+	p.ExpirationInterval = internal.Duration{Duration: time.Millisecond}
+
+	_, err := p.Write([]cua.Metric{
+		testutil.MustMetric("cpu", nil, map[string]interface{}{"time_idle": 42.0}, time.Now(), cua.Gauge),
+	})
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, body := scrape(t, p, "", "")
+	require.NotContains(t, body, "cpu_time_idle")
+}
+
+func TestPrometheusClientBasicAuth(t *testing.T) {
+	p := NewPrometheusClient()
+	p.Listen = "127.0.0.1:0"
+	p.BasicUsername = "user"
+	p.BasicPassword = "secret"
+	p.Log = testutil.Logger{}
+	require.NoError(t, p.Init())
+	require.NoError(t, p.Connect())
+	defer p.Close()
+
+	code, _ := scrape(t, p, "", "")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = scrape(t, p, "user", "wrong")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = scrape(t, p, "user", "secret")
+	require.Equal(t, http.StatusOK, code)
+}
@@ -2,6 +2,7 @@ package all
 
 //nolint:golint
 import (
+	_ "github.com/circonus-labs/circonus-unified-agent/plugins/processors/circonus_types"
 	_ "github.com/circonus-labs/circonus-unified-agent/plugins/processors/clone"
 	_ "github.com/circonus-labs/circonus-unified-agent/plugins/processors/converter"
 	_ "github.com/circonus-labs/circonus-unified-agent/plugins/processors/date"
@@ -0,0 +1,110 @@
+package circonustypes
+
+import (
+	"fmt"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/filter"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/typehint"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/processors"
+)
+
+const sampleConfig = `
+  ## Annotate fields with the circonus metric type the circonus output should
+  ## send them as, instead of inferring it from the value. Each option is a
+  ## type and the array selects the field keys, it may contain globs. A field
+  ## matching more than one type uses the first of counter, gauge, text, histogram.
+  ##   <type> = [<field-key>...]
+  # counter = ["requests", "*_total"]
+  # gauge = []
+  # text = ["version"]
+  # histogram = ["latency"]
+
+  ## Annotate all the fields of the metrics (e.g. an input emitting serialized
+  ## histograms), field types above take precedence.
+  # metric_type = ""
+
+  ## Select the metrics to annotate with namepass/namedrop, tagpass/tagdrop.
+`
+
+// CirconusTypes annotates fields with the circonus metric type (type hints) honored
+// by the circonus output.
+type CirconusTypes struct {
+	Counter    []string `toml:"counter"`
+	Gauge      []string `toml:"gauge"`
+	Text       []string `toml:"text"`
+	Histogram  []string `toml:"histogram"`
+	MetricType string   `toml:"metric_type"`
+
+	filters []typeFilter
+}
+
+type typeFilter struct {
+	typ    string
+	filter filter.Filter
+}
+
+func (p *CirconusTypes) SampleConfig() string {
+	return sampleConfig
+}
+
+func (p *CirconusTypes) Description() string {
+	return "Annotate fields with the circonus metric type to send them as"
+}
+
+func (p *CirconusTypes) Init() error {
+	if p.MetricType != "" {
+		if err := typehint.Validate(p.MetricType); err != nil {
+			return fmt.Errorf("metric_type: %w", err)
+		}
+	}
+
+	p.filters = nil
+	for _, tf := range []struct {
+		typ  string
+		keys []string
+	}{
+		{typehint.Counter, p.Counter},
+		{typehint.Gauge, p.Gauge},
+		{typehint.Text, p.Text},
+		{typehint.Histogram, p.Histogram},
+	} {
+		if len(tf.keys) == 0 {
+			continue
+		}
+		f, err := filter.Compile(tf.keys)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tf.typ, err)
+		}
+		p.filters = append(p.filters, typeFilter{typ: tf.typ, filter: f})
+	}
+
+	if len(p.filters) == 0 && p.MetricType == "" {
+		return fmt.Errorf("no field types or metric_type configured")
+	}
+
+	return nil
+}
+
+func (p *CirconusTypes) Apply(metrics ...cua.Metric) []cua.Metric {
+	for _, metric := range metrics {
+		if p.MetricType != "" {
+			metric.SetTypeHint("", p.MetricType)
+		}
+		for _, field := range metric.FieldList() {
+			for _, tf := range p.filters {
+				if tf.filter.Match(field.Key) {
+					metric.SetTypeHint(field.Key, tf.typ)
+					break
+				}
+			}
+		}
+	}
+	return metrics
+}
+
+func init() {
+	processors.Add("circonus_types", func() cua.Processor {
+		return &CirconusTypes{}
+	})
+}
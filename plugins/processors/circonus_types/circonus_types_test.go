@@ -0,0 +1,119 @@
+package circonustypes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCirconusTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		processor *CirconusTypes
+		input     cua.Metric
+		expected  []cua.Metric
+		hints     map[string]string
+	}{
+		{
+			name: "field types",
+			processor: &CirconusTypes{
+				Counter: []string{"*_total"},
+				Text:    []string{"banner"},
+			},
+			input: testutil.MustMetric(
+				"app",
+				map[string]string{"host": "a"},
+				map[string]interface{}{
+					"requests_total": int64(12),
+					"banner":         "H[ello]=world",
+					"latency":        0.25,
+				},
+				time.Unix(0, 0),
+			),
+			expected: []cua.Metric{
+				testutil.MustMetric(
+					"app",
+					map[string]string{"host": "a"},
+					map[string]interface{}{
+						"requests_total": int64(12),
+						"banner":         "H[ello]=world",
+						"latency":        0.25,
+					},
+					time.Unix(0, 0),
+				),
+			},
+			hints: map[string]string{"requests_total": "counter", "banner": "text"},
+		},
+		{
+			name: "first matching type",
+			processor: &CirconusTypes{
+				Counter:   []string{"req*"},
+				Histogram: []string{"*"},
+			},
+			input: testutil.MustMetric(
+				"app",
+				map[string]string{},
+				map[string]interface{}{
+					"requests": int64(12),
+					"latency":  0.25,
+				},
+				time.Unix(0, 0),
+			),
+			expected: []cua.Metric{
+				testutil.MustMetric(
+					"app",
+					map[string]string{},
+					map[string]interface{}{
+						"requests": int64(12),
+						"latency":  0.25,
+					},
+					time.Unix(0, 0),
+				),
+			},
+			hints: map[string]string{"requests": "counter", "latency": "histogram"},
+		},
+		{
+			name: "metric type",
+			processor: &CirconusTypes{
+				MetricType: "histogram",
+			},
+			input: testutil.MustMetric(
+				"app",
+				map[string]string{},
+				map[string]interface{}{
+					"latency": "H[0.1]=3,H[0.2]=1",
+				},
+				time.Unix(0, 0),
+			),
+			expected: []cua.Metric{
+				testutil.MustMetric(
+					"app",
+					map[string]string{},
+					map[string]interface{}{
+						"latency": "H[0.1]=3,H[0.2]=1",
+					},
+					time.Unix(0, 0),
+				),
+			},
+			hints: map[string]string{"": "histogram"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, tt.processor.Init())
+			actual := tt.processor.Apply(tt.input)
+			testutil.RequireMetricsEqual(t, tt.expected, actual)
+			require.Equal(t, tt.hints, actual[0].TypeHints())
+		})
+	}
+}
+
+func TestCirconusTypesInit(t *testing.T) {
+	require.Error(t, (&CirconusTypes{}).Init())
+	require.Error(t, (&CirconusTypes{MetricType: "summary"}).Init())
+	require.Error(t, (&CirconusTypes{Counter: []string{"["}}).Init())
+	require.NoError(t, (&CirconusTypes{MetricType: "text"}).Init())
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/circonus-labs/circonus-unified-agent/cua"
+	"github.com/circonus-labs/circonus-unified-agent/plugins/common/typehint"
 	"github.com/circonus-labs/go-trapmetrics"
 )
 
@@ -91,6 +92,9 @@ func (s *Serializer) convertTags(m cua.Metric) trapmetrics.Tags { //nolint:unpar
 
 	if len(tags) > 0 {
 		for _, t := range tags {
+			if typehint.IsReserved(t.Key) {
+				continue
+			}
 			if t.Key == "input_metric_group" {
 				haveInputMetricGroup = true
 			}
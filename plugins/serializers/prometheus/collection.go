@@ -477,3 +477,40 @@ func (c *Collection) GetProto() []*dto.MetricFamily {
 
 	return result
 }
+
+// AddHistogram adds a histogram built from something other than prometheus
+// style bucket fields, such as a circonus histogram. The metric name is used
+// as is and the histogram replaces any previous value of the series.
+func (c *Collection) AddHistogram(metric cua.Metric, histogram *Histogram, now time.Time) {
+	metricName, ok := SanitizeMetricName(metric.Name())
+	if !ok {
+		return
+	}
+
+	family := MetricFamily{
+		Name: metricName,
+		Type: cua.Histogram,
+	}
+
+	entry, ok := c.Entries[family]
+	if !ok {
+		entry = Entry{
+			Family:  family,
+			Metrics: make(map[MetricKey]*Metric),
+		}
+		c.Entries[family] = entry
+	}
+
+	labels := c.createLabels(metric)
+	metricKey := MakeMetricKey(labels)
+	if m, ok := entry.Metrics[metricKey]; ok && metric.Time().Before(m.Time) {
+		return
+	}
+
+	entry.Metrics[metricKey] = &Metric{
+		Labels:    labels,
+		Time:      metric.Time(),
+		AddTime:   now,
+		Histogram: histogram,
+	}
+}
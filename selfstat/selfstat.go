@@ -109,6 +109,42 @@ func Metrics() []cua.Metric {
 	return metrics
 }
 
+// Snapshot returns the current value of all registered stats. Unlike Metrics,
+// timing stats are not reset, so it can be called at any time without
+// affecting the values reported by the inputs.internal plugin.
+func Snapshot() []cua.Metric {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	now := time.Now()
+	metrics := make([]cua.Metric, 0, len(registry.stats))
+	for _, stats := range registry.stats {
+		if len(stats) == 0 {
+			continue
+		}
+		var tags map[string]string
+		var name string
+		fields := map[string]interface{}{}
+		for fieldname, stat := range stats {
+			if tags == nil {
+				tags = stat.Tags()
+				name = stat.Name()
+			}
+			if ts, ok := stat.(*timingStat); ok {
+				fields[fieldname] = ts.peek()
+				continue
+			}
+			fields[fieldname] = stat.Get()
+		}
+		metric, err := metric.New(name, tags, fields, now)
+		if err != nil {
+			log.Printf("E! Error creating selfstat metric: %s", err)
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
 type Registry struct {
 	mu    sync.Mutex
 	stats map[uint64]map[string]Stat